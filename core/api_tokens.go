@@ -0,0 +1,301 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// APITokenPrefix API令牌前缀，便于在日志和代码仓库中识别泄露的令牌
+const APITokenPrefix = "lsv_"
+
+// apiTokenTouchInterval 最后使用时间的更新间隔，避免每个请求都写库
+const apiTokenTouchInterval = time.Minute
+
+// maxAPITokensPerUser 每个用户最多可创建的令牌数量
+const maxAPITokensPerUser = 20
+
+// tokenScopes 可授予API令牌的权限（管理类权限只能通过登录会话使用）
+var tokenScopes = []string{PermDashboardView, PermRankView, PermJobsView, PermJobsRun}
+
+// APIToken log_api_tokens 表记录，只保存令牌的SHA-256，不保存原始令牌
+type APIToken struct {
+	ID         uint       `gorm:"column:id;primaryKey" json:"id"`
+	Username   string     `gorm:"column:username" json:"username"`
+	Name       string     `gorm:"column:name" json:"name"`
+	TokenHash  string     `gorm:"column:token_hash" json:"-"`
+	Prefix     string     `gorm:"column:prefix" json:"prefix"` // 令牌前几位，用于在列表中辨认
+	Scopes     string     `gorm:"column:scopes" json:"-"`      // 逗号分隔的权限列表
+	ExpiresAt  *time.Time `gorm:"column:expires_at" json:"expires_at"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at" json:"last_used_at"`
+	LastUsedIP string     `gorm:"column:last_used_ip" json:"last_used_ip"`
+	CreatedAt  time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+// TableName 指定表名
+func (APIToken) TableName() string {
+	return "log_api_tokens"
+}
+
+// ScopeList 获取令牌的权限列表
+func (t *APIToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return nil
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+// Expired 判断令牌是否已过期
+func (t *APIToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && now.After(*t.ExpiresAt)
+}
+
+// APITokenManager API令牌管理器
+type APITokenManager struct {
+	db *gorm.DB
+	mu sync.Mutex
+	// lastTouch 令牌最近一次写入最后使用时间的时刻
+	lastTouch map[uint]time.Time
+	// pending 尚未完成的异步写入
+	pending sync.WaitGroup
+}
+
+// 全局API令牌管理器实例
+var apiTokenManager *APITokenManager
+
+// InitAPITokenManager 初始化API令牌管理器
+func InitAPITokenManager(database *gorm.DB) {
+	apiTokenManager = &APITokenManager{
+		db:        database,
+		lastTouch: make(map[uint]time.Time),
+	}
+	appLogger.Info("API令牌管理器初始化完成")
+}
+
+// generateAPIToken 生成随机API令牌
+func generateAPIToken() (string, error) {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("生成令牌失败: %v", err)
+	}
+	return APITokenPrefix + hex.EncodeToString(bytes), nil
+}
+
+// Create 为用户创建API令牌，返回原始令牌（只在创建时返回一次）
+// scopes 必须是用户角色拥有的权限，expiresAt 为 nil 表示永不过期
+func (tm *APITokenManager) Create(username, role, name string, scopes []string, expiresAt *time.Time) (string, *APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > 100 {
+		return "", nil, fmt.Errorf("令牌名称不能为空且不超过100个字符")
+	}
+	if len(scopes) == 0 {
+		return "", nil, fmt.Errorf("请至少选择一个权限")
+	}
+	for _, scope := range scopes {
+		if !isTokenScope(scope) {
+			return "", nil, fmt.Errorf("权限 '%s' 不能授予API令牌", scope)
+		}
+		if !HasPermission(role, scope) {
+			return "", nil, fmt.Errorf("当前角色没有权限 '%s'", scope)
+		}
+	}
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return "", nil, fmt.Errorf("过期时间不能早于当前时间")
+	}
+
+	var count int64
+	if err := tm.db.Model(&APIToken{}).Where("username = ?", username).Count(&count).Error; err != nil {
+		return "", nil, fmt.Errorf("查询令牌数量失败: %v", err)
+	}
+	if count >= maxAPITokensPerUser {
+		return "", nil, fmt.Errorf("每个用户最多创建 %d 个令牌", maxAPITokensPerUser)
+	}
+
+	raw, err := generateAPIToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := &APIToken{
+		Username:  username,
+		Name:      name,
+		TokenHash: hashSessionToken(raw),
+		Prefix:    raw[:len(APITokenPrefix)+8],
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := tm.db.Create(token).Error; err != nil {
+		return "", nil, fmt.Errorf("保存令牌失败: %v", err)
+	}
+
+	appLogger.Info(fmt.Sprintf("创建API令牌: 用户=%s, 名称=%s, 权限=%s", username, name, token.Scopes))
+	return raw, token, nil
+}
+
+// Authenticate 校验原始令牌，返回有效（存在且未过期）的令牌记录
+func (tm *APITokenManager) Authenticate(raw, ip string) (*APIToken, bool) {
+	if !strings.HasPrefix(raw, APITokenPrefix) {
+		return nil, false
+	}
+
+	var token APIToken
+	err := tm.db.Where("token_hash = ?", hashSessionToken(raw)).First(&token).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			appLogger.Error(fmt.Sprintf("查询API令牌失败: %v", err))
+		}
+		return nil, false
+	}
+
+	now := time.Now()
+	if token.Expired(now) {
+		return nil, false
+	}
+
+	// 按间隔更新最后使用时间和IP（异步执行，不阻塞请求）
+	tm.mu.Lock()
+	touch := now.Sub(tm.lastTouch[token.ID]) >= apiTokenTouchInterval
+	if touch {
+		tm.lastTouch[token.ID] = now
+	}
+	tm.mu.Unlock()
+	if touch {
+		tm.pending.Add(1)
+		go func(id uint) {
+			defer tm.pending.Done()
+			if err := tm.db.Model(&APIToken{}).Where("id = ?", id).Updates(map[string]interface{}{
+				"last_used_at": now,
+				"last_used_ip": truncateString(ip, 45),
+			}).Error; err != nil {
+				appLogger.Error(fmt.Sprintf("更新API令牌使用时间失败: %v", err))
+			}
+		}(token.ID)
+	}
+
+	return &token, true
+}
+
+// Flush 等待异步写入的令牌使用记录完成
+func (tm *APITokenManager) Flush() {
+	tm.pending.Wait()
+}
+
+// List 获取令牌列表，username 为空时返回全部用户的令牌
+func (tm *APITokenManager) List(username string) ([]APIToken, error) {
+	query := tm.db.Order("created_at desc")
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+
+	var tokens []APIToken
+	if err := query.Find(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("获取令牌列表失败: %v", err)
+	}
+	return tokens, nil
+}
+
+// Revoke 删除令牌，username 不为空时只能删除该用户自己的令牌
+func (tm *APITokenManager) Revoke(id uint, username string) (*APIToken, error) {
+	var token APIToken
+	query := tm.db.Where("id = ?", id)
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	if err := query.First(&token).Error; err != nil {
+		return nil, fmt.Errorf("令牌不存在")
+	}
+
+	if err := tm.db.Delete(&APIToken{}, token.ID).Error; err != nil {
+		return nil, fmt.Errorf("删除令牌失败: %v", err)
+	}
+
+	tm.mu.Lock()
+	delete(tm.lastTouch, token.ID)
+	tm.mu.Unlock()
+
+	appLogger.Info(fmt.Sprintf("API令牌已撤销: 用户=%s, 名称=%s", token.Username, token.Name))
+	return &token, nil
+}
+
+// RevokeUserTokens 删除用户的全部令牌（停用用户时调用）
+func (tm *APITokenManager) RevokeUserTokens(username string) (int, error) {
+	result := tm.db.Where("username = ?", username).Delete(&APIToken{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("删除令牌失败: %v", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		appLogger.Info(fmt.Sprintf("已撤销用户 %s 的 %d 个API令牌", username, result.RowsAffected))
+	}
+	return int(result.RowsAffected), nil
+}
+
+// isTokenScope 判断权限是否可以授予API令牌
+func isTokenScope(scope string) bool {
+	for _, s := range tokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// grantableTokenScopes 获取角色可以授予API令牌的权限
+func grantableTokenScopes(role string) []string {
+	var scopes []string
+	for _, s := range tokenScopes {
+		if HasPermission(role, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// bearerToken 从 Authorization 头中读取 Bearer 令牌
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// isTokenForbiddenPath 只能通过登录会话访问的路径（账号安全设置、令牌和会话管理）
+// 其余管理接口需要 users:manage 权限，该权限不能授予令牌
+func isTokenForbiddenPath(path string) bool {
+	for _, prefix := range []string{"/api/current-user/", "/api/tokens", "/api/sessions"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenViews 转换为返回给前端的令牌列表
+func tokenViews(tokens []APIToken) []gin.H {
+	now := time.Now()
+	views := make([]gin.H, 0, len(tokens))
+	for i := range tokens {
+		t := &tokens[i]
+		views = append(views, gin.H{
+			"id":           t.ID,
+			"username":     t.Username,
+			"name":         t.Name,
+			"prefix":       t.Prefix,
+			"scopes":       t.ScopeList(),
+			"expires_at":   t.ExpiresAt,
+			"expired":      t.Expired(now),
+			"last_used_at": t.LastUsedAt,
+			"last_used_ip": t.LastUsedIP,
+			"created_at":   t.CreatedAt,
+		})
+	}
+	return views
+}
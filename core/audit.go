@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 审计操作类型
+const (
+	AuditUserCreate         = "user.create"          // 创建用户
+	AuditUserPasswordReset  = "user.password_reset"  // 管理员重置用户密码
+	AuditUserPasswordChange = "user.password_change" // 用户修改自己的密码
+	AuditUserProvision      = "user.provision"       // 外部认证首次登录自动创建用户
+	AuditUserUpdate         = "user.update"          // 编辑用户信息
+	AuditUserDeactivate     = "user.deactivate"      // 停用用户
+	AuditUserReactivate     = "user.reactivate"      // 重新启用用户
+	AuditUserDelete         = "user.delete"          // 永久删除用户
+	AuditUserRole           = "user.role"            // 修改用户角色
+	AuditUserServers        = "user.servers"         // 修改用户区服范围
+	AuditUser2FAReset       = "user.2fa_reset"       // 管理员重置用户两步验证
+	AuditUser2FADisable     = "user.2fa_disable"     // 用户停用自己的两步验证
+	AuditSessionRevoke      = "session.revoke"       // 管理员撤销会话
+	AuditLoginUnlock        = "login.unlock"         // 管理员解除登录锁定
+	AuditTokenCreate        = "token.create"         // 创建API令牌
+	AuditTokenRevoke        = "token.revoke"         // 撤销API令牌
+	AuditSettingsUpdate     = "settings.update"      // 修改系统设置
+	AuditConfigReload       = "config.reload"        // 重新加载配置文件
+	AuditCacheClear         = "cache.clear"          // 清空缓存
+	AuditCacheRebuild       = "cache.rebuild"        // 重建缓存
+	AuditJobRun             = "job.run"              // 手动触发定时任务
+)
+
+// AuditEntry audit_log 表记录
+type AuditEntry struct {
+	ID        uint      `gorm:"column:id;primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	Actor     string    `gorm:"column:actor" json:"actor"`   // 操作人用户名，未登录时为 anonymous
+	Action    string    `gorm:"column:action" json:"action"` // 操作类型，见 Audit* 常量
+	Target    string    `gorm:"column:target" json:"target"` // 操作对象（用户名、设置项、缓存名等）
+	Before    string    `gorm:"column:before_value" json:"before"`
+	After     string    `gorm:"column:after_value" json:"after"`
+	IP        string    `gorm:"column:ip" json:"ip"`
+}
+
+// TableName 指定表名
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
+
+// AuditFilter 审计日志查询条件
+type AuditFilter struct {
+	Actor    string
+	Action   string
+	Target   string
+	From     *time.Time
+	To       *time.Time
+	Page     int
+	PageSize int
+}
+
+// AuditLog 审计日志
+type AuditLog struct {
+	db *gorm.DB
+}
+
+// 全局审计日志实例
+var auditLog *AuditLog
+
+// InitAuditLog 初始化审计日志
+func InitAuditLog(database *gorm.DB) {
+	auditLog = &AuditLog{db: database}
+	appLogger.Info("审计日志初始化完成")
+}
+
+// auditValue 将变更前后的值序列化为JSON，nil 记为空字符串
+func auditValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+// RecordAudit 记录一条审计日志，操作人和IP从请求上下文中获取
+// before/after 为变更前后的值，不得包含密码、令牌等敏感信息
+func RecordAudit(c *gin.Context, action, target string, before, after interface{}) {
+	actor := c.GetString("user")
+	if actor == "" {
+		actor = "anonymous"
+	}
+	writeAudit(actor, c.ClientIP(), action, target, before, after)
+}
+
+// writeAudit 写入审计日志，用于没有请求上下文的场景（如认证后端自动创建用户）
+func writeAudit(actor, ip, action, target string, before, after interface{}) {
+	entry := &AuditEntry{
+		CreatedAt: time.Now(),
+		Actor:     actor,
+		Action:    action,
+		Target:    truncateString(target, 255),
+		Before:    auditValue(before),
+		After:     auditValue(after),
+		IP:        truncateString(ip, 45),
+	}
+
+	appLogger.Info(fmt.Sprintf("审计: 操作人=%s, 操作=%s, 对象=%s, IP=%s", entry.Actor, entry.Action, entry.Target, entry.IP))
+	if auditLog == nil {
+		return
+	}
+	if err := auditLog.db.Create(entry).Error; err != nil {
+		appLogger.Error(fmt.Sprintf("写入审计日志失败: %v", err))
+	}
+}
+
+// Query 按条件分页查询审计日志（按时间倒序）
+func (a *AuditLog) Query(filter AuditFilter) ([]AuditEntry, int64, error) {
+	query := a.db.Model(&AuditEntry{})
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Target != "" {
+		query = query.Where("target = ?", filter.Target)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询审计日志失败: %v", err)
+	}
+
+	if filter.PageSize <= 0 || filter.PageSize > 200 {
+		filter.PageSize = 50
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+
+	var entries []AuditEntry
+	if err := query.Order("id desc").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&entries).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询审计日志失败: %v", err)
+	}
+	return entries, total, nil
+}
+
+// auditActions 审计操作类型及名称，用于页面筛选
+var auditActions = []gin.H{
+	{"action": AuditUserCreate, "label": "创建用户"},
+	{"action": AuditUserPasswordReset, "label": "重置密码"},
+	{"action": AuditUserPasswordChange, "label": "修改密码"},
+	{"action": AuditUserProvision, "label": "自动创建用户"},
+	{"action": AuditUserUpdate, "label": "编辑用户"},
+	{"action": AuditUserDeactivate, "label": "停用用户"},
+	{"action": AuditUserReactivate, "label": "启用用户"},
+	{"action": AuditUserDelete, "label": "删除用户"},
+	{"action": AuditUserRole, "label": "修改角色"},
+	{"action": AuditUserServers, "label": "修改区服范围"},
+	{"action": AuditUser2FAReset, "label": "重置两步验证"},
+	{"action": AuditUser2FADisable, "label": "停用两步验证"},
+	{"action": AuditSessionRevoke, "label": "撤销会话"},
+	{"action": AuditLoginUnlock, "label": "解除登录锁定"},
+	{"action": AuditTokenCreate, "label": "创建API令牌"},
+	{"action": AuditTokenRevoke, "label": "撤销API令牌"},
+	{"action": AuditSettingsUpdate, "label": "修改系统设置"},
+	{"action": AuditConfigReload, "label": "重新加载配置"},
+	{"action": AuditCacheClear, "label": "清空缓存"},
+	{"action": AuditCacheRebuild, "label": "重建缓存"},
+	{"action": AuditJobRun, "label": "触发定时任务"},
+}
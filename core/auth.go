@@ -2,130 +2,344 @@ package main
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/http"
-	"sync"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // Session 会话结构体
 type Session struct {
-	ID        string    `json:"id"`
+	ID        string    `json:"id"` // 会话标识（会话令牌的SHA-256），用于存储和管理
+	Token     string    `json:"-"`  // 会话令牌（仅创建时存在，写入Cookie，不持久化）
 	Username  string    `json:"username"`
 	CreatedAt time.Time `json:"created_at"`
 	ExpiresAt time.Time `json:"expires_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+}
+
+// SessionConfig 会话配置
+type SessionConfig struct {
+	Store       string `yaml:"store"`       // 存储方式: db(默认)、file、memory
+	File        string `yaml:"file"`        // store 为 file 时的会话文件路径
+	Duration    string `yaml:"duration"`    // 会话最长有效期，默认 24h
+	IdleTimeout string `yaml:"idleTimeout"` // 空闲超时（超过该时长无请求则会话失效），为空表示不限制
+	// CookieSecure Cookie是否只通过HTTPS发送: auto(默认，请求为HTTPS或反向代理传入 X-Forwarded-Proto: https 时设置)、true、false
+	CookieSecure string `yaml:"cookieSecure"`
+	// CookieSameSite Cookie的SameSite属性: lax(默认)、strict、none（none 要求 cookieSecure 为 true）
+	CookieSameSite string `yaml:"cookieSameSite"`
 }
 
 // SessionManager 会话管理器
 type SessionManager struct {
-	sessions map[string]*Session
-	mu       sync.RWMutex
+	store        SessionStore
+	duration     time.Duration
+	idleTimeout  time.Duration
+	cookieSecure string
+	sameSite     http.SameSite
 }
 
-// 全局会话管理器实例
+// 全局会话管理器实例（InitSessionManager 之前使用内存存储）
 var sessionManager = &SessionManager{
-	sessions: make(map[string]*Session),
+	store:    newMemorySessionStore(),
+	duration: SessionDuration,
 }
 
 // 默认登录凭据
 const (
 	DefaultUsername = "root"
 	DefaultPassword = "123456"
-	SessionDuration = 24 * time.Hour // 会话有效期24小时
+	SessionDuration = 24 * time.Hour // 默认会话有效期24小时
 	CookieName      = "gamelogin_session"
+
+	// sessionTouchInterval 最后活跃时间的更新间隔，避免每个请求都写存储
+	sessionTouchInterval = time.Minute
 )
 
-// generateSessionID 生成随机会话ID
+// InitSessionManager 根据配置初始化会话管理器
+func InitSessionManager(database *gorm.DB, config SessionConfig) error {
+	duration := SessionDuration
+	if config.Duration != "" {
+		d, err := time.ParseDuration(config.Duration)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("无效的会话有效期 '%s'", config.Duration)
+		}
+		duration = d
+	}
+
+	var idleTimeout time.Duration
+	if config.IdleTimeout != "" {
+		d, err := time.ParseDuration(config.IdleTimeout)
+		if err != nil || d < 0 {
+			return fmt.Errorf("无效的会话空闲超时 '%s'", config.IdleTimeout)
+		}
+		idleTimeout = d
+	}
+
+	cookieSecure, sameSite, err := parseCookieOptions(config.CookieSecure, config.CookieSameSite)
+	if err != nil {
+		return err
+	}
+
+	store, err := NewSessionStore(config.Store, config.File, database)
+	if err != nil {
+		return err
+	}
+
+	sessionManager = &SessionManager{
+		store:        store,
+		duration:     duration,
+		idleTimeout:  idleTimeout,
+		cookieSecure: cookieSecure,
+		sameSite:     sameSite,
+	}
+
+	storeName := config.Store
+	if storeName == "" {
+		storeName = SessionStoreDB
+	}
+	appLogger.Info(fmt.Sprintf("会话管理器初始化完成 - 存储: %s, 有效期: %v, 空闲超时: %v, Cookie Secure: %s, SameSite: %s",
+		storeName, duration, idleTimeout, cookieSecure, sameSiteName(sameSite)))
+	return nil
+}
+
+// generateSessionID 生成随机会话令牌
 func generateSessionID() string {
-	bytes := make([]byte, 16)
+	bytes := make([]byte, 32)
 	rand.Read(bytes)
 	return hex.EncodeToString(bytes)
 }
 
-// CreateSession 创建新会话
-func (sm *SessionManager) CreateSession(username string) *Session {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+// hashSessionToken 计算会话令牌对应的会话标识
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
-	// 清理过期会话
-	sm.cleanExpiredSessions()
+// Duration 获取会话有效期
+func (sm *SessionManager) Duration() time.Duration {
+	return sm.duration
+}
 
-	sessionID := generateSessionID()
+// CreateSession 创建新会话
+func (sm *SessionManager) CreateSession(username, ip, userAgent string) (*Session, error) {
+	token := generateSessionID()
+	now := time.Now()
 	session := &Session{
-		ID:        sessionID,
+		ID:        hashSessionToken(token),
+		Token:     token,
 		Username:  username,
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(SessionDuration),
+		CreatedAt: now,
+		ExpiresAt: now.Add(sm.duration),
+		LastSeen:  now,
+		IP:        ip,
+		UserAgent: userAgent,
 	}
 
-	sm.sessions[sessionID] = session
-	appLogger.Info("创建新会话: 用户=" + username + ", SessionID=" + sessionID)
-	return session
-}
+	if err := sm.store.Save(session); err != nil {
+		return nil, fmt.Errorf("保存会话失败: %v", err)
+	}
 
-// GetSession 获取会话
-func (sm *SessionManager) GetSession(sessionID string) (*Session, bool) {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+	appLogger.Info("创建新会话: 用户=" + username + ", IP=" + ip)
+	return session, nil
+}
 
-	session, exists := sm.sessions[sessionID]
-	if !exists {
+// GetSession 根据会话令牌获取会话，过期或空闲超时的会话会被删除
+func (sm *SessionManager) GetSession(token string) (*Session, bool) {
+	id := hashSessionToken(token)
+	session, err := sm.store.Get(id)
+	if err != nil {
+		appLogger.Error(fmt.Sprintf("读取会话失败: %v", err))
+		return nil, false
+	}
+	if session == nil {
 		return nil, false
 	}
 
-	// 检查会话是否过期
-	if time.Now().After(session.ExpiresAt) {
-		// 异步删除过期会话
-		go func() {
-			sm.mu.Lock()
-			delete(sm.sessions, sessionID)
-			sm.mu.Unlock()
-		}()
+	now := time.Now()
+	if sessionExpired(session, now, sm.idleTimeout) {
+		if err := sm.store.Delete(id); err != nil {
+			appLogger.Error(fmt.Sprintf("删除过期会话失败: %v", err))
+		}
 		return nil, false
 	}
 
+	// 定期更新最后活跃时间
+	if now.Sub(session.LastSeen) >= sessionTouchInterval {
+		if err := sm.store.Touch(id, now); err != nil {
+			appLogger.Error(fmt.Sprintf("更新会话活跃时间失败: %v", err))
+		}
+		session.LastSeen = now
+	}
+
 	return session, true
 }
 
-// DeleteSession 删除会话
-func (sm *SessionManager) DeleteSession(sessionID string) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-
-	if session, exists := sm.sessions[sessionID]; exists {
-		appLogger.Info("删除会话: 用户=" + session.Username + ", SessionID=" + sessionID)
-		delete(sm.sessions, sessionID)
+// DeleteSession 根据会话令牌删除会话
+func (sm *SessionManager) DeleteSession(token string) {
+	id := hashSessionToken(token)
+	session, _ := sm.store.Get(id)
+	if err := sm.store.Delete(id); err != nil {
+		appLogger.Error(fmt.Sprintf("删除会话失败: %v", err))
+		return
+	}
+	if session != nil {
+		appLogger.Info("删除会话: 用户=" + session.Username)
 	}
 }
 
-// cleanExpiredSessions 清理过期会话（内部方法，调用前需要加锁）
-func (sm *SessionManager) cleanExpiredSessions() {
-	now := time.Now()
-	for sessionID, session := range sm.sessions {
-		if now.After(session.ExpiresAt) {
-			delete(sm.sessions, sessionID)
-		}
+// CleanupExpired 清理过期和空闲超时的会话
+func (sm *SessionManager) CleanupExpired() error {
+	count, err := sm.store.DeleteExpired(time.Now(), sm.idleTimeout)
+	if err != nil {
+		return fmt.Errorf("清理过期会话失败: %v", err)
+	}
+	if count > 0 {
+		appLogger.Info(fmt.Sprintf("已清理 %d 个过期会话", count))
 	}
+	return nil
 }
 
 // GetSessionCount 获取当前活跃会话数量
 func (sm *SessionManager) GetSessionCount() int {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+	sessions, err := sm.store.List()
+	if err != nil {
+		appLogger.Error(fmt.Sprintf("读取会话列表失败: %v", err))
+		return 0
+	}
 
-	// 清理过期会话并返回数量
 	now := time.Now()
 	count := 0
-	for _, session := range sm.sessions {
-		if now.Before(session.ExpiresAt) {
+	for _, session := range sessions {
+		if !sessionExpired(session, now, sm.idleTimeout) {
 			count++
 		}
 	}
 	return count
 }
 
+// ListSessions 获取未过期的会话（按最后活跃时间倒序），username 为空时返回全部用户的会话
+func (sm *SessionManager) ListSessions(username string) ([]*Session, error) {
+	sessions, err := sm.store.List()
+	if err != nil {
+		return nil, fmt.Errorf("读取会话列表失败: %v", err)
+	}
+
+	now := time.Now()
+	result := make([]*Session, 0, len(sessions))
+	for _, session := range sessions {
+		if sessionExpired(session, now, sm.idleTimeout) {
+			continue
+		}
+		if username != "" && session.Username != username {
+			continue
+		}
+		result = append(result, session)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+	return result, nil
+}
+
+// GetSessionByID 根据会话标识获取会话
+func (sm *SessionManager) GetSessionByID(id string) (*Session, bool) {
+	session, err := sm.store.Get(id)
+	if err != nil {
+		appLogger.Error(fmt.Sprintf("读取会话失败: %v", err))
+		return nil, false
+	}
+	if session == nil || sessionExpired(session, time.Now(), sm.idleTimeout) {
+		return nil, false
+	}
+	return session, true
+}
+
+// RevokeSession 根据会话标识撤销会话
+func (sm *SessionManager) RevokeSession(id string) error {
+	if err := sm.store.Delete(id); err != nil {
+		return fmt.Errorf("撤销会话失败: %v", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions 撤销用户的全部会话，返回撤销数量
+func (sm *SessionManager) RevokeUserSessions(username string) (int, error) {
+	sessions, err := sm.store.List()
+	if err != nil {
+		return 0, fmt.Errorf("读取会话列表失败: %v", err)
+	}
+
+	count := 0
+	for _, session := range sessions {
+		if session.Username != username {
+			continue
+		}
+		if err := sm.store.Delete(session.ID); err != nil {
+			return count, fmt.Errorf("撤销会话失败: %v", err)
+		}
+		count++
+	}
+
+	if count > 0 {
+		appLogger.Info(fmt.Sprintf("已撤销用户 %s 的 %d 个会话", username, count))
+	}
+	return count, nil
+}
+
+// Close 关闭会话存储
+func (sm *SessionManager) Close() error {
+	return sm.store.Close()
+}
+
+// 认证后端返回的错误
+var (
+	// errUnknownUser 该后端中没有此用户，交给下一个后端处理
+	errUnknownUser = errors.New("用户不存在")
+	// errInvalidCredentials 用户存在但密码错误或已被停用，不再尝试其他后端
+	errInvalidCredentials = errors.New("用户名或密码错误")
+)
+
+// Authenticator 用户名密码认证后端
+// 后端不可用等其他错误与 errUnknownUser 一样交给下一个后端处理
+type Authenticator interface {
+	Name() string
+	Authenticate(username, password string) (*LogUser, error)
+}
+
+// localAuthenticator 本地 log_users 密码认证
+type localAuthenticator struct{}
+
+// Name 后端名称
+func (localAuthenticator) Name() string {
+	return AuthSourceLocal
+}
+
+// Authenticate 校验本地用户密码，外部认证用户视为不存在
+func (localAuthenticator) Authenticate(username, password string) (*LogUser, error) {
+	if user, exists := userManager.GetUser(username); !exists || !user.IsLocal() {
+		return nil, errUnknownUser
+	}
+	user, ok := userManager.ValidateUser(username, password)
+	if !ok {
+		return nil, errInvalidCredentials
+	}
+	return user, nil
+}
+
+// authenticators 认证后端链，按顺序尝试（启用LDAP时LDAP在前，本地用户兜底）
+var authenticators = []Authenticator{localAuthenticator{}}
+
 // ValidateCredentials 验证登录凭据
 func ValidateCredentials(username, password string) (*LogUser, bool) {
 	// 使用用户管理器验证凭据
@@ -135,12 +349,27 @@ func ValidateCredentials(username, password string) (*LogUser, bool) {
 			return &LogUser{
 				Username:    username,
 				DisplayName: "系统管理员",
+				Role:        RoleAdmin,
 			}, true
 		}
 		return nil, false
 	}
 
-	return userManager.ValidateUser(username, password)
+	for _, authenticator := range authenticators {
+		user, err := authenticator.Authenticate(username, password)
+		if err == nil {
+			return user, true
+		}
+		if errors.Is(err, errInvalidCredentials) {
+			return nil, false
+		}
+		if !errors.Is(err, errUnknownUser) {
+			appLogger.Error(fmt.Sprintf("认证后端 %s 出错，尝试下一个后端: 用户名=%s: %v", authenticator.Name(), username, err))
+		}
+	}
+
+	appLogger.Warning(fmt.Sprintf("用户验证失败: 用户 '%s' 不存在", username))
+	return nil, false
 }
 
 // LoginHandler 登录处理函数
@@ -159,57 +388,187 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
+	clientIP := c.ClientIP()
+
+	// 检查失败次数限制（退避或锁定期间不校验密码）
+	if allowed, retryAt, locked := loginGuard.Check(loginRequest.Username, clientIP); !allowed {
+		retryAfter := int(time.Until(retryAt).Seconds()) + 1
+		c.Header("Retry-After", fmt.Sprintf("%d", retryAfter))
+		if locked {
+			appLogger.Warning(fmt.Sprintf("登录被拒绝: 用户名=%s, IP=%s (已锁定至 %s)", loginRequest.Username, clientIP, retryAt.Format("2006-01-02 15:04:05")))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"status":       "error",
+				"message":      fmt.Sprintf("登录失败次数过多，账号已临时锁定，请于 %s 后再试", retryAt.Format("15:04:05")),
+				"locked":       true,
+				"locked_until": retryAt,
+				"retry_after":  retryAfter,
+			})
+		} else {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"status":      "error",
+				"message":     fmt.Sprintf("尝试过于频繁，请 %d 秒后再试", retryAfter),
+				"locked":      false,
+				"retry_after": retryAfter,
+			})
+		}
+		return
+	}
+
 	// 验证凭据
 	user, isValid := ValidateCredentials(loginRequest.Username, loginRequest.Password)
 	if !isValid {
-		appLogger.Warning("登录失败: 用户名=" + loginRequest.Username + " (凭据无效)")
+		remaining, lockedUntil := loginGuard.RecordFailure(loginRequest.Username, clientIP)
+		appLogger.Warning(fmt.Sprintf("登录失败: 用户名=%s, IP=%s (凭据无效，剩余尝试次数 %d)", loginRequest.Username, clientIP, remaining))
+		if !lockedUntil.IsZero() {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"status":       "error",
+				"message":      fmt.Sprintf("登录失败次数过多，账号已临时锁定，请于 %s 后再试", lockedUntil.Format("15:04:05")),
+				"locked":       true,
+				"locked_until": lockedUntil,
+				"retry_after":  int(time.Until(lockedUntil).Seconds()) + 1,
+			})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":             "error",
+			"message":            fmt.Sprintf("用户名或密码错误，还可尝试 %d 次", remaining),
+			"remaining_attempts": remaining,
+		})
+		return
+	}
+
+	// 已启用两步验证的用户需要再提交验证码，密码通过时不清零失败计数
+	if user.TOTPEnabled {
+		challenge := createTwoFactorChallenge(user.Username)
+		appLogger.Info("用户密码验证通过，等待两步验证: " + user.Username)
+		c.JSON(http.StatusOK, gin.H{
+			"status":    "2fa_required",
+			"message":   "请输入两步验证码",
+			"challenge": challenge,
+		})
+		return
+	}
+
+	loginGuard.RecordSuccess(loginRequest.Username)
+	completeLogin(c, user)
+}
+
+// TwoFactorLoginHandler 登录第二步：校验TOTP验证码或恢复码
+func TwoFactorLoginHandler(c *gin.Context) {
+	var request struct {
+		Challenge    string `json:"challenge" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil || (request.Code == "" && request.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "请输入验证码",
+		})
+		return
+	}
+
+	challenge, ok := takeTwoFactorChallenge(request.Challenge)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"status":  "error",
-			"message": "用户名或密码错误",
+			"message": "验证已过期或尝试次数过多，请重新登录",
+			"expired": true,
 		})
 		return
 	}
 
+	clientIP := c.ClientIP()
+	usedRecovery, valid := userManager.VerifySecondFactor(challenge.Username, request.Code, request.RecoveryCode)
+	if !valid {
+		remaining, lockedUntil := loginGuard.RecordFailure(challenge.Username, clientIP)
+		appLogger.Warning(fmt.Sprintf("两步验证失败: 用户名=%s, IP=%s", challenge.Username, clientIP))
+		if !lockedUntil.IsZero() {
+			completeTwoFactorChallenge(request.Challenge)
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"status":       "error",
+				"message":      fmt.Sprintf("验证失败次数过多，账号已临时锁定，请于 %s 后再试", lockedUntil.Format("15:04:05")),
+				"locked":       true,
+				"locked_until": lockedUntil,
+			})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":             "error",
+			"message":            "验证码错误",
+			"remaining_attempts": remaining,
+		})
+		return
+	}
+
+	completeTwoFactorChallenge(request.Challenge)
+	loginGuard.RecordSuccess(challenge.Username)
+
+	user, exists := userManager.GetUser(challenge.Username)
+	if !exists || !user.IsActive {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"message": "用户不存在或已被停用",
+		})
+		return
+	}
+	if usedRecovery {
+		c.Set("used_recovery_code", true)
+	}
+	completeLogin(c, user)
+}
+
+// completeLogin 创建会话并返回登录成功
+func completeLogin(c *gin.Context, user *LogUser) {
 	// 创建会话
-	session := sessionManager.CreateSession(user.Username)
+	session, err := sessionManager.CreateSession(user.Username, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		appLogger.Error("登录失败: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "创建会话失败，请稍后重试",
+		})
+		return
+	}
 
 	// 设置Session Cookie
-	c.SetCookie(
-		CookieName,                     // 名称
-		session.ID,                     // 值
-		int(SessionDuration.Seconds()), // 最大年龄（秒）
-		"/",                            // 路径
-		"",                             // 域名
-		false,                          // 仅HTTPS
-		true,                           // HTTP Only
-	)
+	setSessionCookie(c, session)
 
 	appLogger.Info("用户登录成功: " + user.Username + " (" + user.DisplayName + ")")
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"status":       "success",
 		"message":      "登录成功",
 		"user":         user.Username,
 		"display_name": user.DisplayName,
-	})
+		"role":         user.Role,
+	}
+	// 需要先修改密码或被要求但尚未启用两步验证时，前端跳转到对应页面
+	if user.MustChangePassword {
+		response["redirect"] = "/change-password"
+	} else if !user.TOTPEnabled && TwoFactorRequired(user) {
+		response["redirect"] = "/2fa"
+	}
+	if c.GetBool("used_recovery_code") {
+		response["recovery_codes_remaining"] = user.RecoveryCodesRemaining()
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // LogoutHandler 退出登录处理函数
 func LogoutHandler(c *gin.Context) {
 	sessionID, err := c.Cookie(CookieName)
 	if err == nil && sessionID != "" {
+		// 防止第三方页面强制用户退出
+		if !validCSRFToken(c, sessionID) {
+			rejectCSRF(c)
+			return
+		}
 		sessionManager.DeleteSession(sessionID)
 	}
 
 	// 清除Cookie
-	c.SetCookie(
-		CookieName,
-		"",
-		-1,
-		"/",
-		"",
-		false,
-		true,
-	)
+	clearSessionCookie(c)
 
 	appLogger.Info("用户退出登录")
 	c.JSON(http.StatusOK, gin.H{
@@ -221,6 +580,12 @@ func LogoutHandler(c *gin.Context) {
 // AuthMiddleware 认证中间件
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 脚本等程序化访问使用API令牌（Authorization: Bearer lsv_...）
+		if raw := bearerToken(c); raw != "" {
+			authenticateAPIToken(c, raw)
+			return
+		}
+
 		// 获取Session Cookie
 		sessionID, err := c.Cookie(CookieName)
 		if err != nil || sessionID == "" {
@@ -253,13 +618,201 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 获取用户角色（用户被停用或删除后会话立即失效）
+		role := RoleAdmin
+		scope := &ServerScope{All: true}
+		if userManager != nil {
+			user, found := userManager.GetUser(session.Username)
+			if !found || !user.IsActive {
+				sessionManager.DeleteSession(sessionID)
+				if isAPIRequest(c) {
+					c.JSON(http.StatusUnauthorized, gin.H{
+						"status":  "error",
+						"message": "用户不存在或已被停用",
+					})
+				} else {
+					c.Redirect(http.StatusFound, "/login")
+				}
+				c.Abort()
+				return
+			}
+			role = user.Role
+
+			// 被要求修改密码的用户（默认管理员首次登录、管理员重置密码后），修改前只能访问修改密码页面
+			if user.MustChangePassword && !isPasswordChangePath(c.Request.URL.Path) {
+				if isAPIRequest(c) {
+					c.JSON(http.StatusForbidden, gin.H{
+						"status":  "error",
+						"message": "请先修改密码",
+						"code":    "password_change_required",
+					})
+				} else {
+					c.Redirect(http.StatusFound, "/change-password")
+				}
+				c.Abort()
+				return
+			}
+
+			// 被要求启用两步验证的用户，启用前只能访问启用页面
+			if !user.TOTPEnabled && TwoFactorRequired(user) && !isTwoFactorSetupPath(c.Request.URL.Path) {
+				if isAPIRequest(c) {
+					c.JSON(http.StatusForbidden, gin.H{
+						"status":  "error",
+						"message": "请先启用两步验证",
+						"code":    "2fa_setup_required",
+					})
+				} else {
+					c.Redirect(http.StatusFound, "/2fa")
+				}
+				c.Abort()
+				return
+			}
+
+			scope = userServerScope(user)
+		}
+
 		// 将用户信息存储到上下文中
 		c.Set("user", session.Username)
+		c.Set("role", role)
+		c.Set("server_scope", scope)
 		c.Set("session", session)
 		c.Next()
 	}
 }
 
+// authenticateAPIToken 使用API令牌认证请求
+// 令牌只能访问数据接口，权限为令牌授予的权限与用户当前角色权限的交集
+func authenticateAPIToken(c *gin.Context, raw string) {
+	if apiTokenManager == nil || userManager == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "API令牌无效或已过期"})
+		c.Abort()
+		return
+	}
+
+	token, ok := apiTokenManager.Authenticate(raw, c.ClientIP())
+	if !ok {
+		appLogger.Warning("API令牌认证失败: IP=" + c.ClientIP() + ", 路径=" + c.Request.URL.Path)
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "API令牌无效或已过期"})
+		c.Abort()
+		return
+	}
+
+	user, found := userManager.GetUser(token.Username)
+	if !found || !user.IsActive {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "error", "message": "用户不存在或已被停用"})
+		c.Abort()
+		return
+	}
+
+	// 与会话一致：被要求修改密码的用户在修改前不能使用API令牌
+	if user.MustChangePassword {
+		appLogger.Warning(fmt.Sprintf("API令牌认证拒绝: 用户 %s 需要先修改密码, IP=%s", user.Username, c.ClientIP()))
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "请先登录并修改密码后再使用API令牌", "code": "password_change_required"})
+		c.Abort()
+		return
+	}
+
+	if !isAPIRequest(c) || isTokenForbiddenPath(c.Request.URL.Path) {
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "API令牌不能访问该接口"})
+		c.Abort()
+		return
+	}
+
+	c.Set("user", user.Username)
+	c.Set("role", user.Role)
+	c.Set("server_scope", userServerScope(user))
+	c.Set("api_token", token)
+	c.Set("token_scopes", token.ScopeList())
+	c.Next()
+}
+
+// userServerScope 解析用户可访问的区服范围
+// 解析失败（如引用的分组已从配置中删除）时不允许访问任何区服
+func userServerScope(user *LogUser) *ServerScope {
+	scope, err := ParseServerScope(user.AllowedServers)
+	if err != nil {
+		appLogger.Error(fmt.Sprintf("用户 %s 的区服范围无效: %v", user.Username, err))
+		return &ServerScope{IDs: map[int]bool{}}
+	}
+	return scope
+}
+
+// setSessionCookie 写入会话Cookie和对应的CSRF令牌Cookie
+func setSessionCookie(c *gin.Context, session *Session) {
+	maxAge := int(sessionManager.Duration().Seconds())
+	sessionManager.setCookie(c, CookieName, session.Token, "/", maxAge, true)
+	sessionManager.setCookie(c, CSRFCookieName, csrfToken(session.Token), "/", maxAge, false)
+}
+
+// clearSessionCookie 清除会话Cookie和CSRF令牌Cookie
+func clearSessionCookie(c *gin.Context) {
+	sessionManager.setCookie(c, CookieName, "", "/", -1, true)
+	sessionManager.setCookie(c, CSRFCookieName, "", "/", -1, false)
+}
+
+// sessionViews 将会话转换为接口返回格式，并标记当前请求所用的会话
+func sessionViews(c *gin.Context, sessions []*Session) []gin.H {
+	currentID := ""
+	if token, err := c.Cookie(CookieName); err == nil && token != "" {
+		currentID = hashSessionToken(token)
+	}
+
+	views := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		views = append(views, gin.H{
+			"id":         session.ID,
+			"username":   session.Username,
+			"device":     describeUserAgent(session.UserAgent),
+			"user_agent": session.UserAgent,
+			"ip":         session.IP,
+			"created_at": session.CreatedAt,
+			"last_seen":  session.LastSeen,
+			"expires_at": session.ExpiresAt,
+			"current":    session.ID == currentID,
+		})
+	}
+	return views
+}
+
+// describeUserAgent 从User-Agent中提取简短的设备描述（浏览器 / 操作系统）
+func describeUserAgent(ua string) string {
+	if ua == "" {
+		return "未知设备"
+	}
+
+	browser := "其他浏览器"
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/") || strings.Contains(ua, "Opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	case strings.Contains(ua, "curl/"):
+		browser = "curl"
+	}
+
+	platform := "其他系统"
+	switch {
+	case strings.Contains(ua, "Windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad"):
+		platform = "iOS"
+	case strings.Contains(ua, "Mac OS X") || strings.Contains(ua, "Macintosh"):
+		platform = "macOS"
+	case strings.Contains(ua, "Android"):
+		platform = "Android"
+	case strings.Contains(ua, "Linux"):
+		platform = "Linux"
+	}
+
+	return browser + " / " + platform
+}
+
 // isAPIRequest 判断是否为API请求
 func isAPIRequest(c *gin.Context) bool {
 	// 根据请求路径或Accept头判断是否为API请求
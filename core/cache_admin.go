@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"unsafe"
+
+	"gorm.io/gorm"
+)
+
+// mapEntryOverhead 估算内存时每个map元素的额外开销（桶、哈希、指针等），只用于粗略估算
+const mapEntryOverhead = 48
+
+// CacheStats 缓存状态
+type CacheStats struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Entries     int    `json:"entries"`
+	ApproxBytes int64  `json:"approx_bytes"` // 估算的内存占用（字节）
+	Clearable   bool   `json:"clearable"`
+}
+
+// managedCache 可通过管理接口查看、清空和重建的缓存
+type managedCache struct {
+	name        string
+	description string
+	size        func() int
+	memory      func() int64
+	clear       func() // 为 nil 表示不允许清空（如用户缓存，清空后所有用户将无法登录）
+	rebuild     func(db *gorm.DB) error
+}
+
+// managedCaches 全部可管理的缓存
+var managedCaches = []managedCache{
+	{
+		name:        "players",
+		description: "玩家去重缓存（当前业务日已记录的玩家）",
+		size:        func() int { return playerCache.GetCacheSize() },
+		memory:      func() int64 { return playerCache.MemoryUsage() },
+		clear:       func() { playerCache.ClearCache() },
+		rebuild:     func(db *gorm.DB) error { return playerCache.LoadToday(db) },
+	},
+	{
+		name:        "online",
+		description: "各区服当前在线人数",
+		size:        func() int { return onlineNumCache.GetCacheSize() },
+		memory:      func() int64 { return onlineNumCache.MemoryUsage() },
+		clear:       func() { onlineNumCache.ClearCache() },
+		rebuild:     func(db *gorm.DB) error { return onlineNumCache.LoadToday(db) },
+	},
+	{
+		name:        "pay_rank",
+		description: "当前业务日充值排行榜",
+		size:        func() int { return payRankCache.GetCacheSize() },
+		memory:      func() int64 { return payRankCache.MemoryUsage() },
+		clear:       func() { payRankCache.ClearCache() },
+		rebuild:     func(db *gorm.DB) error { return payRankCache.LoadTodayPayData(db) },
+	},
+	{
+		name:        "users",
+		description: "登录用户缓存",
+		size:        func() int { return userManager.CachedUserCount() },
+		memory:      func() int64 { return userManager.MemoryUsage() },
+		rebuild: func(db *gorm.DB) error {
+			userManager.LoadUsersToCache()
+			return nil
+		},
+	},
+	{
+		name:        "ldap_binds",
+		description: "LDAP登录成功缓存（有效期内不再访问LDAP服务器）",
+		size:        func() int { return ldapAuthenticator.GetCacheSize() },
+		memory:      func() int64 { return ldapAuthenticator.MemoryUsage() },
+		clear:       func() { ldapAuthenticator.ClearCache() },
+		// 登录缓存在用户下次登录时重新写入，重建即清空
+		rebuild: func(db *gorm.DB) error {
+			ldapAuthenticator.ClearCache()
+			return nil
+		},
+	},
+}
+
+// findManagedCache 按名称查找缓存
+func findManagedCache(name string) (*managedCache, error) {
+	for i := range managedCaches {
+		if managedCaches[i].name == name {
+			return &managedCaches[i], nil
+		}
+	}
+	return nil, fmt.Errorf("未知的缓存 '%s'", name)
+}
+
+// stats 获取缓存状态
+func (m *managedCache) stats() CacheStats {
+	return CacheStats{
+		Name:        m.name,
+		Description: m.description,
+		Entries:     m.size(),
+		ApproxBytes: m.memory(),
+		Clearable:   m.clear != nil,
+	}
+}
+
+// allCacheStats 获取全部缓存状态
+func allCacheStats() []CacheStats {
+	stats := make([]CacheStats, 0, len(managedCaches))
+	for i := range managedCaches {
+		stats = append(stats, managedCaches[i].stats())
+	}
+	return stats
+}
+
+// CachedUserCount 用户缓存中的用户数（含已停用用户，与 MemoryUsage 统计范围一致）
+func (um *UserManager) CachedUserCount() int {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+	return len(um.cache)
+}
+
+// MemoryUsage 估算用户缓存占用的内存（字节）
+func (um *UserManager) MemoryUsage() int64 {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+
+	var total int64
+	for key, user := range um.cache {
+		total += mapEntryOverhead + int64(len(key)) + int64(unsafe.Sizeof(*user)) +
+			int64(len(user.Username)+len(user.Password)+len(user.DisplayName)+len(user.AllowedServers)+len(user.RecoveryCodes)+
+				len(user.TOTPSecret)+len(user.AuthSource)+len(user.ExternalID))
+	}
+	return total
+}
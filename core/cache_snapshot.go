@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultCacheSnapshotPath 缓存快照文件默认路径
+const DefaultCacheSnapshotPath = "../data/cache_snapshot.json"
+
+// cacheSnapshot 停止服务时保存的内存缓存
+// 启动时如果仍在同一业务日则恢复，避免重启后玩家去重缓存和在线人数为空
+type cacheSnapshot struct {
+	DateInt int                 `json:"date_int"`
+	SavedAt time.Time           `json:"saved_at"`
+	Online  map[int]int         `json:"online"`
+	Players map[string]*Player  `json:"players"`
+	PayRank map[string]*PayInfo `json:"pay_rank"`
+}
+
+// SaveCacheSnapshot 将玩家、在线人数和充值排行榜缓存写入快照文件
+// 在HTTP服务停止后调用，此时上报接口不再修改缓存
+func SaveCacheSnapshot(path string) error {
+	snapshot := cacheSnapshot{
+		DateInt: GetCurrentDateInt(),
+		SavedAt: time.Now(),
+		Online:  onlineNumCache.GetAllOnlineNums(),
+		Players: playerCache.GetAllPlayers(),
+		PayRank: make(map[string]*PayInfo),
+	}
+	for _, info := range payRankCache.GetRank() {
+		snapshot.PayRank[info.RoleID] = info
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("序列化缓存快照失败: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建缓存快照目录失败: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("写入缓存快照失败: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("写入缓存快照失败: %v", err)
+	}
+
+	appLogger.Info(fmt.Sprintf("缓存快照已保存: %s, 玩家: %d, 在线区服: %d, 充值排行: %d",
+		path, len(snapshot.Players), len(snapshot.Online), len(snapshot.PayRank)))
+	return nil
+}
+
+// RestoreCacheSnapshot 从快照文件恢复缓存，快照不是当前业务日的则忽略
+// 快照只使用一次，读取后删除，避免异常退出后再次启动时恢复过期的数据
+func RestoreCacheSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取缓存快照失败: %v", err)
+	}
+	if err := os.Remove(path); err != nil {
+		appLogger.Warning(fmt.Sprintf("删除缓存快照失败: %v", err))
+	}
+
+	var snapshot cacheSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("解析缓存快照失败: %v", err)
+	}
+	if snapshot.DateInt != GetCurrentDateInt() {
+		appLogger.Info(fmt.Sprintf("缓存快照属于业务日 %d，已忽略", snapshot.DateInt))
+		return nil
+	}
+
+	if snapshot.Online == nil {
+		snapshot.Online = make(map[int]int)
+	}
+	if snapshot.Players == nil {
+		snapshot.Players = make(map[string]*Player)
+	}
+	if snapshot.PayRank == nil {
+		snapshot.PayRank = make(map[string]*PayInfo)
+	}
+
+	onlineNumCache.mu.Lock()
+	onlineNumCache.cache = snapshot.Online
+	onlineNumCache.mu.Unlock()
+
+	playerCache.mu.Lock()
+	playerCache.cache = snapshot.Players
+	playerCache.mu.Unlock()
+
+	payRankCache.mu.Lock()
+	payRankCache.cache = snapshot.PayRank
+	payRankCache.mu.Unlock()
+
+	appLogger.Info(fmt.Sprintf("已从缓存快照恢复(保存于 %s): 玩家: %d, 在线区服: %d, 充值排行: %d",
+		snapshot.SavedAt.Format("2006-01-02 15:04:05"), len(snapshot.Players), len(snapshot.Online), len(snapshot.PayRank)))
+	return nil
+}
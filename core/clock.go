@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // 内嵌时区数据库，避免部署环境缺少zoneinfo
+)
+
+// BusinessClock 业务时钟：统一的业务时区与每日切换时间
+// 所有日期分桶(date_int)、每日缓存重置和图表时间轴都以它为准
+type BusinessClock struct {
+	mu       sync.RWMutex
+	loc      *time.Location
+	dayStart time.Duration // 业务日相对0点的偏移，例如5小时表示每天05:00切换
+}
+
+// 全局业务时钟实例（默认使用服务器本地时区、0点切换）
+var businessClock = &BusinessClock{
+	loc: time.Local,
+}
+
+// dbLocation 数据库DATETIME字段对应的时区（与DSN中的loc参数保持一致）
+var dbLocation = time.Local
+
+// Configure 根据配置设置业务时区和每日切换时间
+// timezone 为IANA时区名（如 Asia/Shanghai），为空时使用服务器本地时区
+// dayStart 为 HH:MM 格式（如 05:00），为空时为 00:00
+func (bc *BusinessClock) Configure(timezone, dayStart string) error {
+	loc := time.Local
+	if timezone != "" {
+		l, err := time.LoadLocation(timezone)
+		if err != nil {
+			return fmt.Errorf("无效的业务时区 '%s': %v", timezone, err)
+		}
+		loc = l
+	}
+
+	offset, err := parseDayStart(dayStart)
+	if err != nil {
+		return err
+	}
+
+	bc.mu.Lock()
+	bc.loc = loc
+	bc.dayStart = offset
+	bc.mu.Unlock()
+	return nil
+}
+
+// parseDayStart 解析 HH:MM 格式的每日切换时间
+func parseDayStart(dayStart string) (time.Duration, error) {
+	dayStart = strings.TrimSpace(dayStart)
+	if dayStart == "" {
+		return 0, nil
+	}
+
+	t, err := time.Parse("15:04", dayStart)
+	if err != nil {
+		return 0, fmt.Errorf("无效的每日切换时间 '%s'，格式应为 HH:MM", dayStart)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Location 获取业务时区
+func (bc *BusinessClock) Location() *time.Location {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.loc
+}
+
+// DayStart 获取每日切换时间偏移
+func (bc *BusinessClock) DayStart() time.Duration {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.dayStart
+}
+
+// Now 获取业务时区下的当前时间
+func (bc *BusinessClock) Now() time.Time {
+	return time.Now().In(bc.Location())
+}
+
+// DateOf 计算给定时间所属的业务日期 (YYYYMMDD)
+func (bc *BusinessClock) DateOf(t time.Time) int {
+	bc.mu.RLock()
+	loc, dayStart := bc.loc, bc.dayStart
+	bc.mu.RUnlock()
+
+	d := t.In(loc).Add(-dayStart)
+	return d.Year()*10000 + int(d.Month())*100 + d.Day()
+}
+
+// DayStartTime 获取业务日期的起始时间（业务时区下该日期的切换时刻）
+func (bc *BusinessClock) DayStartTime(dateInt int) (time.Time, error) {
+	t, err := DateIntToTime(dateInt)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	bc.mu.RLock()
+	loc, dayStart := bc.loc, bc.dayStart
+	bc.mu.RUnlock()
+
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc).Add(dayStart), nil
+}
+
+// DayBoundarySpec 生成在每日切换时间之后 delay 执行的cron表达式
+func (bc *BusinessClock) DayBoundarySpec(delay time.Duration) string {
+	at := (bc.DayStart() + delay) % (24 * time.Hour)
+	return fmt.Sprintf("%d %d * * *", int(at.Minutes())%60, int(at.Hours()))
+}
+
+// HourlySpec 生成每小时执行的cron表达式，分钟数与每日切换时间对齐后再延后 delay
+func (bc *BusinessClock) HourlySpec(delay time.Duration) string {
+	at := bc.DayStart() + delay
+	return fmt.Sprintf("%d * * * *", int(at.Minutes())%60)
+}
+
+// UTCOffsetMinutes 获取业务时区当前相对UTC的偏移（分钟）
+func (bc *BusinessClock) UTCOffsetMinutes() int {
+	_, offset := bc.Now().Zone()
+	return offset / 60
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+	"gorm.io/gorm"
+)
+
+// 默认路径（相对于 run 目录），可通过命令行参数或环境变量修改
+const (
+	DefaultConfigPath  = "../config/.config.yaml"
+	DefaultLogDir      = "../log"
+	DefaultTemplateDir = "../templates"
+)
+
+// ConfigEnvPrefix 配置项环境变量前缀，如 database.mysql.password 对应 LOGSVR_DATABASE_MYSQL_PASSWORD
+const ConfigEnvPrefix = "LOGSVR"
+
+// MySQLConfig MySQL连接配置
+type MySQLConfig struct {
+	Host            string `yaml:"host"`
+	Port            int    `yaml:"port"`
+	User            string `yaml:"user"`
+	Password        string `yaml:"password"`
+	Dbname          string `yaml:"dbname"`
+	Charset         string `yaml:"charset"`         // 默认 utf8mb4
+	ParseTime       *bool  `yaml:"parseTime"`       // 默认 true（时间字段依赖该选项解析）
+	Loc             string `yaml:"loc"`             // 时间字段的时区，默认 Local
+	MaxOpenConns    int    `yaml:"maxOpenConns"`    // 最大连接数，0 表示不限制
+	MaxIdleConns    int    `yaml:"maxIdleConns"`    // 最大空闲连接数，默认 2
+	ConnMaxLifetime string `yaml:"connMaxLifetime"` // 连接最长复用时间，如 300s，为空表示不限制
+}
+
+// DatabaseConfig 数据库配置
+type DatabaseConfig struct {
+	Mysql          MySQLConfig `yaml:"mysql"`
+	MigrateOnStart *bool       `yaml:"migrateOnStart"` // 启动时自动执行未执行的迁移，默认 true
+}
+
+// ServerConfig HTTP服务配置
+type ServerConfig struct {
+	Port            int    `yaml:"port"`
+	Mode            string `yaml:"mode"`            // gin 运行模式: debug、release、test，默认 debug
+	ShutdownTimeout string `yaml:"shutdownTimeout"` // 停止服务时等待处理中的请求和定时任务结束的最长时间，默认 30s
+	CacheSnapshot   string `yaml:"cacheSnapshot"`   // 停止服务时保存内存缓存的快照文件，默认 ../data/cache_snapshot.json
+}
+
+// ShutdownWait 停止服务的等待时长（shutdownTimeout 已在加载配置时校验）
+func (s *ServerConfig) ShutdownWait() time.Duration {
+	d, err := time.ParseDuration(s.ShutdownTimeout)
+	if err != nil {
+		return 30 * time.Second
+	}
+	return d
+}
+
+// 配置文件结构
+type Config struct {
+	Database DatabaseConfig `yaml:"database"`
+	Server   ServerConfig   `yaml:"server"`
+	Log      LogConfig      `yaml:"log"`
+	Business struct {
+		Timezone string `yaml:"timezone"` // 业务时区，如 Asia/Shanghai，为空时使用服务器本地时区
+		DayStart string `yaml:"dayStart"` // 每日切换时间，如 05:00，为空时为 00:00
+	} `yaml:"business"`
+	Ingest struct {
+		MaxFutureSkew string   `yaml:"maxFutureSkew"` // event_time 允许超前的最大时长，默认 5m
+		MaxPastSkew   string   `yaml:"maxPastSkew"`   // event_time 允许落后的最大时长，默认 72h
+		Secrets       []string `yaml:"secrets"`       // 上报密钥（请求头 X-Ingest-Secret），为空时不校验，可配置多个用于轮换
+	} `yaml:"ingest"`
+	Rollup struct {
+		BackfillDays int `yaml:"backfillDays"` // 每日汇总任务回补的天数，默认 7
+	} `yaml:"rollup"`
+	Retention RetentionConfig      `yaml:"retention"`
+	Session   SessionConfig        `yaml:"session"`
+	Login     LoginGuardConfig     `yaml:"login"`
+	Password  PasswordPolicyConfig `yaml:"password"`
+	OIDC      OIDCConfig           `yaml:"oidc"`
+	LDAP      LDAPConfig           `yaml:"ldap"`
+	// ServerGroups 区服分组（分组名 -> 区服范围，如 "1-20,35"），用户区服范围中以 @分组名 引用
+	ServerGroups map[string]string `yaml:"serverGroups"`
+}
+
+// templateDir 页面模板目录
+var templateDir = DefaultTemplateDir
+
+// templatePath 获取页面模板文件路径
+func templatePath(name string) string {
+	return filepath.Join(templateDir, name)
+}
+
+// SetTemplateDir 设置页面模板目录（目录中必须有登录页面）
+func SetTemplateDir(dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, "login.html")); err != nil {
+		return fmt.Errorf("模板目录 '%s' 无效: %v", dir, err)
+	}
+	templateDir = dir
+	return nil
+}
+
+// envOrDefault 读取环境变量，未设置时返回默认值
+func envOrDefault(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// LoadConfig 读取配置文件，应用环境变量覆盖并校验
+// 返回被环境变量覆盖的配置项对应的变量名（不含值）
+func LoadConfig(path string) (*Config, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+
+	overridden, err := applyEnvOverrides(reflect.ValueOf(&config).Elem(), ConfigEnvPrefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, nil, err
+	}
+	return &config, overridden, nil
+}
+
+// validate 校验并补全数据库和服务配置的默认值
+func (c *Config) validate() error {
+	mysqlConfig := &c.Database.Mysql
+	if mysqlConfig.Charset == "" {
+		mysqlConfig.Charset = "utf8mb4"
+	}
+	if mysqlConfig.Loc == "" {
+		mysqlConfig.Loc = "Local"
+	}
+	if _, err := time.LoadLocation(mysqlConfig.Loc); err != nil {
+		return fmt.Errorf("无效的数据库时区 loc '%s'", mysqlConfig.Loc)
+	}
+	if mysqlConfig.MaxOpenConns < 0 || mysqlConfig.MaxIdleConns < 0 {
+		return fmt.Errorf("maxOpenConns 和 maxIdleConns 不能为负数")
+	}
+	if mysqlConfig.ConnMaxLifetime != "" {
+		if d, err := time.ParseDuration(mysqlConfig.ConnMaxLifetime); err != nil || d < 0 {
+			return fmt.Errorf("无效的 connMaxLifetime '%s'", mysqlConfig.ConnMaxLifetime)
+		}
+	}
+
+	switch c.Server.Mode {
+	case "", gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+	default:
+		return fmt.Errorf("无效的 server.mode '%s'，应为 debug、release 或 test", c.Server.Mode)
+	}
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		return fmt.Errorf("无效的 server.port %d", c.Server.Port)
+	}
+	if c.Server.ShutdownTimeout == "" {
+		c.Server.ShutdownTimeout = "30s"
+	}
+	if d, err := time.ParseDuration(c.Server.ShutdownTimeout); err != nil || d <= 0 {
+		return fmt.Errorf("无效的 server.shutdownTimeout '%s'", c.Server.ShutdownTimeout)
+	}
+	if c.Server.CacheSnapshot == "" {
+		c.Server.CacheSnapshot = DefaultCacheSnapshotPath
+	}
+	return nil
+}
+
+// DSN 生成MySQL连接字符串
+func (m *MySQLConfig) DSN() string {
+	parseTime := "True"
+	if m.ParseTime != nil && !*m.ParseTime {
+		parseTime = "False"
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=%s&loc=%s",
+		m.User, m.Password, m.Host, m.Port, m.Dbname,
+		url.QueryEscape(m.Charset), parseTime, url.QueryEscape(m.Loc))
+}
+
+// Location 数据库时间字段的时区（loc 已在加载配置时校验）
+func (m *MySQLConfig) Location() *time.Location {
+	loc, err := time.LoadLocation(m.Loc)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// ConfigurePool 按配置设置数据库连接池
+func (m *MySQLConfig) ConfigurePool(database *gorm.DB) error {
+	sqlDB, err := database.DB()
+	if err != nil {
+		return err
+	}
+
+	sqlDB.SetMaxOpenConns(m.MaxOpenConns)
+	if m.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(m.MaxIdleConns)
+	}
+	var lifetime time.Duration
+	if m.ConnMaxLifetime != "" {
+		lifetime, _ = time.ParseDuration(m.ConnMaxLifetime)
+		sqlDB.SetConnMaxLifetime(lifetime)
+	}
+
+	appLogger.Info(fmt.Sprintf("数据库连接池: maxOpenConns=%d, maxIdleConns=%d, connMaxLifetime=%v",
+		m.MaxOpenConns, m.MaxIdleConns, lifetime))
+	return nil
+}
+
+// configEnvName 将 yaml 键名转换为环境变量名片段，如 maxOpenConns -> MAX_OPEN_CONNS
+func configEnvName(key string) string {
+	var b strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// applyEnvOverrides 用环境变量覆盖配置项（字符串、整数、布尔及字符串列表，列表以逗号分隔）
+// 变量名为前缀加 yaml 路径，如 LOGSVR_DATABASE_MYSQL_PASSWORD、LOGSVR_SERVER_PORT
+func applyEnvOverrides(v reflect.Value, prefix string) ([]string, error) {
+	var overridden []string
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" || field.PkgPath != "" {
+			continue
+		}
+		name := prefix + "_" + configEnvName(key)
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Struct {
+			names, err := applyEnvOverrides(fv, name)
+			if err != nil {
+				return nil, err
+			}
+			overridden = append(overridden, names...)
+			continue
+		}
+
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setConfigValue(fv, raw); err != nil {
+			return nil, fmt.Errorf("环境变量 %s 的值无效: %v", name, err)
+		}
+		overridden = append(overridden, name)
+	}
+	return overridden, nil
+}
+
+// setConfigValue 将环境变量的值写入配置字段
+func setConfigValue(fv reflect.Value, raw string) error {
+	if fv.Kind() == reflect.Ptr {
+		value := reflect.New(fv.Type().Elem())
+		if err := setConfigValue(value.Elem(), raw); err != nil {
+			return err
+		}
+		fv.Set(value)
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return fmt.Errorf("应为整数")
+		}
+		fv.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("应为 true 或 false")
+		}
+		fv.SetBool(b)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("不支持的配置类型 %s", fv.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		fv.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("不支持通过环境变量设置 %s 类型的配置", fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reloadableSections 可热加载的配置节，其他配置修改后需重启生效
+var reloadableSections = map[string]bool{
+	"log":          true,
+	"business":     true,
+	"ingest":       true,
+	"serverGroups": true,
+	"login":        true,
+	"password":     true,
+}
+
+// 配置重新加载的触发方式
+const (
+	ReloadTriggerFile   = "file"   // 配置文件变化
+	ReloadTriggerSignal = "signal" // 收到 SIGHUP
+	ReloadTriggerAPI    = "api"    // 管理员手动触发
+)
+
+const (
+	configWatchInterval     = 5 * time.Second // 检查配置文件变化的间隔
+	configReloadHistorySize = 20              // 保留的重新加载记录数
+)
+
+// ConfigReloadRecord 一次配置重新加载的记录（只记录配置项名称，不记录值）
+type ConfigReloadRecord struct {
+	Time            time.Time `json:"time"`
+	Trigger         string    `json:"trigger"`
+	Operator        string    `json:"operator"`
+	Success         bool      `json:"success"`
+	Error           string    `json:"error,omitempty"`
+	Changed         []string  `json:"changed"`          // 已生效的配置项
+	RestartRequired []string  `json:"restart_required"` // 已修改但需重启生效的配置项
+}
+
+// ConfigReloader 配置热加载：监听配置文件变化和 SIGHUP 信号
+type ConfigReloader struct {
+	mu       sync.Mutex
+	path     string
+	current  *Config // 当前生效的配置（不可热加载的配置节保持启动时的值）
+	loadedAt time.Time
+	history  []ConfigReloadRecord
+}
+
+// 全局配置热加载实例
+var configReloader *ConfigReloader
+
+// InitConfigReloader 初始化配置热加载并开始监听
+func InitConfigReloader(path string, config *Config) {
+	configReloader = &ConfigReloader{
+		path:     path,
+		current:  config,
+		loadedAt: time.Now(),
+	}
+	go configReloader.watch()
+	appLogger.Info(fmt.Sprintf("配置热加载已启用: %s（每 %v 检查文件变化，或发送 SIGHUP 信号）", path, configWatchInterval))
+}
+
+// reloadableState 按新配置构建好的可热加载配置（临时实例），由 applyReloadableConfig 一次切换
+type reloadableState struct {
+	logLevel int
+	clock    *BusinessClock
+	jobs     *jobSchedulePlan
+	ingest   *IngestPolicy
+	groups   *serverGroupRegistry
+	guard    *LoginGuard
+	password *PasswordPolicy
+}
+
+// buildReloadableConfig 在临时实例上校验并构建可热加载的配置，不影响当前运行的配置
+func buildReloadableConfig(config *Config) (*reloadableState, error) {
+	level, err := parseLogLevel(config.Log.Level)
+	if err != nil {
+		return nil, fmt.Errorf("日志配置错误: %v", err)
+	}
+	state := &reloadableState{
+		logLevel: logLevels[level],
+		clock:    &BusinessClock{},
+		ingest:   &IngestPolicy{},
+		groups:   &serverGroupRegistry{},
+		guard:    newLoginGuard(),
+		password: &PasswordPolicy{},
+	}
+	if err := state.clock.Configure(config.Business.Timezone, config.Business.DayStart); err != nil {
+		return nil, fmt.Errorf("业务时区配置错误: %v", err)
+	}
+	if state.jobs, err = planRetime(state.clock.Location(), businessJobSpecs(state.clock)); err != nil {
+		return nil, fmt.Errorf("业务时区配置错误: %v", err)
+	}
+	if err := state.ingest.Configure(config.Ingest.MaxFutureSkew, config.Ingest.MaxPastSkew, config.Ingest.Secrets); err != nil {
+		return nil, fmt.Errorf("上报策略配置错误: %v", err)
+	}
+	if err := state.groups.Configure(config.ServerGroups); err != nil {
+		return nil, fmt.Errorf("区服分组配置错误: %v", err)
+	}
+	if err := state.guard.Configure(config.Login); err != nil {
+		return nil, fmt.Errorf("登录防护配置错误: %v", err)
+	}
+	if err := state.password.Configure(config.Password); err != nil {
+		return nil, fmt.Errorf("密码策略配置错误: %v", err)
+	}
+	return state, nil
+}
+
+// configApplyMu 保证同一时间只有一次配置应用（启动初始化、文件变化、SIGHUP、管理接口）
+var configApplyMu sync.Mutex
+
+// applyReloadableConfig 应用可热加载的配置
+// 先按新配置构建全部配置节，再同时持有各配置节的锁一次切换：任何请求读到的要么全是旧配置、要么全是新配置，
+// 任何一项有误时保持当前配置不变
+//
+// 加锁顺序与已有的嵌套加锁一致，避免死锁：
+// 上报策略 → 区服分组 → 密码策略 → 登录防护 → 调度器 → 日志 → 业务时钟
+// （登录防护和调度器加锁时会写日志，日志轮转加锁时会读取业务时钟），持有期间不能写日志
+func applyReloadableConfig(config *Config) error {
+	configApplyMu.Lock()
+	defer configApplyMu.Unlock()
+
+	state, err := buildReloadableConfig(config)
+	if err != nil {
+		return err
+	}
+
+	ingestPolicy.mu.Lock()
+	serverGroups.mu.Lock()
+	passwordPolicy.mu.Lock()
+	loginGuard.mu.Lock()
+	jobScheduler.mu.Lock()
+
+	changes, err := jobScheduler.retimeLocked(state.jobs)
+	if err == nil {
+		appLogger.mu.Lock()
+		businessClock.mu.Lock()
+
+		appLogger.minLevel = state.logLevel
+		businessClock.loc, businessClock.dayStart = state.clock.loc, state.clock.dayStart
+		ingestPolicy.maxFutureSkew, ingestPolicy.maxPastSkew, ingestPolicy.secrets = state.ingest.maxFutureSkew, state.ingest.maxPastSkew, state.ingest.secrets
+		serverGroups.groups = state.groups.groups
+		passwordPolicy.minLength, passwordPolicy.minClasses, passwordPolicy.historySize = state.password.minLength, state.password.minClasses, state.password.historySize
+		passwordPolicy.bootstrapPassword = state.password.bootstrapPassword
+		loginGuard.maxAttempts, loginGuard.ipMaxAttempts = state.guard.maxAttempts, state.guard.ipMaxAttempts
+		loginGuard.lockout, loginGuard.baseDelay, loginGuard.maxDelay, loginGuard.window = state.guard.lockout, state.guard.baseDelay, state.guard.maxDelay, state.guard.window
+
+		businessClock.mu.Unlock()
+		appLogger.mu.Unlock()
+	}
+
+	jobScheduler.mu.Unlock()
+	loginGuard.mu.Unlock()
+	passwordPolicy.mu.Unlock()
+	serverGroups.mu.Unlock()
+	ingestPolicy.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		appLogger.Info(change)
+	}
+	return nil
+}
+
+// watch 监听 SIGHUP 信号和配置文件变化
+// 文件变化后等待一个检查周期且不再变化时才重新加载，避免读到编辑器写了一半的文件
+func (r *ConfigReloader) watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	seen := configFileModTime(r.path)
+	pending := false
+	for {
+		select {
+		case <-hup:
+			appLogger.Info("收到 SIGHUP 信号，重新加载配置")
+			r.Reload(ReloadTriggerSignal, "", "")
+		case <-ticker.C:
+			modTime := configFileModTime(r.path)
+			if !modTime.Equal(seen) {
+				seen = modTime
+				pending = true
+				continue
+			}
+			if pending {
+				pending = false
+				appLogger.Info(fmt.Sprintf("配置文件 %s 已修改，重新加载配置", r.path))
+				r.Reload(ReloadTriggerFile, "", "")
+			}
+		}
+	}
+}
+
+// configFileModTime 获取配置文件修改时间，文件不存在时返回零值
+func configFileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Reload 重新读取配置文件并应用可热加载的配置
+// operator 和 ip 为手动触发的管理员信息，文件变化和信号触发时为空
+func (r *ConfigReloader) Reload(trigger, operator, ip string) ConfigReloadRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record := ConfigReloadRecord{
+		Time:            time.Now(),
+		Trigger:         trigger,
+		Operator:        operator,
+		Changed:         []string{},
+		RestartRequired: []string{},
+	}
+
+	config, _, err := LoadConfig(r.path)
+	if err == nil {
+		err = applyReloadableConfig(config)
+	}
+	if err != nil {
+		record.Error = err.Error()
+		appLogger.Error(fmt.Sprintf("重新加载配置失败，继续使用当前配置: %v", err))
+	} else {
+		record.Success = true
+		for _, key := range diffConfig(r.current, config) {
+			if reloadableSections[strings.SplitN(key, ".", 2)[0]] {
+				record.Changed = append(record.Changed, key)
+			} else {
+				record.RestartRequired = append(record.RestartRequired, key)
+			}
+		}
+
+		// 只替换可热加载的配置节
+		effective := *r.current
+		effective.Log = config.Log
+		effective.Business = config.Business
+		effective.Ingest = config.Ingest
+		effective.ServerGroups = config.ServerGroups
+		effective.Login = config.Login
+		effective.Password = config.Password
+		r.current = &effective
+		r.loadedAt = record.Time
+
+		appLogger.Info(fmt.Sprintf("配置重新加载完成: 已生效 %v, 需重启生效 %v", record.Changed, record.RestartRequired))
+	}
+
+	r.history = append(r.history, record)
+	if len(r.history) > configReloadHistorySize {
+		r.history = r.history[len(r.history)-configReloadHistorySize:]
+	}
+
+	actor := operator
+	if actor == "" {
+		actor = "system"
+	}
+	writeAudit(actor, ip, AuditConfigReload, r.path, nil, gin.H{
+		"trigger":          record.Trigger,
+		"success":          record.Success,
+		"error":            record.Error,
+		"changed":          record.Changed,
+		"restart_required": record.RestartRequired,
+	})
+	return record
+}
+
+// View 当前生效的配置（敏感项已隐藏）和重新加载记录（最近的在前）
+func (r *ConfigReloader) View() gin.H {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	history := make([]ConfigReloadRecord, 0, len(r.history))
+	for i := len(r.history) - 1; i >= 0; i-- {
+		history = append(history, r.history[i])
+	}
+
+	sections := make([]string, 0, len(reloadableSections))
+	for name := range reloadableSections {
+		sections = append(sections, name)
+	}
+	sort.Strings(sections)
+
+	return gin.H{
+		"path":       r.path,
+		"loaded_at":  r.loadedAt,
+		"config":     configTree(reflect.ValueOf(r.current).Elem(), true),
+		"reloadable": sections,
+		"history":    history,
+	}
+}
+
+// isSecretConfigKey 判断配置项是否为敏感信息（密码、密钥）
+func isSecretConfigKey(key string) bool {
+	key = strings.ToLower(key)
+	return strings.Contains(key, "password") || strings.Contains(key, "secret")
+}
+
+// configTree 将配置转换为以 yaml 键名组织的树，redact 为 true 时隐藏敏感项的值
+func configTree(v reflect.Value, redact bool) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return configTree(v.Elem(), redact)
+	case reflect.Struct:
+		tree := make(map[string]interface{})
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if key == "" || key == "-" || field.PkgPath != "" {
+				continue
+			}
+			if redact && isSecretConfigKey(key) && v.Field(i).Kind() != reflect.Struct {
+				tree[key] = redactConfigValue(v.Field(i))
+				continue
+			}
+			tree[key] = configTree(v.Field(i), redact)
+		}
+		return tree
+	case reflect.Map:
+		tree := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			tree[fmt.Sprint(iter.Key().Interface())] = configTree(iter.Value(), redact)
+		}
+		return tree
+	case reflect.Slice:
+		if v.IsNil() {
+			return []interface{}{}
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = configTree(v.Index(i), redact)
+		}
+		return items
+	}
+	return v.Interface()
+}
+
+// redactConfigValue 隐藏敏感配置项的值，只显示是否已设置
+func redactConfigValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.String:
+		if v.Len() == 0 {
+			return ""
+		}
+		return "******"
+	case reflect.Slice:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = "******"
+		}
+		return items
+	}
+	return "******"
+}
+
+// flattenConfigTree 将配置树展开为 "节.键" -> 值 的形式
+func flattenConfigTree(prefix string, node interface{}, out map[string]string) {
+	if tree, ok := node.(map[string]interface{}); ok {
+		for key, child := range tree {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			flattenConfigTree(name, child, out)
+		}
+		return
+	}
+	out[prefix] = fmt.Sprint(node)
+}
+
+// diffConfig 比较两份配置，返回有变化的配置项名称（按名称排序）
+func diffConfig(before, after *Config) []string {
+	oldValues := make(map[string]string)
+	newValues := make(map[string]string)
+	flattenConfigTree("", configTree(reflect.ValueOf(before).Elem(), false), oldValues)
+	flattenConfigTree("", configTree(reflect.ValueOf(after).Elem(), false), newValues)
+
+	var changed []string
+	for key, value := range newValues {
+		if old, ok := oldValues[key]; !ok || old != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range oldValues {
+		if _, ok := newValues[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyReloadableConfigIsAllOrNothing(t *testing.T) {
+	t.Cleanup(func() { applyReloadableConfig(&Config{}) })
+
+	valid := &Config{}
+	valid.Log.Level = "warning"
+	valid.Business.Timezone = "Asia/Shanghai"
+	valid.Business.DayStart = "05:00"
+	valid.Ingest.MaxFutureSkew = "1m"
+	valid.ServerGroups = map[string]string{"publisherA": "1-20"}
+	valid.Password.MinLength = 12
+	if err := applyReloadableConfig(valid); err != nil {
+		t.Fatalf("应用配置失败: %v", err)
+	}
+
+	// 最后一个配置节有误时，前面的配置节也不能生效
+	invalid := &Config{}
+	invalid.Log.Level = "debug"
+	invalid.Business.Timezone = "UTC"
+	invalid.Ingest.MaxFutureSkew = "10m"
+	invalid.Password.MinClasses = 9
+	if err := applyReloadableConfig(invalid); err == nil {
+		t.Fatalf("期望配置校验失败")
+	}
+
+	if appLogger.Level() != "WARNING" {
+		t.Fatalf("日志级别被部分修改: %s", appLogger.Level())
+	}
+	if businessClock.Location().String() != "Asia/Shanghai" || businessClock.DayStart() != 5*time.Hour {
+		t.Fatalf("业务时区被部分修改: %s %v", businessClock.Location(), businessClock.DayStart())
+	}
+	ingestPolicy.mu.RLock()
+	futureSkew := ingestPolicy.maxFutureSkew
+	ingestPolicy.mu.RUnlock()
+	if futureSkew != time.Minute {
+		t.Fatalf("上报策略被部分修改: %v", futureSkew)
+	}
+	if names := serverGroups.Names(); len(names) != 1 || names[0] != "publisherA" {
+		t.Fatalf("区服分组被部分修改: %v", names)
+	}
+	if err := passwordPolicy.Validate("alice", "Abcdefgh123"); err == nil {
+		t.Fatalf("密码策略被部分修改")
+	}
+}
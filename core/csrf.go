@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CSRF令牌：由会话令牌派生（HMAC），写入可被页面脚本读取的Cookie，
+// 修改数据的请求需在 X-CSRF-Token 请求头中带回，第三方页面无法读取该Cookie
+const (
+	CSRFCookieName = "logsvr_csrf"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// Cookie Secure 模式
+const (
+	CookieSecureAuto   = "auto"
+	CookieSecureAlways = "true"
+	CookieSecureNever  = "false"
+)
+
+// parseCookieOptions 解析会话Cookie的 Secure 和 SameSite 配置
+func parseCookieOptions(secure, sameSite string) (string, http.SameSite, error) {
+	secure = strings.ToLower(secure)
+	switch secure {
+	case "":
+		secure = CookieSecureAuto
+	case CookieSecureAuto, CookieSecureAlways, CookieSecureNever:
+	default:
+		return "", 0, fmt.Errorf("无效的 cookieSecure '%s'，应为 auto、true 或 false", secure)
+	}
+
+	var mode http.SameSite
+	switch strings.ToLower(sameSite) {
+	case "", "lax":
+		mode = http.SameSiteLaxMode
+	case "strict":
+		mode = http.SameSiteStrictMode
+	case "none":
+		if secure != CookieSecureAlways {
+			return "", 0, fmt.Errorf("cookieSameSite 为 none 时 cookieSecure 必须为 true")
+		}
+		mode = http.SameSiteNoneMode
+	default:
+		return "", 0, fmt.Errorf("无效的 cookieSameSite '%s'，应为 lax、strict 或 none", sameSite)
+	}
+	return secure, mode, nil
+}
+
+// sameSiteName SameSite 属性的配置名称，用于日志
+func sameSiteName(mode http.SameSite) string {
+	switch mode {
+	case http.SameSiteStrictMode:
+		return "strict"
+	case http.SameSiteNoneMode:
+		return "none"
+	}
+	return "lax"
+}
+
+// secureCookie 判断本次请求写入的Cookie是否设置 Secure
+func (sm *SessionManager) secureCookie(c *gin.Context) bool {
+	switch sm.cookieSecure {
+	case CookieSecureAlways:
+		return true
+	case CookieSecureNever:
+		return false
+	}
+	return c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+}
+
+// setCookie 按会话Cookie配置写入Cookie
+func (sm *SessionManager) setCookie(c *gin.Context, name, value, path string, maxAge int, httpOnly bool) {
+	sameSite := sm.sameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteLaxMode
+	}
+	c.SetSameSite(sameSite)
+	c.SetCookie(name, value, maxAge, path, "", sm.secureCookie(c), httpOnly)
+}
+
+// csrfToken 由会话令牌派生CSRF令牌（会话ID是会话令牌的SHA-256，会在会话列表中返回，因此不能直接使用）
+func csrfToken(sessionToken string) string {
+	mac := hmac.New(sha256.New, []byte(sessionToken))
+	mac.Write([]byte("logsvr-csrf"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validCSRFToken 校验请求头中的CSRF令牌是否与会话匹配
+func validCSRFToken(c *gin.Context, sessionToken string) bool {
+	provided := c.GetHeader(CSRFHeaderName)
+	if provided == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(csrfToken(sessionToken))) == 1
+}
+
+// rejectCSRF 拒绝CSRF校验失败的请求
+func rejectCSRF(c *gin.Context) {
+	appLogger.Warning(fmt.Sprintf("CSRF校验失败: 用户=%s, IP=%s, 请求=%s %s, Origin=%s",
+		c.GetString("user"), c.ClientIP(), c.Request.Method, c.Request.URL.Path, c.GetHeader("Origin")))
+	c.JSON(http.StatusForbidden, gin.H{
+		"status":  "error",
+		"message": "请求校验失败，请刷新页面后重试",
+		"code":    "csrf_failed",
+	})
+	c.Abort()
+}
+
+// isSafeMethod 不修改数据的请求方法
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// CSRFMiddleware 使用会话Cookie认证的修改类请求必须带回CSRF令牌，需在 AuthMiddleware 之后使用
+// API令牌请求不使用Cookie，不需要校验
+func CSRFMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isToken := c.Get("api_token"); isToken {
+			c.Next()
+			return
+		}
+
+		sessionToken, err := c.Cookie(CookieName)
+		if err != nil || sessionToken == "" {
+			c.Next()
+			return
+		}
+
+		if isSafeMethod(c.Request.Method) {
+			// 升级前创建的会话没有CSRF Cookie，在页面请求时补发
+			expected := csrfToken(sessionToken)
+			if current, err := c.Cookie(CSRFCookieName); err != nil || current != expected {
+				sessionManager.setCookie(c, CSRFCookieName, expected, "/", int(sessionManager.Duration().Seconds()), false)
+			}
+			c.Next()
+			return
+		}
+
+		if !validCSRFToken(c, sessionToken) {
+			rejectCSRF(c)
+			return
+		}
+		c.Next()
+	}
+}
@@ -4,15 +4,16 @@ import (
 	"fmt"
 	"sync"
 	"time"
+	"unsafe"
 
 	"gorm.io/gorm"
 )
 
 // DateToInt 将日期字符串转换为整型 (YYYYMMDD)
+// 日期字符串为空或解析失败时返回当前业务日期
 func DateToInt(dateStr string) int {
 	if dateStr == "" {
-		now := time.Now()
-		return now.Year()*10000 + int(now.Month())*100 + now.Day()
+		return GetCurrentDateInt()
 	}
 
 	if t, err := time.Parse("2006-01-02", dateStr); err == nil {
@@ -20,14 +21,12 @@ func DateToInt(dateStr string) int {
 	}
 
 	// 如果解析失败，返回今天的日期
-	now := time.Now()
-	return now.Year()*10000 + int(now.Month())*100 + now.Day()
+	return GetCurrentDateInt()
 }
 
-// GetCurrentDateInt 获取当前日期的整型表示
+// GetCurrentDateInt 获取当前业务日期的整型表示
 func GetCurrentDateInt() int {
-	now := time.Now()
-	return now.Year()*10000 + int(now.Month())*100 + now.Day()
+	return businessClock.DateOf(time.Now())
 }
 
 // DateIntToTime 安全地将整型日期转换为time.Time，防止JSON序列化错误
@@ -133,6 +132,51 @@ func (c *OnlineNumCache) GetAllOnlineNums() map[int]int {
 	return result
 }
 
+// ClearCache 清空在线人数缓存
+func (c *OnlineNumCache) ClearCache() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache = make(map[int]int)
+}
+
+// GetCacheSize 获取缓存大小
+func (c *OnlineNumCache) GetCacheSize() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.cache)
+}
+
+// MemoryUsage 估算缓存占用的内存（字节）
+func (c *OnlineNumCache) MemoryUsage() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return int64(len(c.cache)) * (mapEntryOverhead + 16)
+}
+
+// LoadToday 从数据库重建当前业务日各区服的最新在线人数
+func (c *OnlineNumCache) LoadToday(db *gorm.DB) error {
+	var rows []OnlineNum
+	if err := db.Raw(`
+		SELECT o.gamesvr_id, o.online_num
+		FROM online_num o
+		JOIN (
+			SELECT gamesvr_id, MAX(id) AS id FROM online_num WHERE date_int = ? GROUP BY gamesvr_id
+		) latest ON latest.id = o.id`, GetCurrentDateInt()).Scan(&rows).Error; err != nil {
+		return fmt.Errorf("从数据库加载在线人数失败: %v", err)
+	}
+
+	cache := make(map[int]int, len(rows))
+	for _, row := range rows {
+		cache[row.GameSvrID] = row.OnlineNum
+	}
+
+	c.mu.Lock()
+	c.cache = cache
+	c.mu.Unlock()
+	appLogger.Info(fmt.Sprintf("在线人数缓存已从数据库重建，共 %d 个区服", len(cache)))
+	return nil
+}
+
 // SetPlayer 设置玩家数据到内存缓存
 func (c *PlayerCache) SetPlayer(player *Player) {
 	c.mu.Lock()
@@ -175,6 +219,37 @@ func (c *PlayerCache) GetCacheSize() int {
 	return len(c.cache)
 }
 
+// MemoryUsage 估算缓存占用的内存（字节）
+func (c *PlayerCache) MemoryUsage() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var total int64
+	for key, player := range c.cache {
+		total += mapEntryOverhead + int64(len(key)) + int64(unsafe.Sizeof(*player)) + int64(len(player.RoleID)+len(player.Name))
+	}
+	return total
+}
+
+// LoadToday 从数据库重建当前业务日的玩家去重缓存（同一玩家保留最新的一条记录）
+func (c *PlayerCache) LoadToday(db *gorm.DB) error {
+	var players []Player
+	if err := db.Where("date_int = ?", GetCurrentDateInt()).Order("id asc").Find(&players).Error; err != nil {
+		return fmt.Errorf("从数据库加载今日玩家失败: %v", err)
+	}
+
+	cache := make(map[string]*Player, len(players))
+	for i := range players {
+		cache[players[i].RoleID] = &players[i]
+	}
+
+	c.mu.Lock()
+	c.cache = cache
+	c.mu.Unlock()
+	appLogger.Info(fmt.Sprintf("玩家缓存已从数据库重建，共 %d 个玩家", len(cache)))
+	return nil
+}
+
 // 设置表名
 func (OnlineNum) TableName() string {
 	return "online_num"
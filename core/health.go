@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 构建信息，由 run/makesvr.sh 通过 -ldflags "-X main.buildCommit=... -X main.buildTime=..." 设置
+var (
+	buildCommit = ""
+	buildTime   = ""
+)
+
+// healthCheckTimeout 就绪检查中数据库 ping 的超时时间
+const healthCheckTimeout = 2 * time.Second
+
+// startTime 进程启动时间
+var startTime = time.Now()
+
+// healthCheck 单项检查结果
+type healthCheck struct {
+	Status  string `json:"status"` // success 或 error
+	Message string `json:"message,omitempty"`
+	Latency string `json:"latency,omitempty"`
+}
+
+// versionInfo 获取构建信息，未通过 ldflags 设置时使用 Go 编译时记录的版本控制信息
+func versionInfo() gin.H {
+	commit, built, modified := buildCommit, buildTime, false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if commit == "" {
+					commit = setting.Value
+				}
+			case "vcs.time":
+				if built == "" {
+					built = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	if built == "" {
+		built = "unknown"
+	}
+
+	return gin.H{
+		"commit":     commit,
+		"build_time": built,
+		"modified":   modified,
+		"go_version": runtime.Version(),
+		"started_at": startTime,
+		"uptime":     time.Since(startTime).Round(time.Second).String(),
+	}
+}
+
+// checkDatabase 检查数据库连接
+func checkDatabase(database *gorm.DB) healthCheck {
+	sqlDB, err := database.DB()
+	if err != nil {
+		return healthCheck{Status: "error", Message: err.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return healthCheck{Status: "error", Message: err.Error(), Latency: time.Since(start).String()}
+	}
+	return healthCheck{Status: "success", Latency: time.Since(start).String()}
+}
+
+// checkCaches 检查启动时的缓存预热（LoadTodayPayData）是否完成
+func checkCaches() healthCheck {
+	loadedAt := payRankCache.LoadedAt()
+	if loadedAt.IsZero() {
+		return healthCheck{Status: "error", Message: "充值排行榜缓存尚未从数据库加载，可通过缓存管理接口重建 pay_rank"}
+	}
+	return healthCheck{Status: "success", Message: "缓存预热完成于 " + loadedAt.Format("2006-01-02 15:04:05")}
+}
+
+// checkLogFile 检查日志文件是否可写
+func checkLogFile() healthCheck {
+	if err := appLogger.CheckWritable(); err != nil {
+		return healthCheck{Status: "error", Message: err.Error()}
+	}
+	return healthCheck{Status: "success", Message: appLogger.FileName()}
+}
+
+// readiness 执行全部就绪检查，全部通过时 ready 为 true
+func readiness(database *gorm.DB) (bool, map[string]healthCheck) {
+	checks := map[string]healthCheck{
+		"database": checkDatabase(database),
+		"caches":   checkCaches(),
+		"log_file": checkLogFile(),
+	}
+	for _, check := range checks {
+		if check.Status != "success" {
+			return false, checks
+		}
+	}
+	return true, checks
+}
+
+// readinessLog 记录上一次就绪检查的结果，只在状态变化时写日志，避免探针频繁请求时刷屏
+var readinessLog struct {
+	mu      sync.Mutex
+	checked bool
+	ready   bool
+	failed  string // 上一次未通过的检查项及原因
+}
+
+// logReadinessChange 就绪状态或未通过的检查项变化时写日志
+func logReadinessChange(ready bool, checks map[string]healthCheck) {
+	failed := ""
+	if !ready {
+		failed = fmt.Sprintf("%+v", failedChecks(checks))
+	}
+
+	readinessLog.mu.Lock()
+	defer readinessLog.mu.Unlock()
+	if readinessLog.checked && readinessLog.ready == ready && readinessLog.failed == failed {
+		return
+	}
+	wasChecked := readinessLog.checked
+	readinessLog.checked, readinessLog.ready, readinessLog.failed = true, ready, failed
+
+	if !ready {
+		appLogger.Warning(fmt.Sprintf("就绪检查未通过: %s", failed))
+	} else if wasChecked {
+		appLogger.Info("就绪检查已恢复通过")
+	}
+}
+
+// failedChecks 未通过的检查项（不含耗时，避免每次探针结果都不同）
+func failedChecks(checks map[string]healthCheck) map[string]string {
+	failed := make(map[string]string)
+	for name, check := range checks {
+		if check.Status != "success" {
+			failed[name] = check.Message
+		}
+	}
+	return failed
+}
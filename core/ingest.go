@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IngestSecretHeader 上报接口携带上报密钥的请求头
+const IngestSecretHeader = "X-Ingest-Secret"
+
+// IngestPolicy 上报数据的事件时间校验策略和上报密钥
+type IngestPolicy struct {
+	mu            sync.RWMutex
+	maxFutureSkew time.Duration // 允许事件时间超前服务器时间的最大值
+	maxPastSkew   time.Duration // 允许事件时间落后服务器时间的最大值（迟到数据）
+	secrets       []string      // 上报密钥，为空时不校验；配置多个便于轮换
+}
+
+// 全局上报策略实例
+var ingestPolicy = &IngestPolicy{
+	maxFutureSkew: 5 * time.Minute,
+	maxPastSkew:   72 * time.Hour,
+}
+
+// Configure 根据配置设置时间偏差限制和上报密钥，空字符串表示使用默认值
+func (p *IngestPolicy) Configure(maxFutureSkew, maxPastSkew string, secrets []string) error {
+	future, past := 5*time.Minute, 72*time.Hour
+
+	if maxFutureSkew != "" {
+		d, err := time.ParseDuration(maxFutureSkew)
+		if err != nil || d < 0 {
+			return fmt.Errorf("无效的 maxFutureSkew '%s'", maxFutureSkew)
+		}
+		future = d
+	}
+	if maxPastSkew != "" {
+		d, err := time.ParseDuration(maxPastSkew)
+		if err != nil || d < 0 {
+			return fmt.Errorf("无效的 maxPastSkew '%s'", maxPastSkew)
+		}
+		past = d
+	}
+
+	var keys []string
+	for _, secret := range secrets {
+		if secret = strings.TrimSpace(secret); secret == "" {
+			continue
+		}
+		if len(secret) < 16 {
+			return fmt.Errorf("上报密钥长度至少为 16 位")
+		}
+		keys = append(keys, secret)
+	}
+
+	p.mu.Lock()
+	p.maxFutureSkew = future
+	p.maxPastSkew = past
+	p.secrets = keys
+	p.mu.Unlock()
+	return nil
+}
+
+// CheckSecret 校验上报密钥，未配置密钥时不校验
+func (p *IngestPolicy) CheckSecret(provided string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.secrets) == 0 {
+		return true
+	}
+	valid := false
+	for _, secret := range p.secrets {
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(secret)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// IngestAuthMiddleware 上报接口校验上报密钥
+func IngestAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ingestPolicy.CheckSecret(c.GetHeader(IngestSecretHeader)) {
+			appLogger.Warning(fmt.Sprintf("上报密钥校验失败: 请求=%s, IP=%s", c.Request.URL.Path, c.ClientIP()))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "上报密钥无效"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ResolveEventTime 解析客户端上报的事件时间
+// eventTime 为Unix时间戳（秒或毫秒），为空时使用服务器接收时间
+// 超前不超过限制的时间按服务器当前时间处理，超出偏差限制的时间返回错误
+func (p *IngestPolicy) ResolveEventTime(eventTime *int64) (time.Time, error) {
+	now := time.Now()
+	if eventTime == nil || *eventTime == 0 {
+		return now, nil
+	}
+
+	var t time.Time
+	if *eventTime > 1e12 {
+		t = time.UnixMilli(*eventTime)
+	} else {
+		t = time.Unix(*eventTime, 0)
+	}
+
+	p.mu.RLock()
+	future, past := p.maxFutureSkew, p.maxPastSkew
+	p.mu.RUnlock()
+
+	if t.After(now) {
+		if t.Sub(now) > future {
+			return time.Time{}, fmt.Errorf("event_time 超前服务器时间 %v，超过允许的 %v", t.Sub(now).Round(time.Second), future)
+		}
+		return now, nil
+	}
+	if now.Sub(t) > past {
+		return time.Time{}, fmt.Errorf("event_time 落后服务器时间 %v，超过允许的 %v", now.Sub(t).Round(time.Second), past)
+	}
+	return t, nil
+}
+
+// LateDataHook 迟到数据回调，参数为受影响的历史业务日期
+type LateDataHook func(dateInt int)
+
+var (
+	lateDataMu    sync.RWMutex
+	lateDataHooks []LateDataHook
+)
+
+// RegisterLateDataHook 注册迟到数据回调，用于失效历史日期的缓存和预计算数据
+func RegisterLateDataHook(hook LateDataHook) {
+	lateDataMu.Lock()
+	defer lateDataMu.Unlock()
+	lateDataHooks = append(lateDataHooks, hook)
+}
+
+// notifyLateData 通知历史日期收到了迟到数据
+func notifyLateData(dateInt int) {
+	lateDataMu.RLock()
+	hooks := lateDataHooks
+	lateDataMu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(dateInt)
+	}
+}
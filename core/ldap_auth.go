@@ -0,0 +1,413 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConfig LDAP 目录认证配置
+type LDAPConfig struct {
+	Enabled              bool              `yaml:"enabled"`
+	URL                  string            `yaml:"url"`                  // 如 ldap://ldap.example.com:389 或 ldaps://ldap.example.com:636
+	StartTLS             bool              `yaml:"startTLS"`             // ldap:// 连接后升级为TLS
+	InsecureSkipVerify   bool              `yaml:"insecureSkipVerify"`   // 不校验服务器证书（仅用于测试环境）
+	BindDN               string            `yaml:"bindDN"`               // 查询用户使用的服务账号，为空时匿名查询
+	BindPassword         string            `yaml:"bindPassword"`         // 服务账号密码
+	BaseDN               string            `yaml:"baseDN"`               // 用户查询的根DN
+	UserFilter           string            `yaml:"userFilter"`           // 用户查询条件，%s 替换为用户名，默认 (uid=%s)
+	UsernameAttribute    string            `yaml:"usernameAttribute"`    // 用户名属性，默认 uid
+	DisplayNameAttribute string            `yaml:"displayNameAttribute"` // 显示名称属性，默认 cn
+	GroupAttribute       string            `yaml:"groupAttribute"`       // 用户条目上的用户组属性，默认 memberOf
+	GroupBaseDN          string            `yaml:"groupBaseDN"`          // 目录不支持 memberOf 时按该根DN查询用户组，为空表示不查询
+	GroupFilter          string            `yaml:"groupFilter"`          // 用户组查询条件，%s 替换为用户DN，默认 (member=%s)
+	DefaultRole          string            `yaml:"defaultRole"`          // 首次登录自动创建用户时的角色，默认 viewer
+	GroupRoles           map[string]string `yaml:"groupRoles"`           // 用户组（CN或完整DN，不区分大小写）-> 角色，匹配多个时取权限最高的角色，每次登录同步
+	Timeout              string            `yaml:"timeout"`              // 连接和查询超时，默认 5s
+	CacheTTL             string            `yaml:"cacheTTL"`             // 登录成功后缓存该用户名密码的时长，期间不再访问LDAP，默认 5m，设为 0 表示不缓存
+}
+
+// ldapEntry 查询到的LDAP用户
+type ldapEntry struct {
+	DN          string
+	Username    string
+	DisplayName string
+	Groups      []string // 小写的用户组DN和CN
+}
+
+// ldapBindCacheItem 登录成功的缓存记录，只保存密码的HMAC
+type ldapBindCacheItem struct {
+	entry     *ldapEntry
+	mac       []byte
+	expiresAt time.Time
+}
+
+// LDAPAuthenticator LDAP 绑定认证后端
+type LDAPAuthenticator struct {
+	config   LDAPConfig
+	timeout  time.Duration
+	cacheTTL time.Duration
+	cacheKey []byte // 缓存密码HMAC的随机密钥，进程重启后失效
+
+	mu    sync.Mutex
+	cache map[string]*ldapBindCacheItem
+}
+
+// 全局LDAP认证后端，未启用时为 nil
+var ldapAuthenticator *LDAPAuthenticator
+
+// InitLDAP 根据配置初始化LDAP认证，启用后加入认证后端链（本地用户兜底）
+func InitLDAP(config LDAPConfig) error {
+	ldapAuthenticator = nil
+	authenticators = []Authenticator{localAuthenticator{}}
+	if !config.Enabled {
+		return nil
+	}
+
+	if config.URL == "" || config.BaseDN == "" {
+		return fmt.Errorf("url 和 baseDN 不能为空")
+	}
+	if config.UserFilter == "" {
+		config.UserFilter = "(uid=%s)"
+	}
+	if !strings.Contains(config.UserFilter, "%s") {
+		return fmt.Errorf("userFilter 必须包含 %%s")
+	}
+	if config.UsernameAttribute == "" {
+		config.UsernameAttribute = "uid"
+	}
+	if config.DisplayNameAttribute == "" {
+		config.DisplayNameAttribute = "cn"
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "memberOf"
+	}
+	if config.GroupFilter == "" {
+		config.GroupFilter = "(member=%s)"
+	}
+	if config.DefaultRole == "" {
+		config.DefaultRole = RoleViewer
+	}
+	if !IsValidRole(config.DefaultRole) {
+		return fmt.Errorf("无效的默认角色 '%s'", config.DefaultRole)
+	}
+
+	// 用户组名不区分大小写
+	groupRoles := make(map[string]string, len(config.GroupRoles))
+	for group, role := range config.GroupRoles {
+		if !IsValidRole(role) {
+			return fmt.Errorf("用户组 '%s' 映射的角色 '%s' 无效", group, role)
+		}
+		groupRoles[strings.ToLower(group)] = role
+	}
+	config.GroupRoles = groupRoles
+
+	timeout := 5 * time.Second
+	if config.Timeout != "" {
+		d, err := time.ParseDuration(config.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("无效的超时时间 '%s'", config.Timeout)
+		}
+		timeout = d
+	}
+	cacheTTL := 5 * time.Minute
+	if config.CacheTTL != "" {
+		d, err := time.ParseDuration(config.CacheTTL)
+		if err != nil || d < 0 {
+			return fmt.Errorf("无效的缓存时长 '%s'", config.CacheTTL)
+		}
+		cacheTTL = d
+	}
+
+	cacheKey := make([]byte, 32)
+	if _, err := rand.Read(cacheKey); err != nil {
+		return fmt.Errorf("生成缓存密钥失败: %v", err)
+	}
+
+	ldapAuthenticator = &LDAPAuthenticator{
+		config:   config,
+		timeout:  timeout,
+		cacheTTL: cacheTTL,
+		cacheKey: cacheKey,
+		cache:    make(map[string]*ldapBindCacheItem),
+	}
+	authenticators = []Authenticator{ldapAuthenticator, localAuthenticator{}}
+
+	appLogger.Info(fmt.Sprintf("LDAP认证已启用: url=%s, baseDN=%s, 默认角色=%s, 用户组映射 %d 项, 缓存 %v",
+		config.URL, config.BaseDN, config.DefaultRole, len(config.GroupRoles), cacheTTL))
+	return nil
+}
+
+// Name 后端名称
+func (la *LDAPAuthenticator) Name() string {
+	return AuthSourceLDAP
+}
+
+// passwordMAC 计算缓存用的密码HMAC
+func (la *LDAPAuthenticator) passwordMAC(username, password string) []byte {
+	mac := hmac.New(sha256.New, la.cacheKey)
+	mac.Write([]byte(username))
+	mac.Write([]byte{0})
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+// cachedEntry 用户名密码与缓存一致且未过期时返回缓存的用户条目
+func (la *LDAPAuthenticator) cachedEntry(username, password string) (*ldapEntry, bool) {
+	if la.cacheTTL <= 0 {
+		return nil, false
+	}
+
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	item, ok := la.cache[username]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(item.expiresAt) {
+		delete(la.cache, username)
+		return nil, false
+	}
+	if !hmac.Equal(item.mac, la.passwordMAC(username, password)) {
+		return nil, false
+	}
+	return item.entry, true
+}
+
+// storeEntry 缓存登录成功的用户条目
+func (la *LDAPAuthenticator) storeEntry(username, password string, entry *ldapEntry) {
+	if la.cacheTTL <= 0 {
+		return
+	}
+
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	now := time.Now()
+	for k, item := range la.cache {
+		if now.After(item.expiresAt) {
+			delete(la.cache, k)
+		}
+	}
+	la.cache[username] = &ldapBindCacheItem{
+		entry:     entry,
+		mac:       la.passwordMAC(username, password),
+		expiresAt: now.Add(la.cacheTTL),
+	}
+}
+
+// ClearCache 清空登录缓存（未启用LDAP时为空操作）
+func (la *LDAPAuthenticator) ClearCache() {
+	if la == nil {
+		return
+	}
+	la.mu.Lock()
+	defer la.mu.Unlock()
+	la.cache = make(map[string]*ldapBindCacheItem)
+}
+
+// GetCacheSize 获取登录缓存条数
+func (la *LDAPAuthenticator) GetCacheSize() int {
+	if la == nil {
+		return 0
+	}
+	la.mu.Lock()
+	defer la.mu.Unlock()
+	return len(la.cache)
+}
+
+// MemoryUsage 估算登录缓存占用的内存（字节）
+func (la *LDAPAuthenticator) MemoryUsage() int64 {
+	if la == nil {
+		return 0
+	}
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	var total int64
+	for key, item := range la.cache {
+		total += mapEntryOverhead + int64(len(key)) + int64(unsafe.Sizeof(*item)) + int64(unsafe.Sizeof(*item.entry)) +
+			int64(len(item.mac)+len(item.entry.DN)+len(item.entry.Username)+len(item.entry.DisplayName))
+		for _, g := range item.entry.Groups {
+			total += int64(len(g)) + int64(unsafe.Sizeof(g))
+		}
+	}
+	return total
+}
+
+// dial 连接LDAP服务器
+func (la *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: la.config.InsecureSkipVerify}
+	if u, err := url.Parse(la.config.URL); err == nil {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	conn, err := ldap.DialURL(la.config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: la.timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("连接LDAP服务器失败: %v", err)
+	}
+	conn.SetTimeout(la.timeout)
+
+	if la.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS 失败: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+// serviceBind 使用服务账号绑定（未配置时匿名）
+func (la *LDAPAuthenticator) serviceBind(conn *ldap.Conn) error {
+	if la.config.BindDN == "" {
+		return conn.UnauthenticatedBind("")
+	}
+	if err := conn.Bind(la.config.BindDN, la.config.BindPassword); err != nil {
+		return fmt.Errorf("LDAP服务账号绑定失败: %v", err)
+	}
+	return nil
+}
+
+// lookup 查询用户并用用户密码绑定校验，返回用户条目
+func (la *LDAPAuthenticator) lookup(username, password string) (*ldapEntry, error) {
+	conn, err := la.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := la.serviceBind(conn); err != nil {
+		return nil, err
+	}
+
+	timeLimit := int(la.timeout.Seconds())
+	result, err := conn.Search(ldap.NewSearchRequest(
+		la.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, timeLimit, false,
+		fmt.Sprintf(la.config.UserFilter, ldap.EscapeFilter(username)),
+		[]string{la.config.UsernameAttribute, la.config.DisplayNameAttribute, la.config.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("LDAP查询用户失败: %v", err)
+	}
+	if len(result.Entries) == 0 {
+		return nil, errUnknownUser
+	}
+	if len(result.Entries) > 1 {
+		return nil, fmt.Errorf("LDAP中有多个用户匹配 '%s'，请检查 userFilter", username)
+	}
+
+	item := result.Entries[0]
+	if err := conn.Bind(item.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			appLogger.Warning(fmt.Sprintf("LDAP用户验证失败: 用户 '%s' 密码不匹配", username))
+			return nil, errInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP用户绑定失败: %v", err)
+	}
+
+	entry := &ldapEntry{
+		DN:          item.DN,
+		Username:    item.GetAttributeValue(la.config.UsernameAttribute),
+		DisplayName: item.GetAttributeValue(la.config.DisplayNameAttribute),
+	}
+	if entry.Username == "" {
+		entry.Username = username
+	}
+	groupDNs := item.GetAttributeValues(la.config.GroupAttribute)
+
+	// 目录不支持 memberOf 时按用户DN查询用户组（用户本身可能没有读取权限，重新以服务账号绑定）
+	if la.config.GroupBaseDN != "" {
+		if err := la.serviceBind(conn); err != nil {
+			return nil, err
+		}
+		groups, err := conn.Search(ldap.NewSearchRequest(
+			la.config.GroupBaseDN,
+			ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, timeLimit, false,
+			fmt.Sprintf(la.config.GroupFilter, ldap.EscapeFilter(item.DN)),
+			[]string{"cn"},
+			nil,
+		))
+		if err != nil {
+			return nil, fmt.Errorf("LDAP查询用户组失败: %v", err)
+		}
+		for _, g := range groups.Entries {
+			groupDNs = append(groupDNs, g.DN)
+		}
+	}
+	entry.Groups = ldapGroupNames(groupDNs)
+	return entry, nil
+}
+
+// ldapGroupNames 将用户组DN转换为小写的DN和CN，用于匹配 groupRoles
+func ldapGroupNames(dns []string) []string {
+	names := make([]string, 0, len(dns)*2)
+	for _, dn := range dns {
+		names = append(names, strings.ToLower(dn))
+		parsed, err := ldap.ParseDN(dn)
+		if err != nil || len(parsed.RDNs) == 0 {
+			continue
+		}
+		for _, attr := range parsed.RDNs[0].Attributes {
+			if strings.EqualFold(attr.Type, "cn") {
+				names = append(names, strings.ToLower(attr.Value))
+			}
+		}
+	}
+	return names
+}
+
+// Authenticate 校验LDAP用户名密码，成功后创建或同步本地用户
+func (la *LDAPAuthenticator) Authenticate(username, password string) (*LogUser, error) {
+	if username == "" || password == "" {
+		return nil, errUnknownUser
+	}
+	// 本地用户优先，避免目录中的同名条目影响本地账号（如 root）登录
+	if user, exists := userManager.GetUser(username); exists && user.IsLocal() {
+		return nil, errUnknownUser
+	}
+
+	entry, cached := la.cachedEntry(username, password)
+	if !cached {
+		var err error
+		entry, err = la.lookup(username, password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 用户组匹配到角色时每次登录同步角色，否则新用户使用默认角色、已有用户保留当前角色
+	role := RoleForGroups(entry.Groups, la.config.GroupRoles)
+	user, created, err := userManager.ProvisionExternalUser(AuthSourceLDAP, strings.ToLower(entry.Username), entry.Username, entry.DisplayName, role, la.config.DefaultRole)
+	if err != nil {
+		return nil, fmt.Errorf("同步LDAP用户失败: %v", err)
+	}
+	if created {
+		writeAudit(user.Username, "", AuditUserProvision, user.Username, nil, map[string]interface{}{"auth_source": AuthSourceLDAP, "role": user.Role, "dn": entry.DN})
+	}
+	if !user.IsActive {
+		appLogger.Warning(fmt.Sprintf("LDAP用户验证失败: 用户 '%s' 已被停用", user.Username))
+		return nil, errInvalidCredentials
+	}
+	if !cached {
+		la.storeEntry(username, password, entry)
+	}
+
+	go userManager.updateLastLogin(user.Username)
+	appLogger.Info(fmt.Sprintf("LDAP用户验证成功: 用户 '%s', DN=%s, 角色=%s, 缓存=%t", user.Username, entry.DN, user.Role, cached))
+	return user, nil
+}
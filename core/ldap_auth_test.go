@@ -0,0 +1,423 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	testLDAPBaseDN     = "dc=example,dc=com"
+	testLDAPServiceDN  = "cn=svc,dc=example,dc=com"
+	testLDAPServicePwd = "svc-pass"
+)
+
+// testLDAPEntry 测试目录中的条目
+type testLDAPEntry struct {
+	dn    string
+	attrs map[string][]string
+}
+
+// testLDAPServer 测试用LDAP服务器，支持简单绑定、等值条件查询和解绑
+type testLDAPServer struct {
+	listener net.Listener
+
+	mu        sync.Mutex
+	passwords map[string]string // DN -> 密码
+	entries   []testLDAPEntry
+	conns     int      // 已接受的连接数
+	binds     []string // 绑定过的DN（含失败的）
+}
+
+func newTestLDAPServer(t *testing.T) *testLDAPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动测试LDAP服务器失败: %v", err)
+	}
+	s := &testLDAPServer{
+		listener: listener,
+		passwords: map[string]string{
+			testLDAPServiceDN:                       testLDAPServicePwd,
+			"uid=alice,ou=people,dc=example,dc=com": "alice-pass",
+			"uid=bob,ou=people,dc=example,dc=com":   "bob-pass",
+			"uid=root,ou=people,dc=example,dc=com":  "ldap-root-pass",
+		},
+		entries: []testLDAPEntry{
+			{"uid=alice,ou=people,dc=example,dc=com", map[string][]string{
+				"uid": {"alice"}, "cn": {"Alice Liu"}, "memberOf": {"cn=Ops,ou=groups,dc=example,dc=com"},
+			}},
+			{"uid=bob,ou=people,dc=example,dc=com", map[string][]string{
+				"uid": {"bob"}, "cn": {"Bob Wang"},
+			}},
+			{"uid=root,ou=people,dc=example,dc=com", map[string][]string{
+				"uid": {"root"}, "cn": {"Directory Root"}, "memberOf": {"cn=Admins,ou=groups,dc=example,dc=com"},
+			}},
+			{"cn=Admins,ou=groups,dc=example,dc=com", map[string][]string{
+				"cn": {"Admins"}, "member": {"uid=bob,ou=people,dc=example,dc=com"},
+			}},
+		},
+	}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// url 服务器地址
+func (s *testLDAPServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// setPassword 修改目录中的用户密码
+func (s *testLDAPServer) setPassword(dn, password string) {
+	s.mu.Lock()
+	s.passwords[dn] = password
+	s.mu.Unlock()
+}
+
+// connCount 已接受的连接数
+func (s *testLDAPServer) connCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+// bindCount 绑定指定DN的次数
+func (s *testLDAPServer) bindCount(dn string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, bound := range s.binds {
+		if bound == dn {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *testLDAPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns++
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *testLDAPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn, _ := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			s.mu.Lock()
+			s.binds = append(s.binds, dn)
+			expected, exists := s.passwords[dn]
+			s.mu.Unlock()
+
+			code := ldap.LDAPResultSuccess
+			if dn != "" && (!exists || password == "" || password != expected) {
+				code = ldap.LDAPResultInvalidCredentials
+			}
+			conn.Write(ldapMessage(id, ldapResult(ldap.ApplicationBindResponse, code)))
+		case ldap.ApplicationSearchRequest:
+			for _, entry := range s.search(op) {
+				conn.Write(ldapMessage(id, entry))
+			}
+			conn.Write(ldapMessage(id, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)))
+		default:
+			return
+		}
+	}
+}
+
+// search 按根DN和等值条件查询条目（只支持 (attr=value) 形式的条件）
+func (s *testLDAPServer) search(request *ber.Packet) []*ber.Packet {
+	base, _ := request.Children[0].Value.(string)
+	filter := request.Children[6]
+	if filter.Tag != ldap.FilterEqualityMatch || len(filter.Children) != 2 {
+		return nil
+	}
+	attr, _ := filter.Children[0].Value.(string)
+	value, _ := filter.Children[1].Value.(string)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var results []*ber.Packet
+	for _, entry := range s.entries {
+		if !strings.HasSuffix(strings.ToLower(entry.dn), strings.ToLower(base)) {
+			continue
+		}
+		for name, values := range entry.attrs {
+			if strings.EqualFold(name, attr) && containsFold(values, value) {
+				results = append(results, ldapSearchEntry(entry))
+				break
+			}
+		}
+	}
+	return results
+}
+
+// containsFold 不区分大小写判断是否包含指定值
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ldapMessage 封装 LDAPMessage
+func ldapMessage(id int64, op *ber.Packet) []byte {
+	message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	message.AppendChild(op)
+	return message.Bytes()
+}
+
+// ldapResult 生成 LDAPResult 类型的响应
+func ldapResult(tag ber.Tag, code int) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return result
+}
+
+// ldapSearchEntry 生成 SearchResultEntry
+func ldapSearchEntry(entry testLDAPEntry) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, ""))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for name, values := range entry.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	result.AppendChild(attrs)
+	return result
+}
+
+// recordingAuthenticator 排在认证后端链末尾，记录是否被调用
+type recordingAuthenticator struct{ calls *int }
+
+func (recordingAuthenticator) Name() string { return "recording" }
+
+func (r recordingAuthenticator) Authenticate(string, string) (*LogUser, error) {
+	*r.calls++
+	return nil, errUnknownUser
+}
+
+// setupLDAP 启用指向测试服务器的LDAP认证，并在认证后端链末尾追加记录调用的后端
+func setupLDAP(t *testing.T, server *testLDAPServer) *int {
+	t.Helper()
+
+	err := InitLDAP(LDAPConfig{
+		Enabled:      true,
+		URL:          server.url(),
+		BindDN:       testLDAPServiceDN,
+		BindPassword: testLDAPServicePwd,
+		BaseDN:       "ou=people," + testLDAPBaseDN,
+		GroupBaseDN:  "ou=groups," + testLDAPBaseDN,
+		GroupRoles:   map[string]string{"ops": RoleOperator, "cn=admins,ou=groups,dc=example,dc=com": RoleAdmin},
+		Timeout:      "2s",
+	})
+	if err != nil {
+		t.Fatalf("初始化LDAP失败: %v", err)
+	}
+	t.Cleanup(func() { InitLDAP(LDAPConfig{}) })
+
+	calls := 0
+	authenticators = append(authenticators, recordingAuthenticator{calls: &calls})
+	return &calls
+}
+
+func TestLDAPLoginProvisionsUserWithGroupRole(t *testing.T) {
+	server := newTestLDAPServer(t)
+	setupLDAP(t, server)
+	newTestUserManager(t)
+
+	tests := []struct {
+		username, password, displayName, role string
+	}{
+		{"alice", "alice-pass", "Alice Liu", RoleOperator}, // memberOf 中的用户组CN
+		{"bob", "bob-pass", "Bob Wang", RoleAdmin},         // 按 groupBaseDN 查询到的用户组DN
+	}
+	for _, tt := range tests {
+		user, ok := ValidateCredentials(tt.username, tt.password)
+		if !ok {
+			t.Fatalf("用户 %s 登录失败", tt.username)
+		}
+		if user.Role != tt.role || user.AuthSource != AuthSourceLDAP || user.ExternalID != tt.username || user.DisplayName != tt.displayName {
+			t.Fatalf("自动创建的用户 %s 不正确: %+v", tt.username, user)
+		}
+		if cached, _ := userManager.GetUser(tt.username); cached.Role != tt.role {
+			t.Fatalf("用户 %s 未写入用户缓存", tt.username)
+		}
+	}
+	if n := testDriver.count("INSERT INTO `log_users`"); n != 2 {
+		t.Fatalf("期望写入2个用户，实际 %d", n)
+	}
+}
+
+func TestLDAPWrongPasswordDoesNotFallBack(t *testing.T) {
+	server := newTestLDAPServer(t)
+	calls := setupLDAP(t, server)
+	newTestUserManager(t)
+
+	if _, err := ldapAuthenticator.Authenticate("alice", "wrong-pass"); !errors.Is(err, errInvalidCredentials) {
+		t.Fatalf("期望 errInvalidCredentials，实际 %v", err)
+	}
+	if _, ok := ValidateCredentials("alice", "wrong-pass"); ok {
+		t.Fatalf("密码错误时不应登录成功")
+	}
+	if *calls != 0 {
+		t.Fatalf("LDAP密码错误后不应继续尝试后面的认证后端")
+	}
+	if _, exists := userManager.GetUser("alice"); exists {
+		t.Fatalf("密码错误时不应创建用户")
+	}
+}
+
+func TestLDAPUnknownUserFallsBackToLocal(t *testing.T) {
+	server := newTestLDAPServer(t)
+	calls := setupLDAP(t, server)
+	newTestUserManager(t, localTestUser(t, "carol", "Carol-Passw0rd", RoleAnalyst))
+
+	if _, err := ldapAuthenticator.Authenticate("nobody", "whatever"); !errors.Is(err, errUnknownUser) {
+		t.Fatalf("期望 errUnknownUser，实际 %v", err)
+	}
+	if _, ok := ValidateCredentials("nobody", "whatever"); ok {
+		t.Fatalf("不存在的用户不应登录成功")
+	}
+	if *calls != 1 {
+		t.Fatalf("LDAP中不存在的用户应交给后面的认证后端处理，实际调用 %d 次", *calls)
+	}
+
+	// LDAP服务器不可用时交给本地认证，本地用户仍可登录
+	server.listener.Close()
+	if _, err := ldapAuthenticator.Authenticate("dave", "whatever"); err == nil || errors.Is(err, errInvalidCredentials) {
+		t.Fatalf("LDAP不可用时应交给后面的认证后端处理，实际 %v", err)
+	}
+	if user, ok := ValidateCredentials("carol", "Carol-Passw0rd"); !ok || !user.IsLocal() {
+		t.Fatalf("LDAP不可用时本地用户应能登录")
+	}
+}
+
+func TestLDAPNeverReceivesLocalUsername(t *testing.T) {
+	server := newTestLDAPServer(t)
+	setupLDAP(t, server)
+	newTestUserManager(t, localTestUser(t, "root", "Root-Passw0rd", RoleAdmin))
+
+	// 目录中有同名的 root 条目，但本地用户优先，且不会把本地密码发送给LDAP
+	if _, err := ldapAuthenticator.Authenticate("root", "ldap-root-pass"); !errors.Is(err, errUnknownUser) {
+		t.Fatalf("本地用户名应由本地认证处理，实际 %v", err)
+	}
+	user, ok := ValidateCredentials("root", "Root-Passw0rd")
+	if !ok || !user.IsLocal() || user.Role != RoleAdmin {
+		t.Fatalf("本地 root 用户应能登录: %+v", user)
+	}
+	if _, ok := ValidateCredentials("root", "ldap-root-pass"); ok {
+		t.Fatalf("不应接受LDAP中同名条目的密码")
+	}
+	if n := server.connCount(); n != 0 {
+		t.Fatalf("本地用户名不应发送给LDAP，实际连接 %d 次", n)
+	}
+}
+
+func TestLDAPEmptyPasswordRejectedBeforeBind(t *testing.T) {
+	server := newTestLDAPServer(t)
+	setupLDAP(t, server)
+	newTestUserManager(t)
+
+	// 空密码在多数目录中会被当作匿名绑定而成功，必须在访问LDAP之前拒绝
+	if _, err := ldapAuthenticator.Authenticate("alice", ""); !errors.Is(err, errUnknownUser) {
+		t.Fatalf("期望 errUnknownUser，实际 %v", err)
+	}
+	if _, ok := ValidateCredentials("alice", ""); ok {
+		t.Fatalf("空密码不应登录成功")
+	}
+	if n := server.connCount(); n != 0 {
+		t.Fatalf("空密码不应访问LDAP，实际连接 %d 次", n)
+	}
+}
+
+func TestLDAPBindCache(t *testing.T) {
+	const aliceDN = "uid=alice,ou=people,dc=example,dc=com"
+
+	server := newTestLDAPServer(t)
+	setupLDAP(t, server)
+	newTestUserManager(t)
+
+	login := func(password string) error {
+		_, err := ldapAuthenticator.Authenticate("alice", password)
+		return err
+	}
+
+	if err := login("alice-pass"); err != nil {
+		t.Fatalf("首次登录失败: %v", err)
+	}
+	if n := server.bindCount(aliceDN); n != 1 {
+		t.Fatalf("首次登录应绑定1次，实际 %d", n)
+	}
+
+	// 缓存命中：不再访问LDAP
+	if err := login("alice-pass"); err != nil {
+		t.Fatalf("缓存命中时登录失败: %v", err)
+	}
+	if n := server.connCount(); n != 1 {
+		t.Fatalf("缓存命中时不应访问LDAP，实际连接 %d 次", n)
+	}
+
+	// 缓存过期：重新绑定
+	ldapAuthenticator.mu.Lock()
+	ldapAuthenticator.cache["alice"].expiresAt = time.Now().Add(-time.Second)
+	ldapAuthenticator.mu.Unlock()
+	if err := login("alice-pass"); err != nil {
+		t.Fatalf("缓存过期后登录失败: %v", err)
+	}
+	if n := server.bindCount(aliceDN); n != 2 {
+		t.Fatalf("缓存过期后应重新绑定，实际绑定 %d 次", n)
+	}
+
+	// 目录中修改密码后：新密码不命中缓存，旧密码经LDAP校验失败
+	server.setPassword(aliceDN, "alice-new-pass")
+	if err := login("alice-new-pass"); err != nil {
+		t.Fatalf("修改密码后使用新密码登录失败: %v", err)
+	}
+	if n := server.bindCount(aliceDN); n != 3 {
+		t.Fatalf("新密码不应命中缓存，实际绑定 %d 次", n)
+	}
+	if err := login("alice-pass"); !errors.Is(err, errInvalidCredentials) {
+		t.Fatalf("修改密码后旧密码应登录失败，实际 %v", err)
+	}
+	if n := server.bindCount(aliceDN); n != 4 {
+		t.Fatalf("旧密码不应命中缓存，实际绑定 %d 次", n)
+	}
+}
@@ -5,10 +5,39 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
 
+// 日志级别，低于当前级别的日志不输出
+var logLevels = map[string]int{
+	"DEBUG":   0,
+	"INFO":    1,
+	"WARNING": 2,
+	"ERROR":   3,
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level string `yaml:"level"` // 日志级别: debug、info、warning、error，默认 info
+}
+
+// parseLogLevel 解析日志级别名称，为空时为 info
+func parseLogLevel(name string) (string, error) {
+	level := strings.ToUpper(strings.TrimSpace(name))
+	if level == "" {
+		return "INFO", nil
+	}
+	if level == "WARN" {
+		level = "WARNING"
+	}
+	if _, ok := logLevels[level]; !ok {
+		return "", fmt.Errorf("无效的日志级别 '%s'，应为 debug、info、warning 或 error", name)
+	}
+	return level, nil
+}
+
 // Logger 日志系统
 type Logger struct {
 	mu       sync.RWMutex
@@ -16,76 +45,59 @@ type Logger struct {
 	logger   *log.Logger
 	logDir   string
 	fileName string
+	minLevel int
 }
 
 // 全局日志实例
 var appLogger *Logger
 
-// 启动定时清理任务和日志系统
+// 初始化日志系统（调用 InitLogger 前日志输出到标准错误）
 func init() {
-	// 初始化日志系统
-	initLogger()
-
-	// 启动定时清理任务
-	go startDailyCleanup()
-
-	// 启动日志轮转任务
-	go startLogRotation()
+	appLogger = &Logger{
+		logger:   log.New(os.Stderr, "", log.LstdFlags),
+		minLevel: logLevels["INFO"],
+	}
 }
 
-// startDailyCleanup 启动每天0点清理缓存的任务
-func startDailyCleanup() {
-	for {
-		now := time.Now()
-		// 计算下一个0点的时间
-		next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
-		// 等待到下一个0点
-		time.Sleep(next.Sub(now))
-
-		// 清空玩家缓存
-		playerCache.mu.Lock()
-		playerCache.cache = make(map[string]*Player)
-		playerCache.mu.Unlock()
-
-		// 记录日志
-		if appLogger != nil {
-			appLogger.Info("玩家缓存已清空")
-		}
+// SetLevel 设置日志级别
+func (l *Logger) SetLevel(name string) error {
+	level, err := parseLogLevel(name)
+	if err != nil {
+		return err
 	}
-}
 
-// startLogRotation 启动日志轮转任务
-func startLogRotation() {
-	for {
-		now := time.Now()
-		// 计算下一个0点的时间
-		next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
-		// 等待到下一个0点
-		time.Sleep(next.Sub(now))
+	l.mu.Lock()
+	l.minLevel = logLevels[level]
+	l.mu.Unlock()
+	return nil
+}
 
-		// 轮转日志文件
-		if appLogger != nil {
-			appLogger.Info("开始轮转日志文件")
-			appLogger.rotateLogFile()
-			appLogger.Info("日志文件轮转完成")
+// Level 获取当前日志级别名称
+func (l *Logger) Level() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for name, value := range logLevels {
+		if value == l.minLevel {
+			return name
 		}
 	}
+	return "INFO"
 }
 
-// initLogger 初始化日志系统
-func initLogger() {
+// InitLogger 设置日志目录并创建今天的日志文件
+func InitLogger(logDir string) error {
 	// 创建log目录
-	logDir := "../log"
 	if err := os.MkdirAll(logDir, 0755); err != nil {
-		panic(fmt.Sprintf("创建日志目录失败: %v", err))
+		return fmt.Errorf("创建日志目录失败: %v", err)
 	}
 
-	appLogger = &Logger{
-		logDir: logDir,
-	}
+	appLogger.mu.Lock()
+	appLogger.logDir = logDir
+	appLogger.mu.Unlock()
 
 	// 创建今天的日志文件
 	appLogger.rotateLogFile()
+	return nil
 }
 
 // rotateLogFile 轮转日志文件
@@ -93,13 +105,18 @@ func (l *Logger) rotateLogFile() {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	// 未设置日志目录时不写文件
+	if l.logDir == "" {
+		return
+	}
+
 	// 关闭旧文件
 	if l.file != nil {
 		l.file.Close()
 	}
 
-	// 生成新的文件名
-	now := time.Now()
+	// 生成新的文件名（按业务时区的自然日命名）
+	now := businessClock.Now()
 	fileName := fmt.Sprintf("logsvr_%s.log", now.Format("20060102"))
 	filePath := filepath.Join(l.logDir, fileName)
 
@@ -117,11 +134,62 @@ func (l *Logger) rotateLogFile() {
 	l.logger.Printf("=== 日志文件开始 - %s ===", now.Format("2006-01-02 15:04:05"))
 }
 
+// Close 将日志写入磁盘并关闭日志文件，之后的日志输出到标准错误
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.logDir = ""
+	if l.file == nil {
+		return nil
+	}
+	l.logger.Printf("=== 日志文件结束 - %s ===", businessClock.Now().Format("2006-01-02 15:04:05"))
+	l.logger = log.New(os.Stderr, "", log.LstdFlags)
+
+	file := l.file
+	l.file = nil
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// CheckWritable 检查日志文件已打开且日志目录可写
+func (l *Logger) CheckWritable() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.file == nil {
+		return fmt.Errorf("日志文件未打开")
+	}
+	if _, err := os.Stat(filepath.Join(l.logDir, l.fileName)); err != nil {
+		return fmt.Errorf("日志文件不存在: %v", err)
+	}
+	probe, err := os.CreateTemp(l.logDir, ".writecheck-*")
+	if err != nil {
+		return fmt.Errorf("日志目录不可写: %v", err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// FileName 当前日志文件名
+func (l *Logger) FileName() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.fileName
+}
+
 // WriteLog 写入日志
 func (l *Logger) WriteLog(level, message string) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 
+	if value, ok := logLevels[level]; ok && value < l.minLevel {
+		return
+	}
 	if l.logger != nil {
 		timestamp := time.Now().Format("2006-01-02 15:04:05")
 		l.logger.Printf("[%s] [%s] %s", timestamp, level, message)
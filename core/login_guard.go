@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoginGuardConfig 登录防暴力破解配置
+type LoginGuardConfig struct {
+	MaxAttempts     int    `yaml:"maxAttempts"`     // 同一用户名连续失败次数上限，达到后锁定，默认 5
+	IPMaxAttempts   int    `yaml:"ipMaxAttempts"`   // 同一IP连续失败次数上限，达到后锁定，默认 20
+	LockoutDuration string `yaml:"lockoutDuration"` // 锁定时长，默认 15m
+	BaseDelay       string `yaml:"baseDelay"`       // 失败后退避的初始间隔，每次失败翻倍，默认 1s
+	MaxDelay        string `yaml:"maxDelay"`        // 退避间隔上限，默认 30s
+	Window          string `yaml:"window"`          // 距上次失败超过该时长后失败计数清零，默认 15m
+}
+
+// loginAttempt 单个用户名或IP的失败记录
+type loginAttempt struct {
+	Failures    int
+	LastFailure time.Time
+	NextAllowed time.Time // 退避结束时间
+	LockedUntil time.Time // 锁定结束时间
+}
+
+// LoginLock 当前被锁定的用户名或IP
+type LoginLock struct {
+	Kind        string    `json:"kind"` // username 或 ip
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// LoginGuard 登录失败计数、指数退避和临时锁定
+// 计数保存在内存中，服务重启后清零
+type LoginGuard struct {
+	mu            sync.Mutex
+	users         map[string]*loginAttempt
+	ips           map[string]*loginAttempt
+	maxAttempts   int
+	ipMaxAttempts int
+	lockout       time.Duration
+	baseDelay     time.Duration
+	maxDelay      time.Duration
+	window        time.Duration
+}
+
+// 全局登录防护实例
+var loginGuard = newLoginGuard()
+
+func newLoginGuard() *LoginGuard {
+	return &LoginGuard{
+		users:         make(map[string]*loginAttempt),
+		ips:           make(map[string]*loginAttempt),
+		maxAttempts:   5,
+		ipMaxAttempts: 20,
+		lockout:       15 * time.Minute,
+		baseDelay:     time.Second,
+		maxDelay:      30 * time.Second,
+		window:        15 * time.Minute,
+	}
+}
+
+// Configure 根据配置设置登录防护参数，未配置的项使用默认值
+func (g *LoginGuard) Configure(config LoginGuardConfig) error {
+	parse := func(name, value string, def time.Duration) (time.Duration, error) {
+		if value == "" {
+			return def, nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("无效的 %s '%s'", name, value)
+		}
+		return d, nil
+	}
+
+	lockout, err := parse("lockoutDuration", config.LockoutDuration, 15*time.Minute)
+	if err != nil {
+		return err
+	}
+	baseDelay, err := parse("baseDelay", config.BaseDelay, time.Second)
+	if err != nil {
+		return err
+	}
+	maxDelay, err := parse("maxDelay", config.MaxDelay, 30*time.Second)
+	if err != nil {
+		return err
+	}
+	window, err := parse("window", config.Window, 15*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.maxAttempts = 5
+	if config.MaxAttempts > 0 {
+		g.maxAttempts = config.MaxAttempts
+	}
+	g.ipMaxAttempts = 20
+	if config.IPMaxAttempts > 0 {
+		g.ipMaxAttempts = config.IPMaxAttempts
+	}
+	g.lockout, g.baseDelay, g.maxDelay, g.window = lockout, baseDelay, maxDelay, window
+	return nil
+}
+
+// normalizeLoginName 用户名不区分大小写（与数据库排序规则一致）
+func normalizeLoginName(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// current 获取有效的失败记录，超过计数窗口且未锁定的记录视为已清零
+func (g *LoginGuard) current(m map[string]*loginAttempt, key string, now time.Time) *loginAttempt {
+	a, ok := m[key]
+	if !ok {
+		return nil
+	}
+	if now.Before(a.LockedUntil) {
+		return a
+	}
+	if !a.LockedUntil.IsZero() || now.Sub(a.LastFailure) > g.window {
+		delete(m, key)
+		return nil
+	}
+	return a
+}
+
+// Check 登录前检查是否允许尝试，不允许时返回可再次尝试的时间和是否处于锁定状态
+func (g *LoginGuard) Check(username, ip string) (allowed bool, retryAt time.Time, locked bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for _, a := range []*loginAttempt{
+		g.current(g.users, normalizeLoginName(username), now),
+		g.current(g.ips, ip, now),
+	} {
+		if a == nil {
+			continue
+		}
+		if now.Before(a.LockedUntil) {
+			if !locked || a.LockedUntil.After(retryAt) {
+				retryAt = a.LockedUntil
+			}
+			locked = true
+			continue
+		}
+		if !locked && now.Before(a.NextAllowed) && a.NextAllowed.After(retryAt) {
+			retryAt = a.NextAllowed
+		}
+	}
+
+	return retryAt.IsZero(), retryAt, locked
+}
+
+// recordFailure 累加失败次数，返回记录以及本次是否触发锁定
+func (g *LoginGuard) recordFailure(m map[string]*loginAttempt, key string, max int, now time.Time) (*loginAttempt, bool) {
+	a := g.current(m, key, now)
+	if a == nil {
+		a = &loginAttempt{}
+		m[key] = a
+	}
+	a.Failures++
+	a.LastFailure = now
+
+	// 指数退避: baseDelay * 2^(failures-1)，不超过 maxDelay
+	delay := g.baseDelay
+	for i := 1; i < a.Failures && delay < g.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.maxDelay {
+		delay = g.maxDelay
+	}
+	a.NextAllowed = now.Add(delay)
+
+	if a.Failures >= max && a.LockedUntil.IsZero() {
+		a.LockedUntil = now.Add(g.lockout)
+		return a, true
+	}
+	return a, false
+}
+
+// RecordFailure 记录一次登录失败，返回该用户名剩余可尝试次数和锁定结束时间（未锁定时为零值）
+func (g *LoginGuard) RecordFailure(username, ip string) (remaining int, lockedUntil time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	name := normalizeLoginName(username)
+
+	user, userLocked := g.recordFailure(g.users, name, g.maxAttempts, now)
+	ipAttempt, ipLocked := g.recordFailure(g.ips, ip, g.ipMaxAttempts, now)
+
+	if userLocked {
+		appLogger.Warning(fmt.Sprintf("登录锁定: 用户名 '%s' 连续失败 %d 次，锁定至 %s (IP=%s)",
+			username, user.Failures, user.LockedUntil.Format("2006-01-02 15:04:05"), ip))
+	}
+	if ipLocked {
+		appLogger.Warning(fmt.Sprintf("登录锁定: IP %s 连续失败 %d 次，锁定至 %s",
+			ip, ipAttempt.Failures, ipAttempt.LockedUntil.Format("2006-01-02 15:04:05")))
+	}
+
+	if now.Before(user.LockedUntil) {
+		lockedUntil = user.LockedUntil
+	}
+	if now.Before(ipAttempt.LockedUntil) && ipAttempt.LockedUntil.After(lockedUntil) {
+		lockedUntil = ipAttempt.LockedUntil
+	}
+
+	remaining = g.maxAttempts - user.Failures
+	if ipRemaining := g.ipMaxAttempts - ipAttempt.Failures; ipRemaining < remaining {
+		remaining = ipRemaining
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, lockedUntil
+}
+
+// RecordSuccess 登录成功后清零该用户名的失败计数
+// IP计数不清零，避免攻击者用自己的账号登录来重置IP计数
+func (g *LoginGuard) RecordSuccess(username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.users, normalizeLoginName(username))
+}
+
+// Unlock 解除用户名或IP的锁定并清零失败计数，返回是否存在记录
+func (g *LoginGuard) Unlock(username, ip string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	found := false
+	if username != "" {
+		name := normalizeLoginName(username)
+		if _, ok := g.users[name]; ok {
+			delete(g.users, name)
+			found = true
+		}
+	}
+	if ip != "" {
+		if _, ok := g.ips[ip]; ok {
+			delete(g.ips, ip)
+			found = true
+		}
+	}
+	return found
+}
+
+// Locks 获取当前被锁定的用户名和IP
+func (g *LoginGuard) Locks() []LoginLock {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	var locks []LoginLock
+	collect := func(kind string, m map[string]*loginAttempt) {
+		for key := range m {
+			a := g.current(m, key, now)
+			if a != nil && now.Before(a.LockedUntil) {
+				locks = append(locks, LoginLock{
+					Kind:        kind,
+					Key:         key,
+					Failures:    a.Failures,
+					LastFailure: a.LastFailure,
+					LockedUntil: a.LockedUntil,
+				})
+			}
+		}
+	}
+	collect("username", g.users)
+	collect("ip", g.ips)
+
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].LockedUntil.After(locks[j].LockedUntil)
+	})
+	return locks
+}
+
+// Prune 清理已过期的失败记录
+func (g *LoginGuard) Prune() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for key := range g.users {
+		g.current(g.users, key, now)
+	}
+	for key := range g.ips {
+		g.current(g.ips, key, now)
+	}
+}
@@ -1,70 +1,128 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
-	"os"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"gopkg.in/yaml.v2"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
-// 配置文件结构
-type Config struct {
-	Database struct {
-		Mysql struct {
-			Host     string `yaml:"host"`
-			Port     int    `yaml:"port"`
-			User     string `yaml:"user"`
-			Password string `yaml:"password"`
-			Dbname   string `yaml:"dbname"`
-		} `yaml:"mysql"`
-	} `yaml:"database"`
-	Server struct {
-		Port int `yaml:"port"`
-	} `yaml:"server"`
-}
-
 var db *gorm.DB
 
 func main() {
+	// 命令行参数（未指定时读取对应环境变量，再使用默认值）
+	configPath := flag.String("config", envOrDefault("LOGSVR_CONFIG", DefaultConfigPath), "配置文件路径（环境变量 LOGSVR_CONFIG）")
+	logDir := flag.String("log-dir", envOrDefault("LOGSVR_LOG_DIR", DefaultLogDir), "日志目录（环境变量 LOGSVR_LOG_DIR）")
+	templates := flag.String("templates", envOrDefault("LOGSVR_TEMPLATE_DIR", DefaultTemplateDir), "页面模板目录（环境变量 LOGSVR_TEMPLATE_DIR）")
+	flag.Parse()
+
+	// 初始化日志文件
+	if err := InitLogger(*logDir); err != nil {
+		log.Fatalf("初始化日志失败: %v", err)
+	}
+
 	// 读取配置文件
-	configData, err := os.ReadFile("../config/.config.yaml")
+	config, overridden, err := LoadConfig(*configPath)
 	if err != nil {
-		log.Fatalf("读取配置文件失败: %v", err)
+		log.Fatalf("加载配置失败: %v", err)
+	}
+	appLogger.Info(fmt.Sprintf("配置文件: %s", *configPath))
+	if len(overridden) > 0 {
+		appLogger.Info(fmt.Sprintf("以下配置项由环境变量覆盖: %s", strings.Join(overridden, ", ")))
 	}
 
-	var config Config
-	err = yaml.Unmarshal(configData, &config)
-	if err != nil {
-		log.Fatalf("解析配置文件失败: %v", err)
+	if err := SetTemplateDir(*templates); err != nil {
+		log.Fatalf("页面模板配置错误: %v", err)
+	}
+
+	if config.Server.Mode != "" {
+		gin.SetMode(config.Server.Mode)
+	}
+
+	// 初始化可热加载的配置：日志级别、业务时区和每日切换时间、上报策略、区服分组、登录防护、密码策略
+	if err := applyReloadableConfig(config); err != nil {
+		log.Fatalf("%v", err)
+	}
+	appLogger.Info(fmt.Sprintf("日志级别: %s, 业务时区: %s, 每日切换时间: %v", appLogger.Level(), businessClock.Location(), businessClock.DayStart()))
+
+	// 初始化OIDC登录
+	if err := InitOIDC(config.OIDC); err != nil {
+		log.Fatalf("OIDC配置错误: %v", err)
+	}
+
+	// 初始化LDAP认证
+	if err := InitLDAP(config.LDAP); err != nil {
+		log.Fatalf("LDAP配置错误: %v", err)
 	}
 
 	// 初始化MySQL连接
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		config.Database.Mysql.User,
-		config.Database.Mysql.Password,
-		config.Database.Mysql.Host,
-		config.Database.Mysql.Port,
-		config.Database.Mysql.Dbname)
-
-	db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	dbLocation = config.Database.Mysql.Location()
+	db, err = gorm.Open(mysql.Open(config.Database.Mysql.DSN()), &gorm.Config{})
 	if err != nil {
 		log.Fatalf("连接数据库失败: %v", err)
 	}
+	if err := config.Database.Mysql.ConfigurePool(db); err != nil {
+		log.Fatalf("设置数据库连接池失败: %v", err)
+	}
 	appLogger.Info("数据库连接成功")
 
-	// 自动迁移表结构
-	db.AutoMigrate(&OnlineNum{}, &Player{}, &PayReport{})
+	// 命令行迁移子命令: logsvr [参数] migrate up [N] | down [N] | status
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrateCommand(db, args[1:]); err != nil {
+			log.Fatalf("数据库迁移失败: %v", err)
+		}
+		return
+	}
+
+	// 启动时执行未执行的数据库迁移
+	if config.Database.MigrateOnStart == nil || *config.Database.MigrateOnStart {
+		migrator, err := NewSchemaMigrator(db)
+		if err != nil {
+			log.Fatalf("初始化数据库迁移失败: %v", err)
+		}
+		count, err := migrator.Up(0)
+		if err != nil {
+			log.Fatalf("数据库迁移失败: %v", err)
+		}
+		appLogger.Info(fmt.Sprintf("数据库迁移完成，本次执行 %d 个迁移", count))
+	}
+
+	// 加载系统设置
+	InitSystemSettings(db)
+
+	// 初始化审计日志
+	InitAuditLog(db)
 
 	// 初始化用户管理器
 	InitUserManager(db)
 
-	// 从数据库加载今日充值数据，预热缓存
-	payRankCache.LoadTodayPayData(db)
+	// 初始化会话管理器
+	if err := InitSessionManager(db, config.Session); err != nil {
+		log.Fatalf("会话配置错误: %v", err)
+	}
+
+	// 初始化API令牌管理器
+	InitAPITokenManager(db)
+
+	// 初始化每日汇总管理器
+	InitRollupManager(db, config.Rollup.BackfillDays)
+
+	// 初始化数据保留管理器
+	InitRetentionManager(db, config.Retention)
+
+	// 恢复上次停止服务时保存的缓存快照（仅限同一业务日）
+	if err := RestoreCacheSnapshot(config.Server.CacheSnapshot); err != nil {
+		appLogger.Error(fmt.Sprintf("恢复缓存快照失败: %v", err))
+	}
+
+	// 从数据库加载今日充值数据，预热缓存（失败时后台重试）
+	payRankCache.WarmUp(db)
 
 	r := gin.Default()
 
@@ -76,25 +134,86 @@ func main() {
 		appLogger.Info("服务器启动成功")
 	}
 
-	// 启动每日0点重置缓存的定时器
-	go startDailyResetTimer()
+	// 注册并启动定时任务
+	registerScheduledJobs()
+	jobScheduler.Start()
+
+	// 监听配置文件变化和 SIGHUP 信号，重新加载可热加载的配置
+	InitConfigReloader(*configPath, config)
 
 	// 使用配置文件中的端口启动服务
 	port := config.Server.Port
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: r,
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serverErr <- err
+		}
+	}()
 	log.Printf("服务器启动在端口: %d", port)
-	r.Run(fmt.Sprintf(":%d", port))
+
+	// 收到 SIGINT/SIGTERM 后优雅停止
+	waitForShutdownSignal(serverErr)
+	gracefulShutdown(srv, config.Server)
+}
+
+// businessJobSpecs 依赖业务时区和每日切换时间的任务调度表达式（business 配置重新加载后据此修改调度）
+func businessJobSpecs(clock *BusinessClock) map[string]string {
+	// 业务日切换时刻（默认0点，可通过 business.dayStart 配置）
+	dayBoundary := clock.DayBoundarySpec(0)
+	return map[string]string{
+		"pay_rank_reset":     dayBoundary,
+		"player_cache_reset": dayBoundary,
+		// 每小时检查一次：业务日切换10分钟后生成前一天的汇总，并重建因迟到数据失效的日期
+		"daily_stats_rollup": clock.HourlySpec(10 * time.Minute),
+		"data_retention":     clock.DayBoundarySpec(30 * time.Minute),
+	}
 }
 
-// 每天0点定时重置
-func startDailyResetTimer() {
-	for {
-		// 计算下一个0点
-		now := time.Now()
-		next := now.Add(time.Hour * 24)
-		next = time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, next.Location())
-		t := time.NewTimer(next.Sub(now))
-		<-t.C
-		// 0点执行清理
-		payRankCache.ClearCache()
+// registerScheduledJobs 注册内置定时任务
+func registerScheduledJobs() {
+	specs := businessJobSpecs(businessClock)
+
+	jobs := []struct {
+		name        string
+		spec        string
+		description string
+		fn          JobFunc
+	}{
+		{"log_rotation", "0 0 * * *", "每日0点轮转日志文件", func() error {
+			appLogger.rotateLogFile()
+			return nil
+		}},
+		{"pay_rank_reset", specs["pay_rank_reset"], "业务日切换时清空充值排行榜缓存", func() error {
+			payRankCache.ClearCache()
+			return nil
+		}},
+		{"player_cache_reset", specs["player_cache_reset"], "业务日切换时清空玩家去重缓存", func() error {
+			playerCache.ClearCache()
+			appLogger.Info("玩家缓存已清空")
+			return nil
+		}},
+		{"daily_stats_rollup", specs["daily_stats_rollup"], "生成每日汇总数据(daily_stats)", func() error {
+			return rollupManager.RunPending()
+		}},
+		{"data_retention", specs["data_retention"], "原始数据降采样、归档和分区维护", func() error {
+			return retentionManager.Run()
+		}},
+		{"session_cleanup", "*/10 * * * *", "清理过期和空闲超时的登录会话", func() error {
+			return sessionManager.CleanupExpired()
+		}},
+		{"login_guard_prune", "*/10 * * * *", "清理过期的登录失败记录", func() error {
+			loginGuard.Prune()
+			return nil
+		}},
+	}
+
+	for _, job := range jobs {
+		if err := jobScheduler.Register(job.name, job.spec, job.description, job.fn); err != nil {
+			appLogger.Error(err.Error())
+		}
 	}
 }
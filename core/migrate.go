@@ -0,0 +1,478 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 内嵌的SQL迁移文件，命名格式: <版本号>_<名称>.up.sql / <版本号>_<名称>.down.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration 数据库迁移
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(db *gorm.DB) error
+	Down    func(db *gorm.DB) error
+}
+
+// SchemaMigration 已执行的迁移记录
+type SchemaMigration struct {
+	Version   int       `gorm:"column:version;primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"column:name;type:varchar(255);not null"`
+	AppliedAt time.Time `gorm:"column:applied_at;type:datetime;not null"`
+}
+
+// TableName 指定表名
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationState 迁移状态（用于 migrate status 输出）
+type MigrationState struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// goMigrations 需要条件判断的迁移（MySQL不支持 ADD COLUMN/INDEX IF NOT EXISTS），用Go实现以保证可重复执行
+var goMigrations = []Migration{
+	{
+		Version: 2,
+		Name:    "date_int_columns",
+		Up: func(db *gorm.DB) error {
+			// 早期部署的表没有 date_int 字段，补齐字段后按创建时间回填
+			for _, table := range []string{"online_num", "player", "pay_report"} {
+				if err := addColumnIfMissing(db, table, "date_int", "INT NOT NULL DEFAULT 0 COMMENT '日期整型字段，格式：YYYYMMDD'"); err != nil {
+					return err
+				}
+				if err := backfillDateInt(db, table); err != nil {
+					return fmt.Errorf("回填 %s.date_int 失败: %v", table, err)
+				}
+			}
+			return nil
+		},
+		Down: func(db *gorm.DB) error {
+			// date_int 已是基础表结构的一部分，回滚时不删除字段
+			return nil
+		},
+	},
+	{
+		Version: 3,
+		Name:    "date_int_indexes",
+		Up: func(db *gorm.DB) error {
+			for _, idx := range dateIntIndexes {
+				if err := addIndexIfMissing(db, idx.table, idx.name, idx.columns); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(db *gorm.DB) error {
+			for _, idx := range dateIntIndexes {
+				if err := dropIndexIfExists(db, idx.table, idx.name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// dateIntIndexes 基于整型日期字段的查询索引
+var dateIntIndexes = []struct {
+	table   string
+	name    string
+	columns string
+}{
+	// 在线人数表：date_int + gamesvr_id 等值查询及覆盖索引
+	{"online_num", "idx_date_gamesvr_opt", "date_int, gamesvr_id"},
+	{"online_num", "idx_date_gamesvr_online_opt", "date_int, gamesvr_id, online_num"},
+	// 玩家表：区服筛选、新玩家统计和按角色去重
+	{"player", "idx_date_gamesvr_opt", "date_int, gamesvr"},
+	{"player", "idx_date_newplayer_gamesvr_opt", "date_int, new_player, gamesvr"},
+	{"player", "idx_date_roleid_opt", "date_int, roleid"},
+	{"player", "idx_date_gamesvr_newplayer_roleid_opt", "date_int, gamesvr, new_player, roleid"},
+	// 支付表：区服筛选、排行榜和付费人数去重
+	{"pay_report", "idx_date_gamesvr_opt", "date_int, gamesvr"},
+	{"pay_report", "idx_date_roleid_money_opt", "date_int, roleid, money"},
+	{"pay_report", "idx_date_roleid_opt", "date_int, roleid"},
+	{"pay_report", "idx_date_gamesvr_roleid_money_opt", "date_int, gamesvr, roleid, money"},
+}
+
+// dateIntBackfillBatch 回填 date_int 时每批处理的行数
+const dateIntBackfillBatch = 1000
+
+// backfillDateInt 按业务时区和每日切换时间回填 date_int 为 0 的行
+// 不能用 DATE_FORMAT(created_at)，它按数据库会话的自然日计算，与业务日不一致
+func backfillDateInt(db *gorm.DB, table string) error {
+	type row struct {
+		ID        uint
+		CreatedAt string
+	}
+
+	lastID := uint(0)
+	total := 0
+	for {
+		var rows []row
+		if err := db.Raw(fmt.Sprintf(
+			"SELECT id, DATE_FORMAT(created_at, '%%Y-%%m-%%d %%H:%%i:%%s') AS created_at FROM `%s` WHERE date_int = 0 AND created_at IS NOT NULL AND id > ? ORDER BY id LIMIT ?", table),
+			lastID, dateIntBackfillBatch).Scan(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		// 同一业务日的行合并为一条 UPDATE
+		byDate := make(map[int][]uint)
+		for _, r := range rows {
+			lastID = r.ID
+			t, err := time.ParseInLocation("2006-01-02 15:04:05", r.CreatedAt, dbLocation)
+			if err != nil {
+				return fmt.Errorf("解析 id=%d 的 created_at '%s' 失败: %v", r.ID, r.CreatedAt, err)
+			}
+			dateInt := businessClock.DateOf(t)
+			byDate[dateInt] = append(byDate[dateInt], r.ID)
+		}
+		for dateInt, ids := range byDate {
+			if err := db.Exec(fmt.Sprintf("UPDATE `%s` SET date_int = ? WHERE id IN ?", table), dateInt, ids).Error; err != nil {
+				return err
+			}
+		}
+		total += len(rows)
+	}
+
+	if total > 0 {
+		appLogger.Info(fmt.Sprintf("已按业务日回填 %s.date_int，共 %d 行", table, total))
+	}
+	return nil
+}
+
+// addColumnIfMissing 字段不存在时添加
+func addColumnIfMissing(db *gorm.DB, table, column, definition string) error {
+	if db.Migrator().HasColumn(table, column) {
+		return nil
+	}
+	if err := db.Exec(fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", table, column, definition)).Error; err != nil {
+		return fmt.Errorf("添加字段 %s.%s 失败: %v", table, column, err)
+	}
+	return nil
+}
+
+// addIndexIfMissing 索引不存在时创建
+func addIndexIfMissing(db *gorm.DB, table, name, columns string) error {
+	if db.Migrator().HasIndex(table, name) {
+		return nil
+	}
+	if err := db.Exec(fmt.Sprintf("ALTER TABLE `%s` ADD INDEX `%s` (%s)", table, name, columns)).Error; err != nil {
+		return fmt.Errorf("创建索引 %s.%s 失败: %v", table, name, err)
+	}
+	return nil
+}
+
+// dropIndexIfExists 索引存在时删除
+func dropIndexIfExists(db *gorm.DB, table, name string) error {
+	if !db.Migrator().HasIndex(table, name) {
+		return nil
+	}
+	if err := db.Exec(fmt.Sprintf("ALTER TABLE `%s` DROP INDEX `%s`", table, name)).Error; err != nil {
+		return fmt.Errorf("删除索引 %s.%s 失败: %v", table, name, err)
+	}
+	return nil
+}
+
+// loadMigrations 加载全部迁移（内嵌SQL + Go迁移），按版本号排序
+func loadMigrations() ([]Migration, error) {
+	byVersion := make(map[int]*Migration)
+
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("读取迁移文件失败: %v", err)
+	}
+
+	for _, entry := range entries {
+		fileName := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("迁移文件名格式错误: %s", fileName)
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("迁移文件版本号错误: %s", fileName)
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join("migrations", fileName))
+		if err != nil {
+			return nil, fmt.Errorf("读取迁移文件 %s 失败: %v", fileName, err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		} else if m.Name != parts[1] {
+			return nil, fmt.Errorf("迁移版本号 %d 重复: %s / %s", version, m.Name, parts[1])
+		}
+
+		fn := sqlMigrationFunc(fileName, string(content))
+		if direction == "up" {
+			m.Up = fn
+		} else {
+			m.Down = fn
+		}
+	}
+
+	for i := range goMigrations {
+		gm := goMigrations[i]
+		if _, exists := byVersion[gm.Version]; exists {
+			return nil, fmt.Errorf("迁移版本号 %d 重复: %s", gm.Version, gm.Name)
+		}
+		byVersion[gm.Version] = &gm
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == nil {
+			return nil, fmt.Errorf("迁移 %04d_%s 缺少 up 脚本", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// sqlMigrationFunc 将SQL脚本转换为迁移函数（按分号逐条执行）
+func sqlMigrationFunc(fileName, content string) func(db *gorm.DB) error {
+	return func(db *gorm.DB) error {
+		for _, stmt := range splitSQLStatements(content) {
+			if err := db.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("%s 执行失败: %v\nSQL: %s", fileName, err, stmt)
+			}
+		}
+		return nil
+	}
+}
+
+// splitSQLStatements 拆分SQL脚本，忽略注释行和空语句
+func splitSQLStatements(content string) []string {
+	var statements []string
+	var current strings.Builder
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmt := strings.TrimSuffix(strings.TrimSpace(current.String()), ";")
+			if stmt != "" {
+				statements = append(statements, stmt)
+			}
+			current.Reset()
+		}
+	}
+	if stmt := strings.TrimSpace(current.String()); stmt != "" {
+		statements = append(statements, stmt)
+	}
+	return statements
+}
+
+// SchemaMigrator 数据库迁移执行器
+type SchemaMigrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// NewSchemaMigrator 创建迁移执行器，并确保 schema_migrations 表存在
+func NewSchemaMigrator(db *gorm.DB) (*SchemaMigrator, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Exec("CREATE TABLE IF NOT EXISTS `schema_migrations` (" +
+		"`version` INT NOT NULL, " +
+		"`name` VARCHAR(255) NOT NULL, " +
+		"`applied_at` DATETIME NOT NULL, " +
+		"PRIMARY KEY (`version`)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4").Error; err != nil {
+		return nil, fmt.Errorf("创建 schema_migrations 表失败: %v", err)
+	}
+
+	return &SchemaMigrator{db: db, migrations: migrations}, nil
+}
+
+// applied 获取已执行的迁移版本
+func (m *SchemaMigrator) applied() (map[int]SchemaMigration, error) {
+	var records []SchemaMigration
+	if err := m.db.Order("version asc").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("读取迁移记录失败: %v", err)
+	}
+
+	result := make(map[int]SchemaMigration, len(records))
+	for _, r := range records {
+		result[r.Version] = r
+	}
+	return result, nil
+}
+
+// Up 按顺序执行未执行的迁移，steps <= 0 表示全部执行
+func (m *SchemaMigrator) Up(steps int) (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range m.migrations {
+		if _, done := applied[migration.Version]; done {
+			continue
+		}
+		if steps > 0 && count >= steps {
+			break
+		}
+
+		appLogger.Info(fmt.Sprintf("执行数据库迁移: %04d_%s", migration.Version, migration.Name))
+		// MySQL的DDL会隐式提交事务，这里逐条执行，成功后再记录版本
+		if err := migration.Up(m.db); err != nil {
+			return count, fmt.Errorf("迁移 %04d_%s 执行失败: %v", migration.Version, migration.Name, err)
+		}
+		if err := m.db.Create(&SchemaMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now(),
+		}).Error; err != nil {
+			return count, fmt.Errorf("记录迁移 %04d_%s 失败: %v", migration.Version, migration.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Down 按倒序回滚已执行的迁移，steps <= 0 时回滚1个
+func (m *SchemaMigrator) Down(steps int) (int, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+		migration := m.migrations[i]
+		if _, done := applied[migration.Version]; !done {
+			continue
+		}
+		if migration.Down == nil {
+			return count, fmt.Errorf("迁移 %04d_%s 没有 down 脚本，无法回滚", migration.Version, migration.Name)
+		}
+
+		appLogger.Info(fmt.Sprintf("回滚数据库迁移: %04d_%s", migration.Version, migration.Name))
+		if err := migration.Down(m.db); err != nil {
+			return count, fmt.Errorf("回滚 %04d_%s 失败: %v", migration.Version, migration.Name, err)
+		}
+		if err := m.db.Where("version = ?", migration.Version).Delete(&SchemaMigration{}).Error; err != nil {
+			return count, fmt.Errorf("删除迁移记录 %04d_%s 失败: %v", migration.Version, migration.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Status 获取所有迁移的执行状态
+func (m *SchemaMigrator) Status() ([]MigrationState, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		state := MigrationState{Version: migration.Version, Name: migration.Name}
+		if record, done := applied[migration.Version]; done {
+			state.Applied = true
+			appliedAt := record.AppliedAt
+			state.AppliedAt = &appliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// runMigrateCommand 执行命令行迁移子命令: migrate up [N] | down [N] | status
+func runMigrateCommand(db *gorm.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("用法: logsvr migrate up [N] | down [N] | status")
+	}
+
+	migrator, err := NewSchemaMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	steps := 0
+	if len(args) > 1 {
+		steps, err = strconv.Atoi(args[1])
+		if err != nil || steps < 0 {
+			return fmt.Errorf("无效的步数: %s", args[1])
+		}
+	}
+
+	switch args[0] {
+	case "up":
+		count, err := migrator.Up(steps)
+		fmt.Printf("已执行 %d 个迁移\n", count)
+		return err
+	case "down":
+		count, err := migrator.Down(steps)
+		fmt.Printf("已回滚 %d 个迁移\n", count)
+		return err
+	case "status":
+		states, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-8s %-32s %-10s %s\n", "VERSION", "NAME", "STATUS", "APPLIED AT")
+		for _, s := range states {
+			status, appliedAt := "pending", "-"
+			if s.Applied {
+				status = "applied"
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d     %-32s %-10s %s\n", s.Version, s.Name, status, appliedAt)
+		}
+		return nil
+	default:
+		return fmt.Errorf("未知的迁移命令: %s（可用: up, down, status）", args[0])
+	}
+}
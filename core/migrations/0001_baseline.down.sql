@@ -0,0 +1,5 @@
+-- 警告：回滚基础表结构会删除所有数据
+DROP TABLE IF EXISTS `log_users`;
+DROP TABLE IF EXISTS `pay_report`;
+DROP TABLE IF EXISTS `player`;
+DROP TABLE IF EXISTS `online_num`;
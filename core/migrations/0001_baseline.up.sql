@@ -0,0 +1,62 @@
+-- 基础表结构（与此前 AutoMigrate 生成的结构一致，已存在的表不受影响）
+
+CREATE TABLE IF NOT EXISTS `online_num` (
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `created_at` DATETIME(3) NULL,
+    `updated_at` DATETIME(3) NULL,
+    `deleted_at` DATETIME(3) NULL,
+    `gamesvr_id` INT NOT NULL,
+    `online_num` INT NOT NULL,
+    `date_int` INT NOT NULL DEFAULT 0 COMMENT '日期整型字段，格式：YYYYMMDD',
+    PRIMARY KEY (`id`),
+    INDEX `idx_online_num_deleted_at` (`deleted_at`),
+    INDEX `idx_date_gamesvr` (`date_int`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `player` (
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `created_at` DATETIME(3) NULL,
+    `updated_at` DATETIME(3) NULL,
+    `deleted_at` DATETIME(3) NULL,
+    `roleid` VARCHAR(50) NOT NULL,
+    `name` VARCHAR(100) NOT NULL,
+    `level` INT NOT NULL,
+    `gamesvr` INT NOT NULL,
+    `new_player` INT DEFAULT 0,
+    `date_int` INT NOT NULL DEFAULT 0 COMMENT '日期整型字段，格式：YYYYMMDD',
+    PRIMARY KEY (`id`),
+    INDEX `idx_player_deleted_at` (`deleted_at`),
+    INDEX `idx_date_gamesvr` (`date_int`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `pay_report` (
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `created_at` DATETIME(3) NULL,
+    `updated_at` DATETIME(3) NULL,
+    `deleted_at` DATETIME(3) NULL,
+    `roleid` VARCHAR(50) NOT NULL,
+    `name` VARCHAR(100) NOT NULL,
+    `level` INT NOT NULL,
+    `gamesvr` INT NOT NULL,
+    `money` INT NOT NULL,
+    `vip_level` INT NOT NULL DEFAULT 0,
+    `date_int` INT NOT NULL DEFAULT 0 COMMENT '日期整型字段，格式：YYYYMMDD',
+    PRIMARY KEY (`id`),
+    INDEX `idx_pay_report_deleted_at` (`deleted_at`),
+    INDEX `idx_date_gamesvr` (`date_int`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `log_users` (
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `created_at` DATETIME(3) NULL,
+    `updated_at` DATETIME(3) NULL,
+    `deleted_at` DATETIME(3) NULL,
+    `username` VARCHAR(50) NOT NULL,
+    `password` VARCHAR(64) NOT NULL,
+    `display_name` VARCHAR(100) NOT NULL,
+    `is_active` BOOL DEFAULT true,
+    `last_login` DATETIME NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_log_users_username` (`username`),
+    INDEX `idx_log_users_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
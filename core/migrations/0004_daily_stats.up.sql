@@ -0,0 +1,17 @@
+-- 每日汇总表：按 (业务日期, 区服) 预计算，gamesvr = 0 为全服汇总
+
+CREATE TABLE IF NOT EXISTS `daily_stats` (
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `date_int` INT NOT NULL,
+    `gamesvr` INT NOT NULL,
+    `active_players` INT NOT NULL DEFAULT 0,
+    `new_players` INT NOT NULL DEFAULT 0,
+    `paying_players` INT NOT NULL DEFAULT 0,
+    `total_payment` BIGINT NOT NULL DEFAULT 0,
+    `peak_online` INT NOT NULL DEFAULT 0,
+    `avg_online` INT NOT NULL DEFAULT 0,
+    `stale` BOOL NOT NULL DEFAULT false,
+    `finalized_at` DATETIME NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `uk_date_gamesvr` (`date_int`, `gamesvr`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `player_archive`;
+DROP TABLE IF EXISTS `pay_report_archive`;
+DROP TABLE IF EXISTS `online_num_hourly`;
@@ -0,0 +1,20 @@
+-- 在线人数小时聚合表：超过保留期的原始 online_num 数据降采样后写入此表
+
+CREATE TABLE IF NOT EXISTS `online_num_hourly` (
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `date_int` INT NOT NULL,
+    `hour_time` DATETIME NOT NULL,
+    `gamesvr_id` INT NOT NULL,
+    `peak_online` INT NOT NULL DEFAULT 0,
+    `avg_online` INT NOT NULL DEFAULT 0,
+    `samples` INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `uk_hour_gamesvr` (`hour_time`, `gamesvr_id`),
+    INDEX `idx_date_gamesvr` (`date_int`, `gamesvr_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 归档表（archiveMode: table 时使用），结构与原始表一致
+
+CREATE TABLE IF NOT EXISTS `pay_report_archive` LIKE `pay_report`;
+
+CREATE TABLE IF NOT EXISTS `player_archive` LIKE `player`;
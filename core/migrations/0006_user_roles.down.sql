@@ -0,0 +1 @@
+ALTER TABLE `log_users` DROP COLUMN `role`;
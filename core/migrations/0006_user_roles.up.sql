@@ -0,0 +1,8 @@
+-- 用户角色：admin / operator / analyst / viewer
+-- 已有用户此前拥有全部权限，root 设为管理员，其余用户设为分析师（可查看全部数据，不能管理用户）
+
+ALTER TABLE `log_users` ADD COLUMN `role` VARCHAR(20) NOT NULL DEFAULT 'viewer' AFTER `display_name`;
+
+UPDATE `log_users` SET `role` = 'analyst' WHERE `username` <> 'root';
+
+UPDATE `log_users` SET `role` = 'admin' WHERE `username` = 'root';
@@ -0,0 +1,3 @@
+-- 用户可访问的区服范围（空表示全部区服），格式见 scope.go
+
+ALTER TABLE `log_users` ADD COLUMN `allowed_servers` VARCHAR(1000) NOT NULL DEFAULT '' AFTER `role`;
@@ -0,0 +1,2 @@
+-- 注意：回滚前需确保没有超过64字符的密码哈希，否则回滚会失败
+ALTER TABLE `log_users` MODIFY COLUMN `password` VARCHAR(64) NOT NULL;
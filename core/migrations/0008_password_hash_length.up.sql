@@ -0,0 +1,4 @@
+-- 密码改为 bcrypt 哈希（60字符），预留长度以便将来更换算法
+-- 旧的 SHA-256 哈希在用户下次登录成功后自动升级
+
+ALTER TABLE `log_users` MODIFY COLUMN `password` VARCHAR(255) NOT NULL;
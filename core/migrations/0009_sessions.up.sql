@@ -0,0 +1,14 @@
+-- 登录会话表（session.store 为 db 时使用），id 为会话令牌的 SHA-256，不保存原始令牌
+
+CREATE TABLE IF NOT EXISTS `log_sessions` (
+    `id` CHAR(64) NOT NULL,
+    `username` VARCHAR(50) NOT NULL,
+    `created_at` DATETIME NOT NULL,
+    `expires_at` DATETIME NOT NULL,
+    `last_seen` DATETIME NOT NULL,
+    `ip` VARCHAR(64) NOT NULL DEFAULT '',
+    `user_agent` VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (`id`),
+    INDEX `idx_username` (`username`),
+    INDEX `idx_expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS `system_settings`;
+
+ALTER TABLE `log_users`
+    DROP COLUMN `recovery_codes`,
+    DROP COLUMN `totp_last_counter`,
+    DROP COLUMN `totp_enabled`,
+    DROP COLUMN `totp_secret`;
@@ -0,0 +1,17 @@
+-- TOTP两步验证：密钥、是否启用、最近一次使用的时间步（防重放）、恢复码哈希(JSON数组)
+
+ALTER TABLE `log_users`
+    ADD COLUMN `totp_secret` VARCHAR(64) NOT NULL DEFAULT '' AFTER `allowed_servers`,
+    ADD COLUMN `totp_enabled` BOOL NOT NULL DEFAULT false AFTER `totp_secret`,
+    ADD COLUMN `totp_last_counter` BIGINT NOT NULL DEFAULT 0 AFTER `totp_enabled`,
+    ADD COLUMN `recovery_codes` VARCHAR(1024) NOT NULL DEFAULT '' AFTER `totp_last_counter`;
+
+-- 系统设置（可在管理页面修改、无需重启的开关）
+
+CREATE TABLE IF NOT EXISTS `system_settings` (
+    `name` VARCHAR(64) NOT NULL,
+    `value` VARCHAR(255) NOT NULL,
+    `updated_at` DATETIME NOT NULL,
+    `updated_by` VARCHAR(50) NOT NULL DEFAULT '',
+    PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
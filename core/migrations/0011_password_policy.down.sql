@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS `log_password_history`;
+
+ALTER TABLE `log_users`
+    DROP COLUMN `password_changed_at`,
+    DROP COLUMN `must_change_password`;
@@ -0,0 +1,16 @@
+-- 强制修改密码：默认管理员首次登录、管理员重置密码后需要用户自行修改
+
+ALTER TABLE `log_users`
+    ADD COLUMN `must_change_password` BOOL NOT NULL DEFAULT false AFTER `recovery_codes`,
+    ADD COLUMN `password_changed_at` DATETIME NULL AFTER `must_change_password`;
+
+-- 历史密码哈希，用于禁止重复使用最近的密码
+
+CREATE TABLE IF NOT EXISTS `log_password_history` (
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `username` VARCHAR(50) NOT NULL,
+    `password` VARCHAR(255) NOT NULL,
+    `created_at` DATETIME NOT NULL,
+    PRIMARY KEY (`id`),
+    KEY `idx_password_history_username` (`username`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,17 @@
+-- 个人API令牌，token_hash 为令牌的 SHA-256，不保存原始令牌
+
+CREATE TABLE IF NOT EXISTS `log_api_tokens` (
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `username` VARCHAR(50) NOT NULL,
+    `name` VARCHAR(100) NOT NULL,
+    `token_hash` CHAR(64) NOT NULL,
+    `prefix` VARCHAR(16) NOT NULL,
+    `scopes` VARCHAR(255) NOT NULL DEFAULT '',
+    `expires_at` DATETIME NULL,
+    `last_used_at` DATETIME NULL,
+    `last_used_ip` VARCHAR(45) NOT NULL DEFAULT '',
+    `created_at` DATETIME NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_api_tokens_hash` (`token_hash`),
+    KEY `idx_api_tokens_username` (`username`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
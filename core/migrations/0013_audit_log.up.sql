@@ -0,0 +1,16 @@
+-- 审计日志：记录用户管理、缓存、系统设置等管理操作
+
+CREATE TABLE IF NOT EXISTS `audit_log` (
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `created_at` DATETIME NOT NULL,
+    `actor` VARCHAR(50) NOT NULL,
+    `action` VARCHAR(50) NOT NULL,
+    `target` VARCHAR(255) NOT NULL DEFAULT '',
+    `before_value` TEXT NULL,
+    `after_value` TEXT NULL,
+    `ip` VARCHAR(45) NOT NULL DEFAULT '',
+    PRIMARY KEY (`id`),
+    KEY `idx_audit_created_at` (`created_at`),
+    KEY `idx_audit_actor` (`actor`),
+    KEY `idx_audit_target` (`target`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,4 @@
+ALTER TABLE `log_users`
+    DROP KEY `idx_log_users_external`,
+    DROP COLUMN `external_id`,
+    DROP COLUMN `auth_source`;
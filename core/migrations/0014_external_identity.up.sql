@@ -0,0 +1,6 @@
+-- 外部身份认证：记录用户的认证来源和外部身份标识（OIDC 自动创建的用户）
+
+ALTER TABLE `log_users`
+    ADD COLUMN `auth_source` VARCHAR(20) NOT NULL DEFAULT 'local' AFTER `password_changed_at`,
+    ADD COLUMN `external_id` VARCHAR(255) NOT NULL DEFAULT '' AFTER `auth_source`,
+    ADD KEY `idx_log_users_external` (`auth_source`, `external_id`);
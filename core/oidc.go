@@ -0,0 +1,664 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OIDCConfig OpenID Connect 登录配置
+type OIDCConfig struct {
+	Enabled          bool              `yaml:"enabled"`
+	Issuer           string            `yaml:"issuer"`           // 身份提供方地址，从 {issuer}/.well-known/openid-configuration 获取端点
+	ClientID         string            `yaml:"clientId"`         // 客户端ID
+	ClientSecret     string            `yaml:"clientSecret"`     // 客户端密钥，公共客户端（仅PKCE）可为空
+	RedirectURL      string            `yaml:"redirectUrl"`      // 回调地址，如 https://logsvr.example.com/login/oidc/callback
+	Scopes           []string          `yaml:"scopes"`           // 默认 openid profile email
+	ButtonLabel      string            `yaml:"buttonLabel"`      // 登录页按钮文字，默认“使用统一身份认证登录”
+	UsernameClaim    string            `yaml:"usernameClaim"`    // 用户名声明，默认 preferred_username
+	DisplayNameClaim string            `yaml:"displayNameClaim"` // 显示名称声明，默认 name
+	GroupsClaim      string            `yaml:"groupsClaim"`      // 用户组声明，默认 groups
+	DefaultRole      string            `yaml:"defaultRole"`      // 首次登录自动创建用户时的角色，默认 viewer
+	GroupRoles       map[string]string `yaml:"groupRoles"`       // 用户组 -> 角色，匹配多个时取权限最高的角色，每次登录同步
+}
+
+const (
+	// oidcStateTTL 发起登录到回调之间的最长时间
+	oidcStateTTL = 10 * time.Minute
+	// oidcStateCookie 绑定浏览器的 state Cookie，防止登录CSRF
+	oidcStateCookie = "logsvr_oidc_state"
+	// oidcKeysRefreshInterval 签名公钥的刷新间隔，遇到未知 kid 时最多每分钟刷新一次
+	oidcKeysRefreshInterval = time.Hour
+	// oidcClockSkew 校验 ID Token 有效期时允许的时钟偏差
+	oidcClockSkew = time.Minute
+)
+
+// oidcMetadata 身份提供方发现文档中用到的字段
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcLoginState 发起登录时生成的 state、nonce 和 PKCE 校验码
+type oidcLoginState struct {
+	Nonce     string
+	Verifier  string
+	ExpiresAt time.Time
+}
+
+// OIDCProvider OpenID Connect 身份提供方客户端
+type OIDCProvider struct {
+	config OIDCConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	metadata      *oidcMetadata
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+	states        map[string]*oidcLoginState
+}
+
+// 全局OIDC客户端实例，未启用时为 nil
+var oidcProvider *OIDCProvider
+
+// InitOIDC 根据配置初始化OIDC登录，发现文档在首次登录时获取
+func InitOIDC(config OIDCConfig) error {
+	if !config.Enabled {
+		oidcProvider = nil
+		return nil
+	}
+
+	config.Issuer = strings.TrimRight(config.Issuer, "/")
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return fmt.Errorf("issuer、clientId 和 redirectUrl 不能为空")
+	}
+	if _, err := url.Parse(config.RedirectURL); err != nil {
+		return fmt.Errorf("无效的 redirectUrl '%s'", config.RedirectURL)
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	} else if !containsString(config.Scopes, "openid") {
+		config.Scopes = append([]string{"openid"}, config.Scopes...)
+	}
+	if config.ButtonLabel == "" {
+		config.ButtonLabel = "使用统一身份认证登录"
+	}
+	if config.UsernameClaim == "" {
+		config.UsernameClaim = "preferred_username"
+	}
+	if config.DisplayNameClaim == "" {
+		config.DisplayNameClaim = "name"
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if config.DefaultRole == "" {
+		config.DefaultRole = RoleViewer
+	}
+	if !IsValidRole(config.DefaultRole) {
+		return fmt.Errorf("无效的默认角色 '%s'", config.DefaultRole)
+	}
+	for group, role := range config.GroupRoles {
+		if !IsValidRole(role) {
+			return fmt.Errorf("用户组 '%s' 映射的角色 '%s' 无效", group, role)
+		}
+	}
+
+	oidcProvider = &OIDCProvider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		states: make(map[string]*oidcLoginState),
+	}
+	appLogger.Info(fmt.Sprintf("OIDC登录已启用: issuer=%s, clientId=%s, 默认角色=%s, 用户组映射 %d 项",
+		config.Issuer, config.ClientID, config.DefaultRole, len(config.GroupRoles)))
+	return nil
+}
+
+// containsString 判断字符串切片是否包含指定值
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getJSON 请求身份提供方接口并解析JSON响应
+func (p *OIDCProvider) getJSON(endpoint, accessToken string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回状态码 %d", endpoint, resp.StatusCode)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// discover 获取发现文档（成功后缓存）
+func (p *OIDCProvider) discover() (*oidcMetadata, error) {
+	p.mu.Lock()
+	metadata := p.metadata
+	p.mu.Unlock()
+	if metadata != nil {
+		return metadata, nil
+	}
+
+	var doc oidcMetadata
+	if err := p.getJSON(p.config.Issuer+"/.well-known/openid-configuration", "", &doc); err != nil {
+		return nil, fmt.Errorf("获取OIDC发现文档失败: %v", err)
+	}
+	if strings.TrimRight(doc.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("发现文档中的 issuer '%s' 与配置不一致", doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("发现文档缺少 authorization_endpoint、token_endpoint 或 jwks_uri")
+	}
+
+	p.mu.Lock()
+	p.metadata = &doc
+	p.mu.Unlock()
+	return &doc, nil
+}
+
+// jsonWebKey JWKS 中的公钥
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey 将 JWK 转换为公钥，不支持的类型返回 nil
+func (k *jsonWebKey) publicKey() crypto.PublicKey {
+	decode := func(s string) *big.Int {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil
+		}
+		return new(big.Int).SetBytes(b)
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, e := decode(k.N), decode(k.E)
+		if n == nil || e == nil || !e.IsInt64() {
+			return nil
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil
+		}
+		x, y := decode(k.X), decode(k.Y)
+		if x == nil || y == nil || !curve.IsOnCurve(x, y) {
+			return nil
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	}
+	return nil
+}
+
+// lookupKey 按 kid 查找公钥，令牌未指定 kid 且只有一个公钥时直接使用
+func lookupKey(keys map[string]crypto.PublicKey, kid string) (crypto.PublicKey, bool) {
+	if key, ok := keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// signingKey 按 kid 获取签名公钥，缓存过期或找不到 kid 时重新获取 JWKS
+func (p *OIDCProvider) signingKey(jwksURI, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := lookupKey(p.keys, kid)
+	age := time.Since(p.keysFetchedAt)
+	p.mu.Unlock()
+	if ok && age < oidcKeysRefreshInterval {
+		return key, nil
+	}
+	if !ok && age < time.Minute {
+		return nil, fmt.Errorf("未找到签名公钥 kid=%s", kid)
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(jwksURI, "", &jwks); err != nil {
+		return nil, fmt.Errorf("获取签名公钥失败: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for i := range jwks.Keys {
+		if jwks.Keys[i].Use != "" && jwks.Keys[i].Use != "sig" {
+			continue
+		}
+		if pub := jwks.Keys[i].publicKey(); pub != nil {
+			keys[jwks.Keys[i].Kid] = pub
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	p.mu.Unlock()
+
+	if key, ok := lookupKey(keys, kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("未找到签名公钥 kid=%s", kid)
+}
+
+// verifySignature 按 alg 校验 JWS 签名（只支持 RS* 和 ES* 非对称算法）
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("不支持的签名算法 %s", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"):
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("签名算法 %s 与公钥类型不匹配", alg)
+		}
+		return rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+	case strings.HasPrefix(alg, "ES"):
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("签名算法 %s 与公钥类型不匹配", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("签名长度错误")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("签名校验失败")
+		}
+		return nil
+	}
+	return fmt.Errorf("不支持的签名算法 %s", alg)
+}
+
+// verifyIDToken 校验 ID Token 的签名、issuer、audience、有效期和 nonce，返回声明
+func (p *OIDCProvider) verifyIDToken(metadata *oidcMetadata, rawToken, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("ID Token 格式错误")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("ID Token 头部解码失败")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("ID Token 头部解析失败")
+	}
+	if len(header.Alg) != 5 || !(strings.HasPrefix(header.Alg, "RS") || strings.HasPrefix(header.Alg, "ES")) {
+		return nil, fmt.Errorf("不支持的签名算法 '%s'", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("ID Token 签名解码失败")
+	}
+	key, err := p.signingKey(metadata.JWKSURI, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, fmt.Errorf("ID Token 签名校验失败: %v", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("ID Token 内容解码失败")
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("ID Token 内容解析失败")
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimRight(iss, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("ID Token issuer '%s' 不匹配", iss)
+	}
+	audiences := claimStrings(claims["aud"])
+	if !containsString(audiences, p.config.ClientID) {
+		return nil, fmt.Errorf("ID Token audience 不包含当前客户端")
+	}
+	if azp, ok := claims["azp"].(string); ok && len(audiences) > 1 && azp != p.config.ClientID {
+		return nil, fmt.Errorf("ID Token azp '%s' 不匹配", azp)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || time.Now().Add(-oidcClockSkew).After(time.Unix(int64(exp), 0)) {
+		return nil, fmt.Errorf("ID Token 已过期")
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("ID Token nonce 不匹配")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("ID Token 缺少 sub")
+	}
+	return claims, nil
+}
+
+// claimStrings 将字符串或字符串数组类型的声明转换为切片
+func claimStrings(v interface{}) []string {
+	switch value := v.(type) {
+	case string:
+		if value == "" {
+			return nil
+		}
+		return []string{value}
+	case []interface{}:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok && s != "" {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// pkceChallenge 计算 PKCE S256 校验值
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthorizationURL 生成跳转到身份提供方的授权地址，返回 state
+func (p *OIDCProvider) AuthorizationURL() (string, string, error) {
+	metadata, err := p.discover()
+	if err != nil {
+		return "", "", err
+	}
+
+	state := generateSessionID()
+	loginState := &oidcLoginState{
+		Nonce:     generateSessionID(),
+		Verifier:  generateSessionID() + generateSessionID(),
+		ExpiresAt: time.Now().Add(oidcStateTTL),
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	for k, s := range p.states {
+		if now.After(s.ExpiresAt) {
+			delete(p.states, k)
+		}
+	}
+	p.states[state] = loginState
+	p.mu.Unlock()
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", loginState.Nonce)
+	params.Set("code_challenge", pkceChallenge(loginState.Verifier))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + params.Encode(), state, nil
+}
+
+// takeState 取出并删除登录 state（每个 state 只能使用一次）
+func (p *OIDCProvider) takeState(state string) (*oidcLoginState, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	loginState, ok := p.states[state]
+	if !ok {
+		return nil, false
+	}
+	delete(p.states, state)
+	if time.Now().After(loginState.ExpiresAt) {
+		return nil, false
+	}
+	return loginState, true
+}
+
+// exchangeCode 用授权码和 PKCE 校验码换取令牌，返回已校验的 ID Token 声明
+func (p *OIDCProvider) exchangeCode(code string, loginState *oidcLoginState) (map[string]interface{}, error) {
+	metadata, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", loginState.Verifier)
+	form.Set("client_id", p.config.ClientID)
+
+	req, err := http.NewRequest(http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求令牌接口失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResponse struct {
+		IDToken          string `json:"id_token"`
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("读取令牌响应失败: %v", err)
+	}
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return nil, fmt.Errorf("解析令牌响应失败（状态码 %d）", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || tokenResponse.Error != "" {
+		return nil, fmt.Errorf("令牌接口返回错误: %s %s", tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+	if tokenResponse.IDToken == "" {
+		return nil, fmt.Errorf("令牌响应中没有 id_token")
+	}
+
+	claims, err := p.verifyIDToken(metadata, tokenResponse.IDToken, loginState.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// ID Token 中没有用户名或用户组时从 userinfo 接口补充
+	_, hasUsername := claims[p.config.UsernameClaim]
+	_, hasGroups := claims[p.config.GroupsClaim]
+	if (!hasUsername || !hasGroups) && metadata.UserinfoEndpoint != "" && tokenResponse.AccessToken != "" {
+		var userinfo map[string]interface{}
+		if err := p.getJSON(metadata.UserinfoEndpoint, tokenResponse.AccessToken, &userinfo); err != nil {
+			appLogger.Warning(fmt.Sprintf("获取OIDC用户信息失败: %v", err))
+		} else if userinfo["sub"] == claims["sub"] {
+			for k, v := range userinfo {
+				if _, exists := claims[k]; !exists {
+					claims[k] = v
+				}
+			}
+		}
+	}
+	return claims, nil
+}
+
+// OIDCLoginHandler 发起OIDC登录，跳转到身份提供方
+func OIDCLoginHandler(c *gin.Context) {
+	if oidcProvider == nil {
+		c.Redirect(http.StatusFound, "/login?error="+url.QueryEscape("未启用统一身份认证登录"))
+		return
+	}
+
+	authURL, state, err := oidcProvider.AuthorizationURL()
+	if err != nil {
+		appLogger.Error(fmt.Sprintf("发起OIDC登录失败: %v", err))
+		c.Redirect(http.StatusFound, "/login?error="+url.QueryEscape("身份认证服务暂时不可用，请稍后重试"))
+		return
+	}
+
+	// 从身份提供方跳回属于跨站导航，state Cookie 固定使用 SameSite=Lax
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(oidcStateTTL.Seconds()), "/login/oidc", "", sessionManager.secureCookie(c), true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallbackHandler 身份提供方回调：校验 state、换取令牌、创建或同步用户并登录
+func OIDCCallbackHandler(c *gin.Context) {
+	fail := func(message string) {
+		c.Redirect(http.StatusFound, "/login?error="+url.QueryEscape(message))
+	}
+	if oidcProvider == nil {
+		fail("未启用统一身份认证登录")
+		return
+	}
+
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, "/login/oidc", "", sessionManager.secureCookie(c), true)
+
+	if errCode := c.Query("error"); errCode != "" {
+		appLogger.Warning(fmt.Sprintf("OIDC登录被拒绝: error=%s, description=%s, IP=%s", errCode, c.Query("error_description"), c.ClientIP()))
+		fail("身份认证未完成: " + errCode)
+		return
+	}
+	if state == "" || state != cookieState {
+		appLogger.Warning(fmt.Sprintf("OIDC回调 state 不匹配, IP=%s", c.ClientIP()))
+		fail("登录请求已失效，请重新登录")
+		return
+	}
+	loginState, ok := oidcProvider.takeState(state)
+	if !ok {
+		fail("登录请求已过期，请重新登录")
+		return
+	}
+
+	claims, err := oidcProvider.exchangeCode(c.Query("code"), loginState)
+	if err != nil {
+		appLogger.Error(fmt.Sprintf("OIDC登录失败: %v", err))
+		fail("身份认证失败，请重新登录")
+		return
+	}
+
+	config := oidcProvider.config
+	subject, _ := claims["sub"].(string)
+	username, _ := claims[config.UsernameClaim].(string)
+	displayName, _ := claims[config.DisplayNameClaim].(string)
+	groups := claimStrings(claims[config.GroupsClaim])
+	if username == "" {
+		appLogger.Error(fmt.Sprintf("OIDC登录失败: 声明 %s 为空, sub=%s", config.UsernameClaim, subject))
+		fail("身份提供方未返回用户名")
+		return
+	}
+
+	// 用户组匹配到角色时每次登录同步角色，否则新用户使用默认角色、已有用户保留当前角色
+	role := RoleForGroups(groups, config.GroupRoles)
+	user, created, err := userManager.ProvisionExternalUser(AuthSourceOIDC, config.Issuer+"|"+subject, username, displayName, role, config.DefaultRole)
+	if err != nil {
+		appLogger.Error(fmt.Sprintf("OIDC登录失败: 用户=%s, sub=%s: %v", username, subject, err))
+		fail("无法登录: " + err.Error())
+		return
+	}
+	if !user.IsActive {
+		appLogger.Warning(fmt.Sprintf("OIDC登录被拒绝: 用户 %s 已被停用", user.Username))
+		fail("用户已被停用")
+		return
+	}
+
+	session, err := sessionManager.CreateSession(user.Username, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		appLogger.Error("OIDC登录失败: " + err.Error())
+		fail("创建会话失败，请稍后重试")
+		return
+	}
+	setSessionCookie(c, session)
+	go userManager.updateLastLogin(user.Username)
+
+	c.Set("user", user.Username)
+	if created {
+		RecordAudit(c, AuditUserProvision, user.Username, nil, gin.H{"auth_source": AuthSourceOIDC, "role": user.Role, "groups": groups})
+	}
+	appLogger.Info(fmt.Sprintf("用户通过OIDC登录成功: %s (%s), 角色=%s, 用户组=%v", user.Username, user.DisplayName, user.Role, groups))
+	c.Redirect(http.StatusFound, "/")
+}
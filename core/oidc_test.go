@@ -0,0 +1,407 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testOIDCClientID = "logsvr"
+	testOIDCCode     = "test-code"
+)
+
+// testIdP 测试用身份提供方：提供发现文档、JWKS 和令牌接口
+type testIdP struct {
+	server *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string // 授权地址中的 code_challenge，令牌接口据此校验 code_verifier
+	verifier  string // 令牌接口收到的 code_verifier
+	idToken   string // 令牌接口返回的 ID Token
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("生成RSA密钥失败: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成EC密钥失败: %v", err)
+	}
+	idp := &testIdP{rsaKey: rsaKey, ecKey: ecKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcMetadata{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		coordinate := func(v *big.Int) string {
+			return base64.RawURLEncoding.EncodeToString(v.FillBytes(make([]byte, 32)))
+		}
+		json.NewEncoder(w).Encode(gin.H{"keys": []jsonWebKey{
+			{
+				Kid: "rsa-1", Kty: "RSA", Use: "sig",
+				N: base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				Kid: "ec-1", Kty: "EC", Use: "sig", Crv: "P-256",
+				X: coordinate(ecKey.X), Y: coordinate(ecKey.Y),
+			},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+
+		r.ParseForm()
+		idp.verifier = r.PostForm.Get("code_verifier")
+		if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != testOIDCCode ||
+			r.PostForm.Get("client_id") != testOIDCClientID || pkceChallenge(idp.verifier) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(gin.H{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(gin.H{"id_token": idp.idToken, "access_token": "access-token", "token_type": "Bearer"})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// setToken 设置令牌接口下次返回的 ID Token
+func (idp *testIdP) setToken(token string) {
+	idp.mu.Lock()
+	idp.idToken = token
+	idp.mu.Unlock()
+}
+
+// claims 生成一份有效的 ID Token 声明
+func (idp *testIdP) claims(nonce string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":                idp.server.URL,
+		"aud":                testOIDCClientID,
+		"sub":                "u-1001",
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+		"nonce":              nonce,
+		"preferred_username": "alice",
+		"name":               "Alice",
+		"groups":             []string{"ops"},
+	}
+}
+
+// sign 按 alg 签名生成 JWT
+func (idp *testIdP) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("序列化JWT失败: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(gin.H{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch alg {
+	case "RS256":
+		sig, err := rsa.SignPKCS1v15(rand.Reader, idp.rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("RSA签名失败: %v", err)
+		}
+		signature = sig
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, idp.ecKey, digest[:])
+		if err != nil {
+			t.Fatalf("EC签名失败: %v", err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case "HS256":
+		// 以 RSA 公钥作为 HMAC 密钥，模拟算法混淆攻击
+		mac := hmac.New(sha256.New, idp.rsaKey.PublicKey.N.Bytes())
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "none":
+	default:
+		t.Fatalf("不支持的测试签名算法 %s", alg)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// setupOIDC 启用指向测试身份提供方的OIDC登录
+func setupOIDC(t *testing.T, idp *testIdP) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	err := InitOIDC(OIDCConfig{
+		Enabled:     true,
+		Issuer:      idp.server.URL,
+		ClientID:    testOIDCClientID,
+		RedirectURL: "https://logsvr.example.com/login/oidc/callback",
+		GroupRoles:  map[string]string{"ops": RoleOperator, "admins": RoleAdmin},
+	})
+	if err != nil {
+		t.Fatalf("初始化OIDC失败: %v", err)
+	}
+	t.Cleanup(func() { oidcProvider = nil })
+}
+
+// startLogin 发起登录，返回 state 和授权地址中的 nonce，并让身份提供方记住 code_challenge
+func startLogin(t *testing.T, idp *testIdP) (state, nonce string) {
+	t.Helper()
+
+	authURL, state, err := oidcProvider.AuthorizationURL()
+	if err != nil {
+		t.Fatalf("生成授权地址失败: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("授权地址格式错误: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("state") != state || query.Get("code_challenge_method") != "S256" || query.Get("client_id") != testOIDCClientID {
+		t.Fatalf("授权地址参数错误: %s", authURL)
+	}
+
+	idp.mu.Lock()
+	idp.challenge = query.Get("code_challenge")
+	idp.mu.Unlock()
+	return state, query.Get("nonce")
+}
+
+// oidcCallback 请求回调接口，cookieState 为浏览器携带的 state Cookie
+func oidcCallback(state, cookieState string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.GET("/login/oidc/callback", OIDCCallbackHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/login/oidc/callback?"+url.Values{"state": {state}, "code": {testOIDCCode}}.Encode(), nil)
+	if cookieState != "" {
+		req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: cookieState})
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// assertLoginSucceeded 回调成功：跳转首页并设置会话Cookie
+func assertLoginSucceeded(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || location != "/" {
+		t.Fatalf("期望登录成功跳转到 /，实际 %d %s", w.Code, location)
+	}
+	if !strings.Contains(strings.Join(w.Header().Values("Set-Cookie"), "\n"), CookieName+"=") {
+		t.Fatalf("登录成功后没有设置会话Cookie")
+	}
+}
+
+// assertLoginFailed 回调失败：跳回登录页显示错误，且没有设置会话Cookie
+func assertLoginFailed(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || !strings.HasPrefix(location, "/login?error=") {
+		t.Fatalf("期望登录失败跳转到登录页，实际 %d %s", w.Code, location)
+	}
+	if strings.Contains(strings.Join(w.Header().Values("Set-Cookie"), "\n"), CookieName+"=") {
+		t.Fatalf("登录失败时不应设置会话Cookie")
+	}
+}
+
+func TestOIDCLoginProvisionsUserWithGroupRole(t *testing.T) {
+	idp := newTestIdP(t)
+	setupOIDC(t, idp)
+	newTestUserManager(t)
+
+	state, nonce := startLogin(t, idp)
+	idp.setToken(idp.sign(t, "RS256", "rsa-1", idp.claims(nonce)))
+	assertLoginSucceeded(t, oidcCallback(state, state))
+
+	idp.mu.Lock()
+	verifier, challenge := idp.verifier, idp.challenge
+	idp.mu.Unlock()
+	if verifier == "" || pkceChallenge(verifier) != challenge {
+		t.Fatalf("令牌接口收到的 code_verifier 与授权地址中的 code_challenge 不匹配")
+	}
+
+	user, ok := userManager.GetUser("alice")
+	if !ok {
+		t.Fatalf("首次登录后应自动创建用户")
+	}
+	if user.Role != RoleOperator || user.AuthSource != AuthSourceOIDC || user.ExternalID != idp.server.URL+"|u-1001" || user.DisplayName != "Alice" {
+		t.Fatalf("自动创建的用户不正确: %+v", user)
+	}
+	if n := testDriver.count("INSERT INTO `log_users`"); n != 1 {
+		t.Fatalf("期望写入1个用户，实际 %d", n)
+	}
+
+	// 再次登录时按用户组同步角色，不重复创建用户
+	claims := idp.claims("")
+	state, claims["nonce"] = startLogin(t, idp)
+	claims["groups"] = []string{"ops", "admins"}
+	idp.setToken(idp.sign(t, "RS256", "rsa-1", claims))
+	assertLoginSucceeded(t, oidcCallback(state, state))
+
+	if user, _ := userManager.GetUser("alice"); user.Role != RoleAdmin {
+		t.Fatalf("期望角色同步为 %s，实际 %s", RoleAdmin, user.Role)
+	}
+	if n := testDriver.count("INSERT INTO `log_users`"); n != 1 {
+		t.Fatalf("再次登录不应创建用户，实际写入 %d 次", n)
+	}
+}
+
+func TestOIDCLoginWithECKey(t *testing.T) {
+	idp := newTestIdP(t)
+	setupOIDC(t, idp)
+	newTestUserManager(t)
+
+	state, nonce := startLogin(t, idp)
+	claims := idp.claims(nonce)
+	delete(claims, "groups")
+	idp.setToken(idp.sign(t, "ES256", "ec-1", claims))
+	assertLoginSucceeded(t, oidcCallback(state, state))
+
+	// 没有匹配的用户组时使用默认角色
+	if user, ok := userManager.GetUser("alice"); !ok || user.Role != RoleViewer {
+		t.Fatalf("期望以默认角色 %s 创建用户，实际 %+v", RoleViewer, user)
+	}
+}
+
+func TestOIDCCallbackRejectsInvalidIDToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		token func(t *testing.T, idp *testIdP, claims map[string]interface{}) string
+	}{
+		{"篡改内容", func(t *testing.T, idp *testIdP, claims map[string]interface{}) string {
+			token := idp.sign(t, "RS256", "rsa-1", claims)
+			claims["groups"] = []string{"admins"}
+			forged := strings.Split(idp.sign(t, "RS256", "rsa-1", claims), ".")
+			parts := strings.Split(token, ".")
+			return parts[0] + "." + forged[1] + "." + parts[2]
+		}},
+		{"alg=none", func(t *testing.T, idp *testIdP, claims map[string]interface{}) string {
+			return idp.sign(t, "none", "", claims)
+		}},
+		{"alg=HS256", func(t *testing.T, idp *testIdP, claims map[string]interface{}) string {
+			return idp.sign(t, "HS256", "rsa-1", claims)
+		}},
+		{"RSA签名声明为ES256", func(t *testing.T, idp *testIdP, claims map[string]interface{}) string {
+			token := idp.sign(t, "RS256", "ec-1", claims)
+			parts := strings.Split(token, ".")
+			header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","kid":"ec-1"}`))
+			return header + "." + parts[1] + "." + parts[2]
+		}},
+		{"issuer不匹配", func(t *testing.T, idp *testIdP, claims map[string]interface{}) string {
+			claims["iss"] = "https://evil.example.com"
+			return idp.sign(t, "RS256", "rsa-1", claims)
+		}},
+		{"audience不匹配", func(t *testing.T, idp *testIdP, claims map[string]interface{}) string {
+			claims["aud"] = []string{"another-client"}
+			return idp.sign(t, "RS256", "rsa-1", claims)
+		}},
+		{"已过期", func(t *testing.T, idp *testIdP, claims map[string]interface{}) string {
+			claims["exp"] = time.Now().Add(-oidcClockSkew - time.Minute).Unix()
+			return idp.sign(t, "RS256", "rsa-1", claims)
+		}},
+		{"nonce不匹配", func(t *testing.T, idp *testIdP, claims map[string]interface{}) string {
+			claims["nonce"] = "another-nonce"
+			return idp.sign(t, "RS256", "rsa-1", claims)
+		}},
+	}
+
+	idp := newTestIdP(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupOIDC(t, idp)
+			newTestUserManager(t)
+
+			state, nonce := startLogin(t, idp)
+			idp.setToken(tt.token(t, idp, idp.claims(nonce)))
+			assertLoginFailed(t, oidcCallback(state, state))
+
+			if _, ok := userManager.GetUser("alice"); ok {
+				t.Fatalf("ID Token 校验失败时不应创建用户")
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejectsInvalidState(t *testing.T) {
+	idp := newTestIdP(t)
+	setupOIDC(t, idp)
+	newTestUserManager(t)
+
+	t.Run("Cookie不匹配", func(t *testing.T) {
+		state, nonce := startLogin(t, idp)
+		idp.setToken(idp.sign(t, "RS256", "rsa-1", idp.claims(nonce)))
+		assertLoginFailed(t, oidcCallback(state, "other-state"))
+		assertLoginFailed(t, oidcCallback(state, ""))
+	})
+
+	t.Run("重复使用", func(t *testing.T) {
+		state, nonce := startLogin(t, idp)
+		idp.setToken(idp.sign(t, "RS256", "rsa-1", idp.claims(nonce)))
+		assertLoginSucceeded(t, oidcCallback(state, state))
+		assertLoginFailed(t, oidcCallback(state, state))
+	})
+
+	t.Run("已过期", func(t *testing.T) {
+		state, nonce := startLogin(t, idp)
+		idp.setToken(idp.sign(t, "RS256", "rsa-1", idp.claims(nonce)))
+
+		oidcProvider.mu.Lock()
+		oidcProvider.states[state].ExpiresAt = time.Now().Add(-time.Second)
+		oidcProvider.mu.Unlock()
+		assertLoginFailed(t, oidcCallback(state, state))
+	})
+}
+
+func TestOIDCLoginCannotTakeOverLocalUser(t *testing.T) {
+	idp := newTestIdP(t)
+	setupOIDC(t, idp)
+	local := localTestUser(t, "alice", "Local-Passw0rd", RoleViewer)
+	newTestUserManager(t, local)
+
+	state, nonce := startLogin(t, idp)
+	claims := idp.claims(nonce)
+	claims["groups"] = []string{"admins"}
+	idp.setToken(idp.sign(t, "RS256", "rsa-1", claims))
+	assertLoginFailed(t, oidcCallback(state, state))
+
+	user, _ := userManager.GetUser("alice")
+	if !user.IsLocal() || user.Role != RoleViewer || user.ExternalID != "" {
+		t.Fatalf("身份提供方的同名用户不应接管本地用户: %+v", user)
+	}
+	if n := testDriver.count("log_users"); n != 0 {
+		t.Fatalf("不应修改用户表，实际执行 %d 条SQL", n)
+	}
+}
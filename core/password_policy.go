@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BootstrapPasswordEnv 指定root初始密码的环境变量，优先于配置文件
+const BootstrapPasswordEnv = "LOGSVR_BOOTSTRAP_PASSWORD"
+
+// PasswordPolicyConfig 密码策略配置
+type PasswordPolicyConfig struct {
+	MinLength         int    `yaml:"minLength"`         // 最小长度，默认 8
+	MinClasses        int    `yaml:"minClasses"`        // 至少包含的字符类别数（大写、小写、数字、符号），默认 2
+	HistorySize       *int   `yaml:"historySize"`       // 不能与最近 N 次使用过的密码相同，默认 3，设为 0 表示不检查
+	BootstrapPassword string `yaml:"bootstrapPassword"` // 首次创建root用户时使用的初始密码，为空时使用默认密码
+}
+
+// PasswordPolicy 密码策略（配置热加载时会修改，读取需要加锁，对外通过 Snapshot 获取）
+type PasswordPolicy struct {
+	mu                sync.RWMutex
+	minLength         int
+	minClasses        int
+	historySize       int
+	bootstrapPassword string
+}
+
+// PasswordPolicySnapshot 密码策略快照（用于接口返回）
+type PasswordPolicySnapshot struct {
+	MinLength   int `json:"min_length"`
+	MinClasses  int `json:"min_classes"`
+	HistorySize int `json:"history_size"`
+}
+
+// 全局密码策略实例
+var passwordPolicy = &PasswordPolicy{minLength: 8, minClasses: 2, historySize: 3}
+
+// Configure 根据配置设置密码策略，未配置的项使用默认值
+func (p *PasswordPolicy) Configure(config PasswordPolicyConfig) error {
+	if config.MinLength < 0 || config.MinClasses < 0 || (config.HistorySize != nil && *config.HistorySize < 0) {
+		return fmt.Errorf("密码策略参数不能为负数")
+	}
+	if config.MinClasses > 4 {
+		return fmt.Errorf("minClasses 最大为 4")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.minLength = 8
+	if config.MinLength > 0 {
+		p.minLength = config.MinLength
+	}
+	p.minClasses = 2
+	if config.MinClasses > 0 {
+		p.minClasses = config.MinClasses
+	}
+	p.historySize = 3
+	if config.HistorySize != nil {
+		p.historySize = *config.HistorySize
+	}
+
+	p.bootstrapPassword = config.BootstrapPassword
+	if env := os.Getenv(BootstrapPasswordEnv); env != "" {
+		p.bootstrapPassword = env
+	}
+	return nil
+}
+
+// Snapshot 获取当前密码策略的副本
+func (p *PasswordPolicy) Snapshot() PasswordPolicySnapshot {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return PasswordPolicySnapshot{MinLength: p.minLength, MinClasses: p.minClasses, HistorySize: p.historySize}
+}
+
+// BootstrapPassword 获取root初始密码，未配置时返回默认密码
+func (p *PasswordPolicy) BootstrapPassword() (password string, configured bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.bootstrapPassword != "" {
+		return p.bootstrapPassword, true
+	}
+	return DefaultPassword, false
+}
+
+// passwordClasses 统计密码包含的字符类别数
+func passwordClasses(password string) int {
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, ok := range []bool{upper, lower, digit, symbol} {
+		if ok {
+			count++
+		}
+	}
+	return count
+}
+
+// Validate 校验密码强度（不含历史密码检查）
+func (p *PasswordPolicy) Validate(username, password string) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if utf8.RuneCountInString(password) < p.minLength {
+		return fmt.Errorf("密码至少需要 %d 位字符", p.minLength)
+	}
+	if passwordClasses(password) < p.minClasses {
+		return fmt.Errorf("密码至少需要包含大写字母、小写字母、数字、符号中的 %d 类", p.minClasses)
+	}
+	if strings.EqualFold(password, username) {
+		return fmt.Errorf("密码不能与用户名相同")
+	}
+	if password == DefaultPassword {
+		return fmt.Errorf("不能使用默认密码")
+	}
+	return nil
+}
+
+// Description 密码要求说明，用于页面提示
+func (p *PasswordPolicy) Description() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	desc := fmt.Sprintf("至少 %d 位，包含大写字母、小写字母、数字、符号中的至少 %d 类", p.minLength, p.minClasses)
+	if p.historySize > 0 {
+		desc += fmt.Sprintf("，不能与最近 %d 次使用过的密码相同", p.historySize)
+	}
+	return desc
+}
+
+// PasswordHistory log_password_history 表记录（用户曾经使用过的密码哈希）
+type PasswordHistory struct {
+	ID        uint      `gorm:"column:id;primaryKey"`
+	Username  string    `gorm:"column:username"`
+	Password  string    `gorm:"column:password"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
+
+// TableName 指定表名
+func (PasswordHistory) TableName() string {
+	return "log_password_history"
+}
+
+// checkPasswordReuse 检查新密码是否与当前密码或最近使用过的密码相同
+func (um *UserManager) checkPasswordReuse(username, currentHash, password string) error {
+	historySize := passwordPolicy.Snapshot().HistorySize
+	if historySize <= 0 {
+		return nil
+	}
+
+	hashes := []string{currentHash}
+	if keep := historySize - 1; keep > 0 {
+		var history []PasswordHistory
+		if err := um.db.Where("username = ?", username).
+			Order("id desc").
+			Limit(keep).
+			Find(&history).Error; err != nil {
+			return fmt.Errorf("查询历史密码失败: %v", err)
+		}
+		for _, h := range history {
+			hashes = append(hashes, h.Password)
+		}
+	}
+
+	for _, hash := range hashes {
+		if ok, _ := verifyPassword(hash, password); ok {
+			return fmt.Errorf("不能使用最近 %d 次使用过的密码", historySize)
+		}
+	}
+	return nil
+}
+
+// recordPasswordHistory 保存被替换的旧密码哈希，只保留最近的记录
+func (um *UserManager) recordPasswordHistory(username, oldHash string) {
+	keep := passwordPolicy.Snapshot().HistorySize - 1
+	if keep <= 0 || oldHash == "" {
+		return
+	}
+
+	if err := um.db.Create(&PasswordHistory{
+		Username:  username,
+		Password:  oldHash,
+		CreatedAt: time.Now(),
+	}).Error; err != nil {
+		appLogger.Error(fmt.Sprintf("保存用户 %s 历史密码失败: %v", username, err))
+		return
+	}
+
+	// 当前密码本身也参与比较，因此历史表只需保留 historySize-1 条
+	var keepIDs []uint
+	if err := um.db.Model(&PasswordHistory{}).
+		Where("username = ?", username).
+		Order("id desc").
+		Limit(keep).
+		Pluck("id", &keepIDs).Error; err != nil || len(keepIDs) == 0 {
+		return
+	}
+	if err := um.db.Where("username = ? AND id NOT IN ?", username, keepIDs).Delete(&PasswordHistory{}).Error; err != nil {
+		appLogger.Error(fmt.Sprintf("清理用户 %s 历史密码失败: %v", username, err))
+	}
+}
+
+// isPasswordChangePath 被要求修改密码的用户在修改前允许访问的路径
+func isPasswordChangePath(path string) bool {
+	switch path {
+	case "/change-password", "/api/current-user", "/api/current-user/password", "/api/password-policy":
+		return true
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"sort"
 	"sync"
 	"time"
+	"unsafe"
 
 	"gorm.io/gorm"
 )
@@ -21,8 +22,9 @@ type PayInfo struct {
 
 // PayRankCache 支付排行榜缓存
 type PayRankCache struct {
-	mu    sync.RWMutex
-	cache map[string]*PayInfo // key: RoleID
+	mu       sync.RWMutex
+	cache    map[string]*PayInfo // key: RoleID
+	loadedAt time.Time           // 最近一次从数据库加载成功的时间，零值表示尚未预热
 }
 
 // 全局支付排行榜缓存实例
@@ -77,20 +79,79 @@ func (c *PayRankCache) ClearCache() {
 	appLogger.Info("每日充值排行榜缓存已清空")
 }
 
-// LoadTodayPayData 从数据库加载今天的支付数据来预热缓存
-func (c *PayRankCache) LoadTodayPayData(db *gorm.DB) {
+// LoadedAt 最近一次从数据库加载成功的时间，零值表示尚未预热
+func (c *PayRankCache) LoadedAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.loadedAt
+}
+
+// 启动预热失败后后台重试的间隔，每次失败翻倍直到上限
+const (
+	payRankWarmupRetryMin = 5 * time.Second
+	payRankWarmupRetryMax = time.Minute
+)
+
+// WarmUp 启动时从数据库加载今日充值数据，失败时在后台重试直到成功
+// （期间 /readyz 返回未就绪；管理员通过缓存管理接口重建成功后也会停止重试）
+func (c *PayRankCache) WarmUp(db *gorm.DB) {
+	if err := c.LoadTodayPayData(db); err == nil {
+		return
+	}
+
+	go func() {
+		delay := payRankWarmupRetryMin
+		for attempt := 1; ; attempt++ {
+			appLogger.Warning(fmt.Sprintf("充值排行榜缓存预热失败，%v 后第 %d 次重试", delay, attempt))
+			time.Sleep(delay)
+			if !c.LoadedAt().IsZero() {
+				appLogger.Info("充值排行榜缓存已由其他方式加载，停止预热重试")
+				return
+			}
+			if err := c.LoadTodayPayData(db); err == nil {
+				appLogger.Info(fmt.Sprintf("充值排行榜缓存预热重试成功（第 %d 次重试）", attempt))
+				return
+			}
+			if delay *= 2; delay > payRankWarmupRetryMax {
+				delay = payRankWarmupRetryMax
+			}
+		}
+	}()
+}
+
+// GetCacheSize 获取缓存中的玩家数量
+func (c *PayRankCache) GetCacheSize() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.cache)
+}
+
+// MemoryUsage 估算缓存占用的内存（字节）
+func (c *PayRankCache) MemoryUsage() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var total int64
+	for key, info := range c.cache {
+		total += mapEntryOverhead + int64(len(key)) + int64(unsafe.Sizeof(*info)) + int64(len(info.RoleID)+len(info.Name))
+	}
+	return total
+}
+
+// LoadTodayPayData 从数据库加载今天的支付数据重建缓存（用于启动预热和手动重建）
+func (c *PayRankCache) LoadTodayPayData(db *gorm.DB) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	now := time.Now()
-	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-
 	var reports []PayReport
-	if err := db.Where("created_at >= ?", startOfDay).Order("created_at asc").Find(&reports).Error; err != nil {
+	if err := db.Where("date_int = ?", GetCurrentDateInt()).Order("created_at asc").Find(&reports).Error; err != nil {
 		appLogger.Error(fmt.Sprintf("从数据库加载今日充值数据失败: %v", err))
-		return
+		return fmt.Errorf("从数据库加载今日充值数据失败: %v", err)
 	}
 
+	c.cache = make(map[string]*PayInfo, len(reports))
+	c.loadedAt = time.Now()
+
 	for _, report := range reports {
 		if existing, ok := c.cache[report.RoleID]; ok {
 			// 玩家存在，累加金额，更新信息
@@ -112,4 +173,5 @@ func (c *PayRankCache) LoadTodayPayData(db *gorm.DB) {
 		}
 	}
 	appLogger.Info(fmt.Sprintf("成功从数据库加载 %d 条今日充值记录，重建 %d 个玩家的缓存", len(reports), len(c.cache)))
+	return nil
 }
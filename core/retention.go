@@ -0,0 +1,467 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 归档方式
+const (
+	ArchiveModeFile  = "file"  // 导出为 gzip 压缩的 JSON Lines 文件
+	ArchiveModeTable = "table" // 移动到 <表名>_archive 归档表
+)
+
+// RetentionConfig 数据保留配置（天数为0表示永久保留）
+type RetentionConfig struct {
+	Enabled             bool   `yaml:"enabled"`
+	OnlineNumDays       int    `yaml:"onlineNumDays"`       // 原始在线人数保留天数，过期后降采样为小时数据
+	OnlineNumHourlyDays int    `yaml:"onlineNumHourlyDays"` // 小时聚合数据保留天数
+	PayReportDays       int    `yaml:"payReportDays"`       // 支付记录保留天数，过期后归档
+	PlayerDays          int    `yaml:"playerDays"`          // 玩家登录记录保留天数，过期后归档
+	ArchiveMode         string `yaml:"archiveMode"`         // file 或 table
+	ArchiveDir          string `yaml:"archiveDir"`          // archiveMode 为 file 时的归档目录
+	BatchSize           int    `yaml:"batchSize"`           // 每批删除/导出的行数
+	MaxDaysPerRun       int    `yaml:"maxDaysPerRun"`       // 每次任务每张表最多处理的天数，避免首次启用时长时间锁表
+	Partitioning        struct {
+		Enabled    bool `yaml:"enabled"`    // 是否按 date_int 自动管理MySQL范围分区
+		FutureDays int  `yaml:"futureDays"` // 提前创建的分区天数
+	} `yaml:"partitioning"`
+}
+
+// OnlineNumHourly 在线人数小时聚合数据
+type OnlineNumHourly struct {
+	ID         uint      `gorm:"primarykey"`
+	DateInt    int       `gorm:"column:date_int;type:int;not null"`
+	HourTime   time.Time `gorm:"column:hour_time;type:datetime;not null"`
+	GameSvrID  int       `gorm:"column:gamesvr_id;type:int;not null"`
+	PeakOnline int       `gorm:"column:peak_online;type:int;not null"`
+	AvgOnline  int       `gorm:"column:avg_online;type:int;not null"`
+	Samples    int       `gorm:"column:samples;type:int;not null"`
+}
+
+// TableName 指定表名
+func (OnlineNumHourly) TableName() string {
+	return "online_num_hourly"
+}
+
+// partitionedTables 按 date_int 分区管理的原始事件表
+var partitionedTables = []string{"online_num", "player", "pay_report"}
+
+// RetentionManager 数据保留管理器：降采样、归档、删除过期数据并维护分区
+type RetentionManager struct {
+	db     *gorm.DB
+	config RetentionConfig
+}
+
+// 全局数据保留管理器实例
+var retentionManager *RetentionManager
+
+// InitRetentionManager 初始化数据保留管理器
+func InitRetentionManager(database *gorm.DB, config RetentionConfig) {
+	if config.ArchiveMode == "" {
+		config.ArchiveMode = ArchiveModeFile
+	}
+	if config.ArchiveDir == "" {
+		config.ArchiveDir = "../archive"
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 5000
+	}
+	if config.MaxDaysPerRun <= 0 {
+		config.MaxDaysPerRun = 31
+	}
+	if config.Partitioning.FutureDays <= 0 {
+		config.Partitioning.FutureDays = 7
+	}
+
+	retentionManager = &RetentionManager{
+		db:     database,
+		config: config,
+	}
+
+	appLogger.Info(fmt.Sprintf("数据保留管理器初始化完成 - 启用: %t, 在线人数: %d天, 小时聚合: %d天, 支付: %d天, 玩家: %d天, 归档方式: %s, 分区: %t",
+		config.Enabled, config.OnlineNumDays, config.OnlineNumHourlyDays, config.PayReportDays, config.PlayerDays, config.ArchiveMode, config.Partitioning.Enabled))
+}
+
+// Run 执行一次数据保留任务
+func (rm *RetentionManager) Run() error {
+	var errs []string
+
+	if rm.config.Partitioning.Enabled {
+		for _, table := range partitionedTables {
+			if err := rm.ensurePartitions(table); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+
+	if rm.config.Enabled {
+		if err := rm.downsampleOnlineNum(); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if err := rm.archiveTable("pay_report", rm.config.PayReportDays); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if err := rm.archiveTable("player", rm.config.PlayerDays); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if err := rm.purgeHourly(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("数据保留任务部分失败: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// cutoffDate 计算保留期截止日期（早于该日期的数据过期）
+func (rm *RetentionManager) cutoffDate(days int) (int, error) {
+	todayStart, err := businessClock.DayStartTime(GetCurrentDateInt())
+	if err != nil {
+		return 0, err
+	}
+	return businessClock.DateOf(todayStart.AddDate(0, 0, -days)), nil
+}
+
+// expiredDates 查询表中早于截止日期的日期（从最早开始，最多 MaxDaysPerRun 个）
+func (rm *RetentionManager) expiredDates(table string, cutoff int) ([]int, error) {
+	var dates []int
+	err := rm.db.Raw(fmt.Sprintf("SELECT DISTINCT date_int FROM `%s` WHERE date_int < ? ORDER BY date_int LIMIT ?", table),
+		cutoff, rm.config.MaxDaysPerRun).Scan(&dates).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询 %s 过期日期失败: %v", table, err)
+	}
+	return dates, nil
+}
+
+// ensureRollup 删除原始数据前确保该日期已生成每日汇总
+func (rm *RetentionManager) ensureRollup(dateInt int) error {
+	var count int64
+	if err := rm.db.Model(&DailyStats{}).Where("date_int = ? AND gamesvr = 0 AND stale = ?", dateInt, false).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 || rollupManager == nil {
+		return nil
+	}
+	return rollupManager.Build(dateInt)
+}
+
+// downsampleOnlineNum 将过期的原始在线人数降采样为小时数据后删除
+func (rm *RetentionManager) downsampleOnlineNum() error {
+	if rm.config.OnlineNumDays <= 0 {
+		return nil
+	}
+
+	cutoff, err := rm.cutoffDate(rm.config.OnlineNumDays)
+	if err != nil {
+		return err
+	}
+	dates, err := rm.expiredDates("online_num", cutoff)
+	if err != nil {
+		return err
+	}
+
+	for _, dateInt := range dates {
+		if err := rm.ensureRollup(dateInt); err != nil {
+			return fmt.Errorf("降采样前生成 %d 每日汇总失败: %v", dateInt, err)
+		}
+
+		result := rm.db.Exec(`
+			INSERT INTO online_num_hourly (date_int, hour_time, gamesvr_id, peak_online, avg_online, samples)
+			SELECT date_int, DATE_FORMAT(created_at, '%Y-%m-%d %H:00:00'), gamesvr_id, MAX(online_num), ROUND(AVG(online_num)), COUNT(*)
+			FROM online_num
+			WHERE date_int = ? AND deleted_at IS NULL
+			GROUP BY date_int, DATE_FORMAT(created_at, '%Y-%m-%d %H:00:00'), gamesvr_id
+			ON DUPLICATE KEY UPDATE
+				peak_online = GREATEST(peak_online, VALUES(peak_online)),
+				avg_online = VALUES(avg_online),
+				samples = VALUES(samples)`, dateInt)
+		if result.Error != nil {
+			return fmt.Errorf("在线人数 %d 降采样失败: %v", dateInt, result.Error)
+		}
+
+		deleted, err := rm.deleteDate("online_num", dateInt)
+		if err != nil {
+			return err
+		}
+		appLogger.Info(fmt.Sprintf("在线人数降采样完成 - 日期: %d, 小时数据: %d 行, 删除原始数据: %d 行", dateInt, result.RowsAffected, deleted))
+	}
+	return nil
+}
+
+// purgeHourly 删除过期的小时聚合数据
+func (rm *RetentionManager) purgeHourly() error {
+	if rm.config.OnlineNumHourlyDays <= 0 {
+		return nil
+	}
+
+	cutoff, err := rm.cutoffDate(rm.config.OnlineNumHourlyDays)
+	if err != nil {
+		return err
+	}
+	result := rm.db.Where("date_int < ?", cutoff).Delete(&OnlineNumHourly{})
+	if result.Error != nil {
+		return fmt.Errorf("删除过期小时聚合数据失败: %v", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		appLogger.Info(fmt.Sprintf("已删除 %d 行过期的小时聚合数据（早于 %d）", result.RowsAffected, cutoff))
+	}
+	return nil
+}
+
+// archiveTable 归档并删除过期的原始数据
+func (rm *RetentionManager) archiveTable(table string, days int) error {
+	if days <= 0 {
+		return nil
+	}
+
+	cutoff, err := rm.cutoffDate(days)
+	if err != nil {
+		return err
+	}
+	dates, err := rm.expiredDates(table, cutoff)
+	if err != nil {
+		return err
+	}
+
+	for _, dateInt := range dates {
+		if err := rm.ensureRollup(dateInt); err != nil {
+			return fmt.Errorf("归档前生成 %d 每日汇总失败: %v", dateInt, err)
+		}
+
+		var archived int64
+		if rm.config.ArchiveMode == ArchiveModeTable {
+			archived, err = rm.archiveToTable(table, dateInt)
+		} else {
+			archived, err = rm.archiveToFile(table, dateInt)
+		}
+		if err != nil {
+			return err
+		}
+
+		deleted, err := rm.deleteDate(table, dateInt)
+		if err != nil {
+			return err
+		}
+		appLogger.Info(fmt.Sprintf("数据归档完成 - 表: %s, 日期: %d, 归档: %d 行, 删除: %d 行", table, dateInt, archived, deleted))
+	}
+	return nil
+}
+
+// archiveToTable 将一天的数据复制到归档表（重复执行时按主键忽略已归档的行）
+func (rm *RetentionManager) archiveToTable(table string, dateInt int) (int64, error) {
+	result := rm.db.Exec(fmt.Sprintf("INSERT IGNORE INTO `%s_archive` SELECT * FROM `%s` WHERE date_int = ?", table, table), dateInt)
+	if result.Error != nil {
+		return 0, fmt.Errorf("归档 %s %d 到归档表失败: %v", table, dateInt, result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// archiveToFile 将一天的数据导出为 gzip 压缩的 JSON Lines 文件
+// 先写临时文件，完整写入后再重命名，避免中断时留下不完整的归档
+func (rm *RetentionManager) archiveToFile(table string, dateInt int) (int64, error) {
+	dir := filepath.Join(rm.config.ArchiveDir, table)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, fmt.Errorf("创建归档目录失败: %v", err)
+	}
+
+	finalPath := filepath.Join(dir, fmt.Sprintf("%s_%d.jsonl.gz", table, dateInt))
+	tmpPath := finalPath + ".tmp"
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, fmt.Errorf("创建归档文件失败: %v", err)
+	}
+	defer os.Remove(tmpPath)
+
+	gz := gzip.NewWriter(file)
+	encoder := json.NewEncoder(gz)
+
+	var total int64
+	var lastID uint64
+	for {
+		var rows []map[string]interface{}
+		err := rm.db.Table(table).Where("date_int = ? AND id > ?", dateInt, lastID).
+			Order("id asc").Limit(rm.config.BatchSize).Find(&rows).Error
+		if err != nil {
+			file.Close()
+			return 0, fmt.Errorf("读取 %s %d 数据失败: %v", table, dateInt, err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			if err := encoder.Encode(row); err != nil {
+				file.Close()
+				return 0, fmt.Errorf("写入归档文件失败: %v", err)
+			}
+		}
+		total += int64(len(rows))
+		lastID = toUint64(rows[len(rows)-1]["id"])
+	}
+
+	if err := gz.Close(); err != nil {
+		file.Close()
+		return 0, fmt.Errorf("写入归档文件失败: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return 0, fmt.Errorf("写入归档文件失败: %v", err)
+	}
+
+	// 同一日期重复归档（如迟到数据）时保留已有文件，追加序号
+	target := finalPath
+	for i := 1; ; i++ {
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			break
+		}
+		target = filepath.Join(dir, fmt.Sprintf("%s_%d.%d.jsonl.gz", table, dateInt, i))
+	}
+	if err := os.Rename(tmpPath, target); err != nil {
+		return 0, fmt.Errorf("保存归档文件失败: %v", err)
+	}
+	return total, nil
+}
+
+// toUint64 转换数据库返回的主键值
+func toUint64(v interface{}) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case int64:
+		return uint64(n)
+	case uint32:
+		return uint64(n)
+	case int32:
+		return uint64(n)
+	case int:
+		return uint64(n)
+	case uint:
+		return uint64(n)
+	case []byte:
+		var id uint64
+		fmt.Sscanf(string(n), "%d", &id)
+		return id
+	}
+	return 0
+}
+
+// deleteDate 删除一天的原始数据：存在该日期的独立分区时直接删除分区，否则分批删除
+func (rm *RetentionManager) deleteDate(table string, dateInt int) (int64, error) {
+	if rm.config.Partitioning.Enabled {
+		partitions, err := rm.partitions(table)
+		if err != nil {
+			return 0, err
+		}
+		name := partitionName(dateInt)
+		if _, exists := partitions[name]; exists {
+			var count int64
+			rm.db.Table(table).Where("date_int = ?", dateInt).Count(&count)
+			if err := rm.db.Exec(fmt.Sprintf("ALTER TABLE `%s` DROP PARTITION `%s`", table, name)).Error; err != nil {
+				return 0, fmt.Errorf("删除分区 %s.%s 失败: %v", table, name, err)
+			}
+			return count, nil
+		}
+	}
+
+	var total int64
+	for {
+		result := rm.db.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE date_int = ? LIMIT ?", table), dateInt, rm.config.BatchSize)
+		if result.Error != nil {
+			return total, fmt.Errorf("删除 %s %d 数据失败: %v", table, dateInt, result.Error)
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < int64(rm.config.BatchSize) {
+			return total, nil
+		}
+	}
+}
+
+// partitionName 生成日期分区名
+func partitionName(dateInt int) string {
+	return fmt.Sprintf("p%d", dateInt)
+}
+
+// partitions 查询表的现有分区（分区名 -> 上界描述）
+func (rm *RetentionManager) partitions(table string) (map[string]string, error) {
+	var rows []struct {
+		PartitionName        string
+		PartitionDescription string
+	}
+	err := rm.db.Raw(`SELECT PARTITION_NAME AS partition_name, PARTITION_DESCRIPTION AS partition_description
+		FROM information_schema.PARTITIONS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL`, table).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询 %s 分区信息失败: %v", table, err)
+	}
+
+	result := make(map[string]string, len(rows))
+	for _, row := range rows {
+		result[row.PartitionName] = row.PartitionDescription
+	}
+	return result, nil
+}
+
+// nextDateInt 计算下一个自然日的整型日期
+func nextDateInt(dateInt int) int {
+	t, err := DateIntToTime(dateInt)
+	if err != nil {
+		return dateInt + 1
+	}
+	next := t.AddDate(0, 0, 1)
+	return next.Year()*10000 + int(next.Month())*100 + next.Day()
+}
+
+// ensurePartitions 确保表已按 date_int 范围分区，并提前创建未来日期的分区
+// 首次启用时会把主键调整为 (id, date_int)（MySQL要求分区键包含在所有唯一键中），大表上耗时较长
+func (rm *RetentionManager) ensurePartitions(table string) error {
+	partitions, err := rm.partitions(table)
+	if err != nil {
+		return err
+	}
+
+	today := GetCurrentDateInt()
+
+	if len(partitions) == 0 {
+		appLogger.Info(fmt.Sprintf("开始将表 %s 转换为按 date_int 范围分区", table))
+		if err := rm.db.Exec(fmt.Sprintf("ALTER TABLE `%s` DROP PRIMARY KEY, ADD PRIMARY KEY (`id`, `date_int`)", table)).Error; err != nil {
+			return fmt.Errorf("调整 %s 主键失败: %v", table, err)
+		}
+		sql := fmt.Sprintf("ALTER TABLE `%s` PARTITION BY RANGE (`date_int`) (PARTITION `p_history` VALUES LESS THAN (%d), PARTITION `%s` VALUES LESS THAN (%d), PARTITION `p_future` VALUES LESS THAN MAXVALUE)",
+			table, today, partitionName(today), nextDateInt(today))
+		if err := rm.db.Exec(sql).Error; err != nil {
+			return fmt.Errorf("创建 %s 分区失败: %v", table, err)
+		}
+		appLogger.Info(fmt.Sprintf("表 %s 分区转换完成", table))
+		partitions = map[string]string{"p_history": "", partitionName(today): "", "p_future": "MAXVALUE"}
+	}
+
+	if _, ok := partitions["p_future"]; !ok {
+		return fmt.Errorf("表 %s 缺少 p_future 分区，无法自动扩展分区", table)
+	}
+
+	dateInt := today
+	for i := 0; i <= rm.config.Partitioning.FutureDays; i++ {
+		name := partitionName(dateInt)
+		next := nextDateInt(dateInt)
+		if _, exists := partitions[name]; !exists {
+			sql := fmt.Sprintf("ALTER TABLE `%s` REORGANIZE PARTITION `p_future` INTO (PARTITION `%s` VALUES LESS THAN (%d), PARTITION `p_future` VALUES LESS THAN MAXVALUE)",
+				table, name, next)
+			if err := rm.db.Exec(sql).Error; err != nil {
+				return fmt.Errorf("创建分区 %s.%s 失败: %v", table, name, err)
+			}
+			appLogger.Info(fmt.Sprintf("已创建分区 %s.%s", table, name))
+		}
+		dateInt = next
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 用户角色
+const (
+	RoleAdmin    = "admin"    // 管理员：全部权限
+	RoleOperator = "operator" // 运营：查看数据、执行定时任务（数据维护任务除外）
+	RoleAnalyst  = "analyst"  // 分析师：查看全部数据（含充值排行榜明细）
+	RoleViewer   = "viewer"   // 访客：仅查看看板统计
+)
+
+// 权限
+const (
+	PermDashboardView = "dashboard:view" // 查看看板统计（活跃、新增、付费、在线）
+	PermRankView      = "rank:view"      // 查看充值排行榜（玩家明细）
+	PermJobsView      = "jobs:view"      // 查看定时任务状态
+	PermJobsRun       = "jobs:run"       // 手动触发定时任务
+	PermUsersManage   = "users:manage"   // 管理用户
+	PermSystemManage  = "system:manage"  // 系统维护（缓存管理等）
+)
+
+// jobRunPermissions 手动触发时除 jobs:run 外还需要的权限
+// 会归档、删除原始数据或修改表结构的维护任务只允许管理员触发
+var jobRunPermissions = map[string]string{
+	"data_retention": PermSystemManage,
+}
+
+// RoleInfo 角色定义
+type RoleInfo struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label"`
+	Permissions []string `json:"permissions"`
+}
+
+// roleDefinitions 角色及其权限（按权限从高到低排列）
+var roleDefinitions = []RoleInfo{
+	{RoleAdmin, "管理员", []string{PermDashboardView, PermRankView, PermJobsView, PermJobsRun, PermUsersManage, PermSystemManage}},
+	{RoleOperator, "运营", []string{PermDashboardView, PermRankView, PermJobsView, PermJobsRun}},
+	{RoleAnalyst, "分析师", []string{PermDashboardView, PermRankView}},
+	{RoleViewer, "访客", []string{PermDashboardView}},
+}
+
+// IsValidRole 判断角色是否有效
+func IsValidRole(role string) bool {
+	for _, r := range roleDefinitions {
+		if r.Name == role {
+			return true
+		}
+	}
+	return false
+}
+
+// RolePermissions 获取角色拥有的权限
+func RolePermissions(role string) []string {
+	for _, r := range roleDefinitions {
+		if r.Name == role {
+			return r.Permissions
+		}
+	}
+	return nil
+}
+
+// HasPermission 判断角色是否拥有指定权限
+func HasPermission(role, permission string) bool {
+	for _, p := range RolePermissions(role) {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleForGroups 按外部用户组映射角色，匹配多个时取权限最高的角色，未匹配返回空字符串
+func RoleForGroups(groups []string, groupRoles map[string]string) string {
+	matched := make(map[string]bool)
+	for _, group := range groups {
+		if role, ok := groupRoles[group]; ok {
+			matched[role] = true
+		}
+	}
+	for _, r := range roleDefinitions {
+		if matched[r.Name] {
+			return r.Name
+		}
+	}
+	return ""
+}
+
+// requestHasPermission 判断当前请求是否拥有指定权限
+// 使用API令牌的请求还要求令牌授予了该权限
+func requestHasPermission(c *gin.Context, permission string) bool {
+	if !HasPermission(c.GetString("role"), permission) {
+		return false
+	}
+	if _, isToken := c.Get("api_token"); !isToken {
+		return true
+	}
+	for _, scope := range c.GetStringSlice("token_scopes") {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission 权限检查中间件，需在 AuthMiddleware 之后使用
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if requestHasPermission(c, permission) {
+			c.Next()
+			return
+		}
+
+		appLogger.Warning("权限不足: 用户=" + c.GetString("user") + ", 角色=" + c.GetString("role") + ", 需要权限=" + permission + ", 路径=" + c.Request.URL.Path)
+		if isAPIRequest(c) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  "error",
+				"message": "权限不足",
+			})
+		} else {
+			c.Redirect(http.StatusFound, "/")
+		}
+		c.Abort()
+	}
+}
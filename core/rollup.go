@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DailyStats 每日汇总数据，按 (业务日期, 区服) 预计算
+// GameSvr 为 0 的行表示全服汇总（全服活跃/付费人数按角色去重，不是各服相加）
+type DailyStats struct {
+	ID            uint      `gorm:"primarykey" json:"-"`
+	DateInt       int       `gorm:"column:date_int;type:int;not null;uniqueIndex:uk_date_gamesvr" json:"date_int"`
+	GameSvr       int       `gorm:"column:gamesvr;type:int;not null;uniqueIndex:uk_date_gamesvr" json:"gamesvr"`
+	ActivePlayers int64     `gorm:"column:active_players;type:int;not null;default:0" json:"active_players"` // DAU
+	NewPlayers    int64     `gorm:"column:new_players;type:int;not null;default:0" json:"new_players"`
+	PayingPlayers int64     `gorm:"column:paying_players;type:int;not null;default:0" json:"paying_players"`
+	TotalPayment  int64     `gorm:"column:total_payment;type:bigint;not null;default:0" json:"total_payment"`
+	PeakOnline    int       `gorm:"column:peak_online;type:int;not null;default:0" json:"peak_online"` // PCU
+	AvgOnline     int       `gorm:"column:avg_online;type:int;not null;default:0" json:"avg_online"`   // ACU
+	Stale         bool      `gorm:"column:stale;type:bool;not null;default:false" json:"stale"`
+	FinalizedAt   time.Time `gorm:"column:finalized_at;type:datetime" json:"finalized_at"`
+}
+
+// TableName 指定表名
+func (DailyStats) TableName() string {
+	return "daily_stats"
+}
+
+// RollupManager 每日汇总管理器
+type RollupManager struct {
+	db           *gorm.DB
+	backfillDays int
+
+	mu         sync.Mutex
+	staleDates map[int]int64 // key: 受迟到数据影响的日期, value: 失效次数（用于检测重建期间的新迟到数据）
+}
+
+// 全局汇总管理器实例
+var rollupManager *RollupManager
+
+// InitRollupManager 初始化每日汇总管理器，并注册迟到数据回调
+func InitRollupManager(database *gorm.DB, backfillDays int) {
+	if backfillDays <= 0 {
+		backfillDays = 7
+	}
+
+	rollupManager = &RollupManager{
+		db:           database,
+		backfillDays: backfillDays,
+		staleDates:   make(map[int]int64),
+	}
+
+	RegisterLateDataHook(rollupManager.Invalidate)
+	appLogger.Info(fmt.Sprintf("每日汇总管理器初始化完成, 回补天数: %d", backfillDays))
+}
+
+// Invalidate 标记某个历史日期的汇总数据失效
+func (rm *RollupManager) Invalidate(dateInt int) {
+	if dateInt >= GetCurrentDateInt() {
+		return
+	}
+
+	rm.mu.Lock()
+	rm.staleDates[dateInt]++
+	first := rm.staleDates[dateInt] == 1
+	rm.mu.Unlock()
+
+	// 同一日期只在首次失效时写库，避免每条迟到数据都更新一次
+	if first {
+		if err := rm.db.Model(&DailyStats{}).Where("date_int = ?", dateInt).Update("stale", true).Error; err != nil {
+			appLogger.Error(fmt.Sprintf("标记每日汇总失效失败 - 日期: %d, 错误: %v", dateInt, err))
+			return
+		}
+		appLogger.Info(fmt.Sprintf("收到迟到数据，每日汇总已标记失效 - 日期: %d", dateInt))
+	}
+}
+
+// isStale 判断日期是否在内存中被标记为失效
+func (rm *RollupManager) isStale(dateInt int) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	_, stale := rm.staleDates[dateInt]
+	return stale
+}
+
+// Lookup 查询历史日期的汇总数据
+// server 为 0 表示全服；当天、失效或尚未生成汇总的日期返回 false，调用方应回退到原始表查询
+func (rm *RollupManager) Lookup(dateInt, server int) (*DailyStats, bool) {
+	if rm == nil || dateInt >= GetCurrentDateInt() || rm.isStale(dateInt) {
+		return nil, false
+	}
+
+	var rows []DailyStats
+	if err := rm.db.Where("date_int = ? AND gamesvr IN ?", dateInt, []int{0, server}).Find(&rows).Error; err != nil {
+		appLogger.Error(fmt.Sprintf("查询每日汇总失败 - 日期: %d, 错误: %v", dateInt, err))
+		return nil, false
+	}
+
+	var total, target *DailyStats
+	for i := range rows {
+		if rows[i].GameSvr == 0 {
+			total = &rows[i]
+		}
+		if rows[i].GameSvr == server {
+			target = &rows[i]
+		}
+	}
+
+	// 全服行不存在说明该日期尚未汇总
+	if total == nil || total.Stale {
+		return nil, false
+	}
+	if target == nil {
+		// 当日已汇总但该区服无数据
+		return &DailyStats{DateInt: dateInt, GameSvr: server, FinalizedAt: total.FinalizedAt}, true
+	}
+	if target.Stale {
+		return nil, false
+	}
+	return target, true
+}
+
+// Build 重新计算某个日期的汇总数据
+func (rm *RollupManager) Build(dateInt int) error {
+	rm.mu.Lock()
+	version := rm.staleDates[dateInt]
+	rm.mu.Unlock()
+
+	stats := make(map[int]*DailyStats)
+	get := func(server int) *DailyStats {
+		if s, ok := stats[server]; ok {
+			return s
+		}
+		s := &DailyStats{DateInt: dateInt, GameSvr: server}
+		stats[server] = s
+		return s
+	}
+	// 全服行始终存在，用于标记该日期已完成汇总
+	get(0)
+
+	// 1. 活跃玩家（按角色去重）
+	var active []struct {
+		GameSvr int
+		Count   int64
+	}
+	if err := rm.db.Model(&Player{}).Select("gamesvr AS game_svr, COUNT(DISTINCT roleid) AS count").
+		Where("date_int = ?", dateInt).Group("gamesvr").Scan(&active).Error; err != nil {
+		return fmt.Errorf("统计活跃玩家失败: %v", err)
+	}
+	for _, row := range active {
+		get(row.GameSvr).ActivePlayers = row.Count
+	}
+	var totalActive int64
+	if err := rm.db.Model(&Player{}).Where("date_int = ?", dateInt).Distinct("roleid").Count(&totalActive).Error; err != nil {
+		return fmt.Errorf("统计全服活跃玩家失败: %v", err)
+	}
+	get(0).ActivePlayers = totalActive
+
+	// 2. 新增玩家
+	var newPlayers []struct {
+		GameSvr int
+		Count   int64
+	}
+	if err := rm.db.Model(&Player{}).Select("gamesvr AS game_svr, COUNT(*) AS count").
+		Where("date_int = ? AND new_player = ?", dateInt, true).Group("gamesvr").Scan(&newPlayers).Error; err != nil {
+		return fmt.Errorf("统计新增玩家失败: %v", err)
+	}
+	for _, row := range newPlayers {
+		get(row.GameSvr).NewPlayers = row.Count
+		get(0).NewPlayers += row.Count
+	}
+
+	// 3. 付费玩家与付费总额
+	var payments []struct {
+		GameSvr int
+		Count   int64
+		Total   int64
+	}
+	if err := rm.db.Model(&PayReport{}).Select("gamesvr AS game_svr, COUNT(DISTINCT roleid) AS count, COALESCE(SUM(money), 0) AS total").
+		Where("date_int = ?", dateInt).Group("gamesvr").Scan(&payments).Error; err != nil {
+		return fmt.Errorf("统计付费数据失败: %v", err)
+	}
+	for _, row := range payments {
+		s := get(row.GameSvr)
+		s.PayingPlayers = row.Count
+		s.TotalPayment = row.Total
+		get(0).TotalPayment += row.Total
+	}
+	var totalPaying int64
+	if err := rm.db.Model(&PayReport{}).Where("date_int = ?", dateInt).Distinct("roleid").Count(&totalPaying).Error; err != nil {
+		return fmt.Errorf("统计全服付费玩家失败: %v", err)
+	}
+	get(0).PayingPlayers = totalPaying
+
+	// 4. 在线人数：先取每服每分钟峰值，再计算PCU/ACU
+	perMinuteSQL := `
+		SELECT
+			DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:00') as minute,
+			gamesvr_id,
+			MAX(online_num) as online_num
+		FROM online_num
+		WHERE date_int = ? AND deleted_at IS NULL
+		GROUP BY minute, gamesvr_id`
+
+	var online []struct {
+		GameSvrID int
+		Peak      int
+		Average   float64
+	}
+	if err := rm.db.Raw(`SELECT gamesvr_id AS game_svr_id, MAX(online_num) AS peak, AVG(online_num) AS average FROM (`+perMinuteSQL+`) AS t GROUP BY gamesvr_id`, dateInt).
+		Scan(&online).Error; err != nil {
+		return fmt.Errorf("统计区服在线人数失败: %v", err)
+	}
+	for _, row := range online {
+		s := get(row.GameSvrID)
+		s.PeakOnline = row.Peak
+		s.AvgOnline = int(row.Average + 0.5)
+	}
+
+	var totalOnline struct {
+		Peak    int
+		Average float64
+	}
+	if err := rm.db.Raw(`SELECT COALESCE(MAX(online_num), 0) AS peak, COALESCE(AVG(online_num), 0) AS average FROM (
+			SELECT minute, SUM(online_num) AS online_num FROM (`+perMinuteSQL+`) AS t GROUP BY minute
+		) AS m`, dateInt).Scan(&totalOnline).Error; err != nil {
+		return fmt.Errorf("统计全服在线人数失败: %v", err)
+	}
+	get(0).PeakOnline = totalOnline.Peak
+	get(0).AvgOnline = int(totalOnline.Average + 0.5)
+
+	// 5. 替换该日期的汇总数据
+	now := time.Now()
+	rows := make([]*DailyStats, 0, len(stats))
+	for _, s := range stats {
+		s.FinalizedAt = now
+		rows = append(rows, s)
+	}
+
+	err := rm.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("date_int = ?", dateInt).Delete(&DailyStats{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return fmt.Errorf("写入每日汇总失败: %v", err)
+	}
+
+	// 重建期间又收到迟到数据时保持失效状态，等待下次重建
+	rm.mu.Lock()
+	if rm.staleDates[dateInt] == version {
+		delete(rm.staleDates, dateInt)
+	} else {
+		rm.db.Model(&DailyStats{}).Where("date_int = ?", dateInt).Update("stale", true)
+	}
+	rm.mu.Unlock()
+
+	appLogger.Info(fmt.Sprintf("每日汇总生成完成 - 日期: %d, 区服数: %d, 全服DAU: %d, 全服收入: %d", dateInt, len(rows)-1, totalActive, get(0).TotalPayment))
+	return nil
+}
+
+// RunPending 生成所有待处理日期的汇总：回补窗口内缺失的日期以及被标记失效的日期
+func (rm *RollupManager) RunPending() error {
+	today := GetCurrentDateInt()
+	todayStart, err := businessClock.DayStartTime(today)
+	if err != nil {
+		return err
+	}
+
+	// 回补窗口内的历史日期
+	pending := make(map[int]bool)
+	candidates := make([]int, 0, rm.backfillDays)
+	for i := 1; i <= rm.backfillDays; i++ {
+		candidates = append(candidates, businessClock.DateOf(todayStart.AddDate(0, 0, -i)))
+	}
+
+	var finalized []int
+	if err := rm.db.Model(&DailyStats{}).Where("gamesvr = 0 AND date_int IN ? AND stale = ?", candidates, false).
+		Pluck("date_int", &finalized).Error; err != nil {
+		return fmt.Errorf("查询已汇总日期失败: %v", err)
+	}
+	done := make(map[int]bool, len(finalized))
+	for _, d := range finalized {
+		done[d] = true
+	}
+	for _, d := range candidates {
+		if !done[d] {
+			pending[d] = true
+		}
+	}
+
+	// 数据库中标记为失效的日期（包括重启前未处理完的）
+	var staleInDB []int
+	if err := rm.db.Model(&DailyStats{}).Where("stale = ?", true).Distinct().Pluck("date_int", &staleInDB).Error; err != nil {
+		return fmt.Errorf("查询失效汇总日期失败: %v", err)
+	}
+	for _, d := range staleInDB {
+		pending[d] = true
+	}
+
+	rm.mu.Lock()
+	for d := range rm.staleDates {
+		pending[d] = true
+	}
+	rm.mu.Unlock()
+
+	var failed []int
+	for dateInt := range pending {
+		if dateInt >= today {
+			continue
+		}
+		if err := rm.Build(dateInt); err != nil {
+			appLogger.Error(fmt.Sprintf("生成每日汇总失败 - 日期: %d, 错误: %v", dateInt, err))
+			failed = append(failed, dateInt)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d 个日期汇总失败: %v", len(failed), failed)
+	}
+	return nil
+}
+
+// lookupDailyStats 按区服筛选条件读取历史日期的汇总数据
+// 汇总表只有单区服和全服两种粒度，筛选多个区服时回退到原始表查询
+func lookupDailyStats(dateInt int, filter ServerFilter) (*DailyStats, bool) {
+	if filter.All {
+		return rollupManager.Lookup(dateInt, 0)
+	}
+	if server, ok := filter.Single(); ok {
+		return rollupManager.Lookup(dateInt, server)
+	}
+	return nil, false
+}
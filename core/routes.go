@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -26,9 +28,44 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 		c.Status(http.StatusNoContent)
 	})
 
+	// === 健康检查接口（供负载均衡和进程守护使用） ===
+
+	// 存活检查：进程可以处理请求即返回成功
+	r.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"uptime": time.Since(startTime).Round(time.Second).String(),
+		})
+	})
+	appLogger.Info("存活检查接口注册成功: GET /healthz")
+
+	// 就绪检查：数据库可连接、缓存已预热、日志文件可写
+	r.GET("/readyz", func(c *gin.Context) {
+		ready, checks := readiness(db)
+		logReadinessChange(ready, checks)
+		if !ready {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "error", "checks": checks})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "success", "checks": checks})
+	})
+	appLogger.Info("就绪检查接口注册成功: GET /readyz")
+
+	// 构建信息
+	r.GET("/version", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "success", "data": versionInfo()})
+	})
+	appLogger.Info("版本信息接口注册成功: GET /version")
+
+	// 页面公用脚本：修改数据的请求自动带上CSRF令牌
+	r.GET("/assets/csrf.js", func(c *gin.Context) {
+		c.File(templatePath("csrf.js"))
+	})
+	appLogger.Info("CSRF脚本路由注册成功: GET /assets/csrf.js")
+
 	// 登录页面
 	r.GET("/login", func(c *gin.Context) {
-		c.File("../templates/login.html")
+		c.File(templatePath("login.html"))
 	})
 	appLogger.Info("登录页面路由注册成功: GET /login")
 
@@ -36,15 +73,40 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 	r.POST("/login", LoginHandler)
 	appLogger.Info("登录接口注册成功: POST /login")
 
+	// 登录第二步：两步验证
+	r.POST("/login/2fa", TwoFactorLoginHandler)
+	appLogger.Info("两步验证登录接口注册成功: POST /login/2fa")
+
+	// 登录页可用的登录方式
+	r.GET("/login/options", func(c *gin.Context) {
+		oidc := gin.H{"enabled": false}
+		if oidcProvider != nil {
+			oidc = gin.H{"enabled": true, "label": oidcProvider.config.ButtonLabel}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   gin.H{"oidc": oidc},
+		})
+	})
+	appLogger.Info("登录方式接口注册成功: GET /login/options")
+
+	// OIDC登录（授权码 + PKCE）
+	r.GET("/login/oidc", OIDCLoginHandler)
+	appLogger.Info("OIDC登录接口注册成功: GET /login/oidc")
+
+	r.GET("/login/oidc/callback", OIDCCallbackHandler)
+	appLogger.Info("OIDC登录回调接口注册成功: GET /login/oidc/callback")
+
 	// 退出登录接口
 	r.POST("/logout", LogoutHandler)
 	appLogger.Info("退出登录接口注册成功: POST /logout")
 
 	// 在线人数上报接口
-	r.POST("/onlineNum", func(c *gin.Context) {
+	r.POST("/onlineNum", IngestAuthMiddleware(), func(c *gin.Context) {
 		var data struct {
-			GameSvrID int `json:"gamesvrID" form:"gamesvrID" binding:"required"`
-			OnlineNum int `json:"onlineNum" form:"onlineNum" binding:"gte=0"`
+			GameSvrID int    `json:"gamesvrID" form:"gamesvrID" binding:"required"`
+			OnlineNum int    `json:"onlineNum" form:"onlineNum" binding:"gte=0"`
+			EventTime *int64 `json:"event_time" form:"event_time"` // 可选：事件发生时间（Unix秒或毫秒）
 		}
 		if err := c.ShouldBind(&data); err != nil {
 			appLogger.Error(fmt.Sprintf("在线人数上报参数错误: %v", err))
@@ -52,34 +114,51 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 			return
 		}
 
-		// 先将数据存入内存缓存
-		onlineNumCache.SetOnlineNum(data.GameSvrID, data.OnlineNum)
+		eventTime, err := ingestPolicy.ResolveEventTime(data.EventTime)
+		if err != nil {
+			appLogger.Warning(fmt.Sprintf("在线人数上报事件时间无效 - 服务器ID: %d, %v", data.GameSvrID, err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		eventDateInt := businessClock.DateOf(eventTime)
+		isLate := eventDateInt != GetCurrentDateInt()
+
+		// 当天数据才更新内存缓存（缓存只保存当前在线人数）
+		if !isLate {
+			onlineNumCache.SetOnlineNum(data.GameSvrID, data.OnlineNum)
+		}
 
-		// 同时存入数据库（添加date_int字段）
-		currentDateInt := GetCurrentDateInt()
+		// 存入数据库（date_int按事件时间所属业务日计算）
 		if err := db.Create(&OnlineNum{
+			Model:     gorm.Model{CreatedAt: eventTime},
 			GameSvrID: data.GameSvrID,
 			OnlineNum: data.OnlineNum,
-			DateInt:   currentDateInt,
+			DateInt:   eventDateInt,
 		}).Error; err != nil {
 			appLogger.Error(fmt.Sprintf("在线人数数据写入数据库失败: %v", err))
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		appLogger.Info(fmt.Sprintf("在线人数上报成功 - 服务器ID: %d, 在线人数: %d", data.GameSvrID, data.OnlineNum))
-		c.JSON(http.StatusOK, gin.H{"status": "success"})
+		if isLate {
+			notifyLateData(eventDateInt)
+			appLogger.Info(fmt.Sprintf("迟到的在线人数数据已写入 - 服务器ID: %d, 在线人数: %d, 日期: %d", data.GameSvrID, data.OnlineNum, eventDateInt))
+		} else {
+			appLogger.Info(fmt.Sprintf("在线人数上报成功 - 服务器ID: %d, 在线人数: %d", data.GameSvrID, data.OnlineNum))
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "success", "date_int": eventDateInt, "late": isLate})
 	})
 	appLogger.Info("在线人数上报接口注册成功: POST /onlineNum")
 
 	// 玩家登录接口
-	r.POST("/user_login", func(c *gin.Context) {
+	r.POST("/user_login", IngestAuthMiddleware(), func(c *gin.Context) {
 		var data struct {
 			RoleID    string `json:"roleid" form:"roleid" binding:"required"`
 			Name      string `json:"name" form:"name" binding:"required"`
 			Level     int    `json:"level" form:"level" binding:"required"`
 			GameSvr   int    `json:"gamesvr" form:"gamesvr" binding:"required"`
 			NewPlayer int    `json:"new_player" form:"new_player"` // 改为int类型：0=非新玩家，1=新玩家
+			EventTime *int64 `json:"event_time" form:"event_time"` // 可选：事件发生时间（Unix秒或毫秒）
 		}
 		if err := c.ShouldBind(&data); err != nil {
 			appLogger.Error(fmt.Sprintf("玩家登录参数错误: %v", err))
@@ -87,6 +166,58 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 			return
 		}
 
+		eventTime, err := ingestPolicy.ResolveEventTime(data.EventTime)
+		if err != nil {
+			appLogger.Warning(fmt.Sprintf("玩家登录事件时间无效 - RoleID: %s, %v", data.RoleID, err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		eventDateInt := businessClock.DateOf(eventTime)
+
+		// 迟到数据：玩家缓存只对当天去重，历史日期直接按数据库去重
+		if eventDateInt != GetCurrentDateInt() {
+			var count int64
+			if err := db.Model(&Player{}).Where("date_int = ? AND roleid = ?", eventDateInt, data.RoleID).Count(&count).Error; err != nil {
+				appLogger.Error(fmt.Sprintf("迟到玩家数据去重查询失败: %v", err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if count > 0 {
+				c.JSON(http.StatusOK, gin.H{
+					"status":   "success",
+					"message":  "迟到的玩家数据已存在",
+					"action":   "late_duplicate",
+					"date_int": eventDateInt,
+				})
+				return
+			}
+
+			player := &Player{
+				Model:     gorm.Model{CreatedAt: eventTime},
+				RoleID:    data.RoleID,
+				Name:      data.Name,
+				Level:     data.Level,
+				GameSvr:   data.GameSvr,
+				NewPlayer: data.NewPlayer,
+				DateInt:   eventDateInt,
+			}
+			if err := db.Create(player).Error; err != nil {
+				appLogger.Error(fmt.Sprintf("迟到玩家数据写入数据库失败: %v", err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			notifyLateData(eventDateInt)
+
+			appLogger.Info(fmt.Sprintf("迟到的玩家数据已写入数据库 - RoleID: %s, 名称: %s, 日期: %d", data.RoleID, data.Name, eventDateInt))
+			c.JSON(http.StatusOK, gin.H{
+				"status":   "success",
+				"message":  "迟到的玩家数据已写入数据库",
+				"action":   "late_db_insert",
+				"date_int": eventDateInt,
+			})
+			return
+		}
+
 		// 检查RoleID是否在缓存中
 		if existingPlayer, exists := playerCache.GetPlayer(data.RoleID); exists {
 			// 如果RoleID在缓存中，只更新缓存数据（new_player字段不覆盖）
@@ -104,14 +235,14 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 			})
 		} else {
 			// 如果RoleID不在缓存中，写入数据库并缓存数据（添加date_int字段）
-			currentDateInt := GetCurrentDateInt()
 			player := &Player{
+				Model:     gorm.Model{CreatedAt: eventTime},
 				RoleID:    data.RoleID,
 				Name:      data.Name,
 				Level:     data.Level,
 				GameSvr:   data.GameSvr,
 				NewPlayer: data.NewPlayer,
-				DateInt:   currentDateInt,
+				DateInt:   eventDateInt,
 			}
 
 			if err := db.Create(player).Error; err != nil {
@@ -134,14 +265,15 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 	appLogger.Info("玩家登录接口注册成功: POST /user_login")
 
 	// 支付上报接口
-	r.POST("/pay_report", func(c *gin.Context) {
+	r.POST("/pay_report", IngestAuthMiddleware(), func(c *gin.Context) {
 		var data struct {
-			RoleID   string `json:"roleid" form:"roleid" binding:"required"`
-			Name     string `json:"name" form:"name" binding:"required"`
-			Level    int    `json:"level" form:"level" binding:"required"`
-			GameSvr  int    `json:"gamesvr" form:"gamesvr" binding:"required"`
-			Money    int    `json:"money" form:"money" binding:"required"`
-			VipLevel int    `json:"viplevel" form:"viplevel" binding:"gte=0"`
+			RoleID    string `json:"roleid" form:"roleid" binding:"required"`
+			Name      string `json:"name" form:"name" binding:"required"`
+			Level     int    `json:"level" form:"level" binding:"required"`
+			GameSvr   int    `json:"gamesvr" form:"gamesvr" binding:"required"`
+			Money     int    `json:"money" form:"money" binding:"required"`
+			VipLevel  int    `json:"viplevel" form:"viplevel" binding:"gte=0"`
+			EventTime *int64 `json:"event_time" form:"event_time"` // 可选：事件发生时间（Unix秒或毫秒）
 		}
 		if err := c.ShouldBind(&data); err != nil {
 			appLogger.Error(fmt.Sprintf("支付上报参数错误: %v", err))
@@ -149,26 +281,25 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 			return
 		}
 
-		// 更新支付排行榜缓存
-		payRankCache.UpdatePayInfo(&PayInfo{
-			RoleID:   data.RoleID,
-			Name:     data.Name,
-			Level:    data.Level,
-			GameSvr:  data.GameSvr,
-			Money:    data.Money,
-			VipLevel: data.VipLevel,
-		})
+		eventTime, err := ingestPolicy.ResolveEventTime(data.EventTime)
+		if err != nil {
+			appLogger.Warning(fmt.Sprintf("支付上报事件时间无效 - RoleID: %s, %v", data.RoleID, err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		eventDateInt := businessClock.DateOf(eventTime)
+		isLate := eventDateInt != GetCurrentDateInt()
 
-		// 创建支付记录（添加date_int字段）
-		currentDateInt := GetCurrentDateInt()
+		// 创建支付记录（date_int按事件时间所属业务日计算）
 		payReport := &PayReport{
+			Model:    gorm.Model{CreatedAt: eventTime},
 			RoleID:   data.RoleID,
 			Name:     data.Name,
 			Level:    data.Level,
 			GameSvr:  data.GameSvr,
 			Money:    data.Money,
 			VipLevel: data.VipLevel,
-			DateInt:  currentDateInt,
+			DateInt:  eventDateInt,
 		}
 
 		// 保存到数据库
@@ -178,29 +309,62 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 			return
 		}
 
-		appLogger.Info(fmt.Sprintf("支付上报成功 - RoleID: %s, 名称: %s, 等级: %d, 服务器: %d, 金额: %d, VIP等级: %d", data.RoleID, data.Name, data.Level, data.GameSvr, data.Money, data.VipLevel))
-		c.JSON(http.StatusOK, gin.H{"status": "success"})
+		if isLate {
+			// 迟到数据不进入当日排行榜缓存，只失效历史日期的预计算数据
+			notifyLateData(eventDateInt)
+			appLogger.Info(fmt.Sprintf("迟到的支付数据已写入 - RoleID: %s, 服务器: %d, 金额: %d, 日期: %d", data.RoleID, data.GameSvr, data.Money, eventDateInt))
+		} else {
+			// 更新支付排行榜缓存
+			payRankCache.UpdatePayInfo(&PayInfo{
+				RoleID:   data.RoleID,
+				Name:     data.Name,
+				Level:    data.Level,
+				GameSvr:  data.GameSvr,
+				Money:    data.Money,
+				VipLevel: data.VipLevel,
+			})
+			appLogger.Info(fmt.Sprintf("支付上报成功 - RoleID: %s, 名称: %s, 等级: %d, 服务器: %d, 金额: %d, VIP等级: %d", data.RoleID, data.Name, data.Level, data.GameSvr, data.Money, data.VipLevel))
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "success", "date_int": eventDateInt, "late": isLate})
 	})
 	appLogger.Info("支付上报接口注册成功: POST /pay_report")
 
 	// === 需要认证的路由 ===
 	protected := r.Group("/")
-	protected.Use(AuthMiddleware())
+	protected.Use(AuthMiddleware(), CSRFMiddleware())
 
 	// 主页面（需要登录）
-	protected.GET("/", func(c *gin.Context) {
-		c.File("../templates/index.html")
+	protected.GET("/", RequirePermission(PermDashboardView), func(c *gin.Context) {
+		c.File(templatePath("index.html"))
 	})
 	appLogger.Info("主页面路由注册成功: GET / (需要认证)")
 
 	// 用户管理页面
-	protected.GET("/users", func(c *gin.Context) {
-		c.File("../templates/user_manager.html")
+	protected.GET("/users", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		c.File(templatePath("user_manager.html"))
 	})
 	appLogger.Info("用户管理页面路由注册成功: GET /users (需要认证)")
 
+	// 获取业务时钟信息（供前端统一日期和图表时间轴）
+	protected.GET("/api/server-time", func(c *gin.Context) {
+		now := businessClock.Now()
+		dateInt := GetCurrentDateInt()
+		dayStart := businessClock.DayStart()
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":             "success",
+			"timezone":           businessClock.Location().String(),
+			"utc_offset_minutes": businessClock.UTCOffsetMinutes(),
+			"day_start":          fmt.Sprintf("%02d:%02d", int(dayStart.Hours()), int(dayStart.Minutes())%60),
+			"day_start_minutes":  int(dayStart.Minutes()),
+			"business_date":      fmt.Sprintf("%04d-%02d-%02d", dateInt/10000, dateInt%10000/100, dateInt%100),
+			"now":                now,
+		})
+	})
+	appLogger.Info("获取业务时钟信息接口注册成功: GET /api/server-time")
+
 	// 获取充值排行榜（优化版：使用整型日期字段）
-	protected.GET("/pay_rank", func(c *gin.Context) {
+	protected.GET("/pay_rank", RequirePermission(PermRankView), func(c *gin.Context) {
 		// 获取查询参数
 		dateParam := c.Query("date")
 		serverParam := c.Query("server")
@@ -208,9 +372,14 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 		// 将日期转换为整型
 		dateInt := DateToInt(dateParam)
 
-		// 如果是今天且全服，直接使用缓存
+		filter, ok := resolveServerFilter(c, serverParam)
+		if !ok {
+			return
+		}
+
+		// 如果是今天且不限区服，直接使用缓存
 		currentDateInt := GetCurrentDateInt()
-		if dateInt == currentDateInt && (serverParam == "" || serverParam == "0") {
+		if dateInt == currentDateInt && filter.All {
 			rank := payRankCache.GetRank()
 			c.JSON(http.StatusOK, gin.H{"rank": rank})
 			return
@@ -220,9 +389,7 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 		query := db.Model(&PayReport{}).Where("date_int = ?", dateInt)
 
 		// 处理区服筛选
-		if serverParam != "" && serverParam != "0" {
-			query = query.Where("gamesvr = ?", serverParam)
-		}
+		query = filter.Apply(query, "gamesvr")
 
 		// 查询数据库并聚合数据
 		var reports []PayReport
@@ -267,7 +434,7 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 	appLogger.Info("获取充值排行榜接口注册成功: GET /pay_rank")
 
 	// 获取在线人数曲线（优化版：使用整型日期字段）
-	protected.GET("/today_online", func(c *gin.Context) {
+	protected.GET("/today_online", RequirePermission(PermDashboardView), func(c *gin.Context) {
 		// 获取查询参数
 		dateParam := c.Query("date")
 		serverParam := c.Query("server")
@@ -275,6 +442,11 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 		// 将日期转换为整型
 		dateInt := DateToInt(dateParam)
 
+		filter, ok := resolveServerFilter(c, serverParam)
+		if !ok {
+			return
+		}
+
 		// 1. 构建基础SQL查询（使用整型日期字段）
 		baseSQL := `
 			SELECT
@@ -291,10 +463,9 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 		args := []interface{}{dateInt}
 
 		// 处理区服筛选
-		if serverParam != "" && serverParam != "0" {
-			baseSQL += " AND gamesvr_id = ?"
-			args = append(args, serverParam)
-		}
+		serverSQL, serverArgs := filter.SQL("gamesvr_id")
+		baseSQL += serverSQL
+		args = append(args, serverArgs...)
 
 		baseSQL += `
 				GROUP BY minute, gamesvr_id
@@ -308,61 +479,97 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 		}
 		db.Raw(baseSQL, args...).Scan(&perMinuteResults)
 
-		// 3. 在Go中聚合数据：计算每5分钟内的峰值
-		fiveMinuteMap := make(map[string]int) // Key: "15:04", Value: max online num
-
-		for _, row := range perMinuteResults {
-			// 将数据库返回的无时区时间字符串解析为UTC时间
-			t, err := time.ParseInLocation("2006-01-02 15:04:05", row.Minute, time.UTC)
-			if err != nil {
-				continue // Skip if format is wrong
+		// 原始数据已超过保留期被降采样时，使用小时聚合数据（各区服小时峰值之和，为近似值）
+		if len(perMinuteResults) == 0 {
+			hourlySQL := `
+				SELECT
+					DATE_FORMAT(hour_time, '%Y-%m-%d %H:%i:00') as minute,
+					SUM(peak_online) as online_num
+				FROM online_num_hourly
+				WHERE date_int = ?`
+			hourlyArgs := []interface{}{dateInt}
+			hourlySQL += serverSQL
+			hourlyArgs = append(hourlyArgs, serverArgs...)
+			hourlySQL += " GROUP BY hour_time"
+
+			var hourlyResults []struct {
+				Minute    string
+				OnlineNum int
 			}
+			db.Raw(hourlySQL, hourlyArgs...).Scan(&hourlyResults)
 
-			// 向下取整到最近的5分钟时间点 (在UTC下计算)
-			minute := t.Minute()
-			remainder := minute % 5
-			fiveMinIntervalTime := t.Add(time.Duration(-remainder) * time.Minute)
-			label := fiveMinIntervalTime.Format("15:04")
-
-			// 如果当前分钟的人数 > map中记录的这个5分钟区间的最大人数，则更新
-			if row.OnlineNum > fiveMinuteMap[label] {
-				fiveMinuteMap[label] = row.OnlineNum
+			// 将每小时的峰值展开到该小时的每个5分钟区间
+			for _, row := range hourlyResults {
+				hour, err := time.ParseInLocation("2006-01-02 15:04:05", row.Minute, dbLocation)
+				if err != nil {
+					continue
+				}
+				for i := 0; i < 12; i++ {
+					perMinuteResults = append(perMinuteResults, struct {
+						Minute    string
+						OnlineNum int
+					}{hour.Add(time.Duration(i*5) * time.Minute).Format("2006-01-02 15:04:05"), row.OnlineNum})
+				}
 			}
 		}
 
-		// 4. 组装最终返回给前端的数据
-		// 根据 dateInt 构建目标日期
-		startOfDay, err := DateIntToTime(dateInt)
+		// 3. 根据业务日期确定时间轴起点（业务时区下的每日切换时刻）
+		startOfDay, err := businessClock.DayStartTime(dateInt)
 		if err != nil {
 			appLogger.Error(fmt.Sprintf("日期转换错误: %v", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的日期参数"})
 			return
 		}
 
+		// 4. 在Go中聚合数据：计算每5分钟内的峰值
+		const slotCount = 288 // 288 = 24 * 60 / 5
+		fiveMinuteSlots := make([]int, slotCount)
+
+		for _, row := range perMinuteResults {
+			// 数据库返回的无时区时间字符串按数据库时区解析
+			t, err := time.ParseInLocation("2006-01-02 15:04:05", row.Minute, dbLocation)
+			if err != nil {
+				continue // Skip if format is wrong
+			}
+
+			// 计算所在的5分钟区间（相对业务日起点）
+			slot := int(t.Sub(startOfDay) / (5 * time.Minute))
+			if slot < 0 || slot >= slotCount {
+				continue
+			}
+
+			// 如果当前分钟的人数 > 这个5分钟区间的最大人数，则更新
+			if row.OnlineNum > fiveMinuteSlots[slot] {
+				fiveMinuteSlots[slot] = row.OnlineNum
+			}
+		}
+
+		// 5. 组装最终返回给前端的数据（时间均为业务时区）
 		var finalResults []struct {
 			Minute    time.Time `json:"Minute"`
 			OnlineNum int       `json:"OnlineNum"`
 		}
-		for i := 0; i < 288; i++ { // 288 = 24 * 60 / 5
-			// 生成从指定日期0点开始的每个5分钟时间点
+		for i := 0; i < slotCount; i++ {
+			// 生成从业务日起点开始的每个5分钟时间点
 			t := startOfDay.Add(time.Duration(i*5) * time.Minute)
-			label := t.Format("15:04")
-
-			// 从 map中获取这个5分钟区间的峰值
-			onlineNum := fiveMinuteMap[label] // 如果map中没有，默认为0
 
 			finalResults = append(finalResults, struct {
 				Minute    time.Time `json:"Minute"`
 				OnlineNum int       `json:"OnlineNum"`
-			}{Minute: t, OnlineNum: onlineNum})
+			}{Minute: t, OnlineNum: fiveMinuteSlots[i]})
 		}
 
-		c.JSON(http.StatusOK, gin.H{"data": finalResults})
+		c.JSON(http.StatusOK, gin.H{
+			"data":      finalResults,
+			"timezone":  businessClock.Location().String(),
+			"day_start": startOfDay,
+			"day_end":   startOfDay.Add(24*time.Hour - time.Second),
+		})
 	})
 	appLogger.Info("获取今天在线人数统计接口注册成功: GET /today_online")
 
 	// 获取活跃玩家人数（优化版：使用整型日期字段）
-	protected.GET("/getactivateplayer", func(c *gin.Context) {
+	protected.GET("/getactivateplayer", RequirePermission(PermDashboardView), func(c *gin.Context) {
 		// 获取查询参数
 		dateParam := c.Query("date")
 		serverParam := c.Query("server")
@@ -370,22 +577,31 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 		// 将日期转换为整型
 		dateInt := DateToInt(dateParam)
 
+		filter, ok := resolveServerFilter(c, serverParam)
+		if !ok {
+			return
+		}
+
+		// 历史日期优先读取预计算的每日汇总
+		if stats, ok := lookupDailyStats(dateInt, filter); ok {
+			c.JSON(http.StatusOK, gin.H{"active_player_count": stats.ActivePlayers, "source": "rollup"})
+			return
+		}
+
 		// 构建查询（使用整型日期字段）
 		query := db.Model(&Player{}).Where("date_int = ?", dateInt)
 
 		// 处理区服筛选
-		if serverParam != "" && serverParam != "0" {
-			query = query.Where("gamesvr = ?", serverParam)
-		}
+		query = filter.Apply(query, "gamesvr")
 
 		var count int64
 		query.Distinct("roleid").Count(&count)
-		c.JSON(http.StatusOK, gin.H{"active_player_count": count})
+		c.JSON(http.StatusOK, gin.H{"active_player_count": count, "source": "raw"})
 	})
 	appLogger.Info("获取今天活跃玩家人数接口注册成功: GET /getactivateplayer")
 
 	// 获取新增玩家人数（优化版：使用整型日期字段）
-	protected.GET("/getnewplayer", func(c *gin.Context) {
+	protected.GET("/getnewplayer", RequirePermission(PermDashboardView), func(c *gin.Context) {
 		// 获取查询参数
 		dateParam := c.Query("date")
 		serverParam := c.Query("server")
@@ -393,22 +609,31 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 		// 将日期转换为整型
 		dateInt := DateToInt(dateParam)
 
+		filter, ok := resolveServerFilter(c, serverParam)
+		if !ok {
+			return
+		}
+
+		// 历史日期优先读取预计算的每日汇总
+		if stats, ok := lookupDailyStats(dateInt, filter); ok {
+			c.JSON(http.StatusOK, gin.H{"new_player_count": stats.NewPlayers, "source": "rollup"})
+			return
+		}
+
 		// 构建查询（使用整型日期字段）
 		query := db.Model(&Player{}).Where("date_int = ? AND new_player = ?", dateInt, true)
 
 		// 处理区服筛选
-		if serverParam != "" && serverParam != "0" {
-			query = query.Where("gamesvr = ?", serverParam)
-		}
+		query = filter.Apply(query, "gamesvr")
 
 		var count int64
 		query.Count(&count)
-		c.JSON(http.StatusOK, gin.H{"new_player_count": count})
+		c.JSON(http.StatusOK, gin.H{"new_player_count": count, "source": "raw"})
 	})
 	appLogger.Info("获取今天新增玩家人数接口注册成功: GET /getnewplayer")
 
 	// 获取支付统计（优化版：使用整型日期字段）
-	protected.GET("/get_today_payment_stats", func(c *gin.Context) {
+	protected.GET("/get_today_payment_stats", RequirePermission(PermDashboardView), func(c *gin.Context) {
 		// 获取查询参数
 		dateParam := c.Query("date")
 		serverParam := c.Query("server")
@@ -416,15 +641,28 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 		// 将日期转换为整型
 		dateInt := DateToInt(dateParam)
 
+		filter, ok := resolveServerFilter(c, serverParam)
+		if !ok {
+			return
+		}
+
+		// 历史日期优先读取预计算的每日汇总
+		if stats, ok := lookupDailyStats(dateInt, filter); ok {
+			c.JSON(http.StatusOK, gin.H{
+				"paying_player_count": stats.PayingPlayers,
+				"total_payment":       stats.TotalPayment,
+				"source":              "rollup",
+			})
+			return
+		}
+
 		// 构建查询（使用整型日期字段）
 		payingPlayerQuery := db.Model(&PayReport{}).Where("date_int = ?", dateInt)
 		totalPaymentQuery := db.Model(&PayReport{}).Where("date_int = ?", dateInt)
 
 		// 处理区服筛选
-		if serverParam != "" && serverParam != "0" {
-			payingPlayerQuery = payingPlayerQuery.Where("gamesvr = ?", serverParam)
-			totalPaymentQuery = totalPaymentQuery.Where("gamesvr = ?", serverParam)
-		}
+		payingPlayerQuery = filter.Apply(payingPlayerQuery, "gamesvr")
+		totalPaymentQuery = filter.Apply(totalPaymentQuery, "gamesvr")
 
 		var payingPlayerCount int64
 		payingPlayerQuery.Distinct("roleid").Count(&payingPlayerCount)
@@ -435,18 +673,59 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 		c.JSON(http.StatusOK, gin.H{
 			"paying_player_count": payingPlayerCount,
 			"total_payment":       totalPayment,
+			"source":              "raw",
 		})
 	})
 	appLogger.Info("获取今天支付统计接口注册成功: GET /get_today_payment_stats")
 
+	// 获取每日汇总数据（按日期范围，用于趋势查看）
+	protected.GET("/api/daily_stats", RequirePermission(PermDashboardView), func(c *gin.Context) {
+		startInt := DateToInt(c.Query("start"))
+		endInt := DateToInt(c.Query("end"))
+		serverParam := c.Query("server")
+
+		query := db.Model(&DailyStats{}).Where("date_int BETWEEN ? AND ?", startInt, endInt)
+		if serverParam != "" {
+			// 指定区服（0为全服汇总行）
+			filter, ok := resolveServerFilter(c, serverParam)
+			if !ok {
+				return
+			}
+			if filter.All {
+				query = query.Where("gamesvr = ?", 0)
+			} else {
+				query = filter.Apply(query, "gamesvr")
+			}
+		} else if scope := currentServerScope(c); !scope.All {
+			// 受限用户只能看到自己区服的汇总行，不包含全服汇总行
+			query = ServerFilter{IDs: scope.SortedIDs()}.Apply(query, "gamesvr")
+		}
+
+		var stats []DailyStats
+		if err := query.Order("date_int asc, gamesvr asc").Find(&stats).Error; err != nil {
+			appLogger.Error(fmt.Sprintf("查询每日汇总失败: %v", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "查询每日汇总失败"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   stats,
+			"count":  len(stats),
+		})
+	})
+	appLogger.Info("获取每日汇总数据接口注册成功: GET /api/daily_stats")
+
 	// === 用户管理接口 ===
 
 	// 创建用户
-	protected.POST("/api/users", func(c *gin.Context) {
+	protected.POST("/api/users", RequirePermission(PermUsersManage), func(c *gin.Context) {
 		var createRequest struct {
-			Username    string `json:"username" binding:"required,min=3,max=50"`
-			Password    string `json:"password" binding:"required,min=6"`
-			DisplayName string `json:"display_name" binding:"required,max=100"`
+			Username       string `json:"username" binding:"required,min=3,max=50"`
+			Password       string `json:"password" binding:"required"`
+			DisplayName    string `json:"display_name" binding:"required,max=100"`
+			Role           string `json:"role"`
+			AllowedServers string `json:"allowed_servers"`
 		}
 
 		if err := c.ShouldBindJSON(&createRequest); err != nil {
@@ -459,7 +738,18 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 			return
 		}
 
-		err := userManager.CreateUser(createRequest.Username, createRequest.Password, createRequest.DisplayName)
+		if createRequest.Role == "" {
+			createRequest.Role = RoleViewer
+		}
+		if !IsValidRole(createRequest.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "无效的角色: " + createRequest.Role,
+			})
+			return
+		}
+
+		err := userManager.CreateUser(createRequest.Username, createRequest.Password, createRequest.DisplayName, createRequest.Role, strings.TrimSpace(createRequest.AllowedServers))
 		if err != nil {
 			appLogger.Error("创建用户失败: " + err.Error())
 			c.JSON(http.StatusConflict, gin.H{
@@ -469,6 +759,11 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 			return
 		}
 
+		RecordAudit(c, AuditUserCreate, createRequest.Username, nil, gin.H{
+			"display_name":    createRequest.DisplayName,
+			"role":            createRequest.Role,
+			"allowed_servers": strings.TrimSpace(createRequest.AllowedServers),
+		})
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "success",
 			"message": "用户创建成功",
@@ -476,9 +771,18 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 	})
 	appLogger.Info("创建用户接口注册成功: POST /api/users")
 
-	// 获取用户列表
-	protected.GET("/api/users", func(c *gin.Context) {
-		users := userManager.ListUsers()
+	// 获取用户列表（status=active 活跃用户，默认；inactive 已停用用户；all 全部）
+	protected.GET("/api/users", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		status := c.DefaultQuery("status", UserStatusActive)
+		if status != UserStatusActive && status != UserStatusInactive && status != UserStatusAll {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "status 参数应为 active、inactive 或 all",
+			})
+			return
+		}
+
+		users := userManager.ListUsers(status)
 		c.JSON(http.StatusOK, gin.H{
 			"status": "success",
 			"data":   users,
@@ -488,10 +792,10 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 	appLogger.Info("获取用户列表接口注册成功: GET /api/users")
 
 	// 更新用户密码
-	protected.PUT("/api/users/:username/password", func(c *gin.Context) {
+	protected.PUT("/api/users/:username/password", RequirePermission(PermUsersManage), func(c *gin.Context) {
 		username := c.Param("username")
 		var updateRequest struct {
-			NewPassword string `json:"new_password" binding:"required,min=6"`
+			NewPassword string `json:"new_password" binding:"required"`
 		}
 
 		if err := c.ShouldBindJSON(&updateRequest); err != nil {
@@ -502,7 +806,9 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 			return
 		}
 
-		err := userManager.UpdateUserPassword(username, updateRequest.NewPassword)
+		// 管理员重置的密码只用于临时登录，用户登录后必须自行修改
+		mustChange := username != c.GetString("user")
+		err := userManager.UpdateUserPassword(username, updateRequest.NewPassword, mustChange)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  "error",
@@ -511,6 +817,8 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 			return
 		}
 
+		RecordAudit(c, AuditUserPasswordReset, username, nil, gin.H{"must_change_password": mustChange})
+
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "success",
 			"message": "密码更新成功",
@@ -522,7 +830,7 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 	protected.PUT("/api/current-user/password", func(c *gin.Context) {
 		var changeRequest struct {
 			CurrentPassword string `json:"current_password" binding:"required"`
-			NewPassword     string `json:"new_password" binding:"required,min=6"`
+			NewPassword     string `json:"new_password" binding:"required"`
 		}
 
 		if err := c.ShouldBindJSON(&changeRequest); err != nil {
@@ -556,17 +864,26 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 			return
 		}
 
-		// 更新密码
-		err := userManager.UpdateUserPassword(username, changeRequest.NewPassword)
+		// 更新密码（不满足密码策略时返回具体原因）
+		err := userManager.UpdateUserPassword(username, changeRequest.NewPassword, false)
 		if err != nil {
 			appLogger.Error("用户修改密码失败: " + err.Error())
-			c.JSON(http.StatusInternalServerError, gin.H{
+			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  "error",
-				"message": "密码修改失败",
+				"message": err.Error(),
 			})
 			return
 		}
 
+		// 修改密码会撤销全部会话，为当前设备重新签发会话
+		session, err := sessionManager.CreateSession(username, c.ClientIP(), c.Request.UserAgent())
+		if err != nil {
+			appLogger.Error("重新签发会话失败: " + err.Error())
+		} else {
+			setSessionCookie(c, session)
+		}
+
+		RecordAudit(c, AuditUserPasswordChange, username, nil, nil)
 		appLogger.Info("用户修改密码成功: " + username)
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "success",
@@ -575,6 +892,22 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 	})
 	appLogger.Info("当前用户修改密码接口注册成功: PUT /api/current-user/password")
 
+	// 修改密码页面（被要求修改密码的用户登录后跳转到此页面）
+	protected.GET("/change-password", func(c *gin.Context) {
+		c.File(templatePath("change_password.html"))
+	})
+	appLogger.Info("修改密码页面路由注册成功: GET /change-password (需要认证)")
+
+	// 获取密码策略
+	protected.GET("/api/password-policy", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":      "success",
+			"data":        passwordPolicy.Snapshot(),
+			"description": passwordPolicy.Description(),
+		})
+	})
+	appLogger.Info("获取密码策略接口注册成功: GET /api/password-policy")
+
 	// 获取当前用户信息接口
 	protected.GET("/api/current-user", func(c *gin.Context) {
 		// 获取当前登录用户
@@ -599,18 +932,30 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 			return
 		}
 
+		// 可访问的区服列表，null 表示全部区服
+		var serverList []int
+		if scope := currentServerScope(c); !scope.All {
+			serverList = scope.SortedIDs()
+		}
+
 		c.JSON(http.StatusOK, gin.H{
-			"status":       "success",
-			"username":     user.Username,
-			"display_name": user.DisplayName,
-			"is_active":    user.IsActive,
-			"created_at":   user.CreatedAt.Format("2006-01-02 15:04:05"),
+			"status":               "success",
+			"username":             user.Username,
+			"display_name":         user.DisplayName,
+			"role":                 user.Role,
+			"permissions":          RolePermissions(user.Role),
+			"totp_enabled":         user.TOTPEnabled,
+			"totp_required":        TwoFactorRequired(user),
+			"must_change_password": user.MustChangePassword,
+			"servers":              serverList,
+			"is_active":            user.IsActive,
+			"created_at":           user.CreatedAt.Format("2006-01-02 15:04:05"),
 		})
 	})
 	appLogger.Info("获取当前用户信息接口注册成功: GET /api/current-user")
 
 	// 停用用户
-	protected.DELETE("/api/users/:username", func(c *gin.Context) {
+	protected.DELETE("/api/users/:username", RequirePermission(PermUsersManage), func(c *gin.Context) {
 		username := c.Param("username")
 
 		err := userManager.DeactivateUser(username)
@@ -622,6 +967,8 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 			return
 		}
 
+		RecordAudit(c, AuditUserDeactivate, username, gin.H{"is_active": true}, gin.H{"is_active": false})
+
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "success",
 			"message": "用户已停用",
@@ -629,23 +976,892 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 	})
 	appLogger.Info("停用用户接口注册成功: DELETE /api/users/:username")
 
-	// 手动清理玩家缓存
-	r.POST("/cache/clear_players", func(c *gin.Context) {
-		beforeSize := playerCache.GetCacheSize()
-		playerCache.ClearCache()
-		afterSize := playerCache.GetCacheSize()
+	// 编辑用户（显示名称、角色，未传的字段不修改）
+	protected.PUT("/api/users/:username", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		username := c.Param("username")
+		var editRequest struct {
+			DisplayName *string `json:"display_name"`
+			Role        *string `json:"role"`
+		}
+
+		if err := c.ShouldBindJSON(&editRequest); err != nil || (editRequest.DisplayName == nil && editRequest.Role == nil) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "请求参数错误",
+			})
+			return
+		}
+
+		user, exists := userManager.GetUser(username)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("用户 '%s' 不存在", username),
+			})
+			return
+		}
+		before := gin.H{"display_name": user.DisplayName, "role": user.Role}
+
+		if editRequest.DisplayName != nil && *editRequest.DisplayName != user.DisplayName {
+			if err := userManager.UpdateDisplayName(username, *editRequest.DisplayName); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"status":  "error",
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+		if editRequest.Role != nil && *editRequest.Role != user.Role {
+			if err := userManager.UpdateUserRole(username, *editRequest.Role); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"status":  "error",
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		// GetUser 返回的是副本，修改后重新读取
+		if updated, exists := userManager.GetUser(username); exists {
+			user = updated
+		}
+		RecordAudit(c, AuditUserUpdate, username, before, gin.H{"display_name": user.DisplayName, "role": user.Role})
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "用户信息已更新",
+			"data":    user,
+		})
+	})
+	appLogger.Info("编辑用户接口注册成功: PUT /api/users/:username")
 
-		appLogger.Info(fmt.Sprintf("手动清理玩家缓存完成 - 清理前: %d, 清理后: %d", beforeSize, afterSize))
+	// 重新启用已停用的用户
+	protected.POST("/api/users/:username/reactivate", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		username := c.Param("username")
+		if err := userManager.ReactivateUser(username); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
 
+		RecordAudit(c, AuditUserReactivate, username, gin.H{"is_active": false}, gin.H{"is_active": true})
 		c.JSON(http.StatusOK, gin.H{
-			"status":      "success",
-			"message":     "玩家缓存已清空",
-			"before_size": beforeSize,
-			"after_size":  afterSize,
-			"cleared_at":  time.Now().Format("2006-01-02 15:04:05"),
+			"status":  "success",
+			"message": "用户已重新启用",
+		})
+	})
+	appLogger.Info("重新启用用户接口注册成功: POST /api/users/:username/reactivate")
+
+	// 永久删除用户（只能删除已停用的用户，请求体需再次填写用户名确认）
+	protected.DELETE("/api/users/:username/permanent", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		username := c.Param("username")
+		var deleteRequest struct {
+			Confirm string `json:"confirm" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&deleteRequest); err != nil || deleteRequest.Confirm != username {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "请输入要删除的用户名进行确认",
+			})
+			return
+		}
+		if username == c.GetString("user") {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "不能删除当前登录的用户",
+			})
+			return
+		}
+
+		var before gin.H
+		if user, exists := userManager.GetUser(username); exists {
+			before = gin.H{"display_name": user.DisplayName, "role": user.Role, "allowed_servers": user.AllowedServers}
+		}
+		if err := userManager.DeleteUser(username); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		RecordAudit(c, AuditUserDelete, username, before, nil)
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "用户已永久删除",
+		})
+	})
+	appLogger.Info("永久删除用户接口注册成功: DELETE /api/users/:username/permanent")
+
+	// 修改用户角色
+	protected.PUT("/api/users/:username/role", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		username := c.Param("username")
+		var roleRequest struct {
+			Role string `json:"role" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&roleRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "请求参数错误",
+			})
+			return
+		}
+
+		var oldRole string
+		if user, exists := userManager.GetUser(username); exists {
+			oldRole = user.Role
+		}
+		if err := userManager.UpdateUserRole(username, roleRequest.Role); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		RecordAudit(c, AuditUserRole, username, oldRole, roleRequest.Role)
+		appLogger.Info(fmt.Sprintf("用户角色已修改: 用户=%s, 新角色=%s, 操作人=%s", username, roleRequest.Role, c.GetString("user")))
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "角色修改成功",
+		})
+	})
+	appLogger.Info("修改用户角色接口注册成功: PUT /api/users/:username/role")
+
+	// 修改用户区服范围
+	protected.PUT("/api/users/:username/servers", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		username := c.Param("username")
+		var serversRequest struct {
+			AllowedServers string `json:"allowed_servers"`
+		}
+
+		if err := c.ShouldBindJSON(&serversRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "请求参数错误",
+			})
+			return
+		}
+
+		allowedServers := strings.TrimSpace(serversRequest.AllowedServers)
+		var oldServers string
+		if user, exists := userManager.GetUser(username); exists {
+			oldServers = user.AllowedServers
+		}
+		if err := userManager.UpdateUserServers(username, allowedServers); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		RecordAudit(c, AuditUserServers, username, oldServers, allowedServers)
+		appLogger.Info(fmt.Sprintf("用户区服范围已修改: 用户=%s, 区服范围='%s', 操作人=%s", username, allowedServers, c.GetString("user")))
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "区服范围修改成功",
+		})
+	})
+	appLogger.Info("修改用户区服范围接口注册成功: PUT /api/users/:username/servers")
+
+	// 获取区服分组列表
+	protected.GET("/api/server-groups", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   serverGroups.Names(),
+		})
+	})
+	appLogger.Info("获取区服分组列表接口注册成功: GET /api/server-groups")
+
+	// 获取角色列表及权限
+	protected.GET("/api/roles", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   roleDefinitions,
+		})
+	})
+	appLogger.Info("获取角色列表接口注册成功: GET /api/roles")
+
+	// === 两步验证接口 ===
+
+	// 两步验证设置页面
+	protected.GET("/2fa", func(c *gin.Context) {
+		c.File(templatePath("two_factor.html"))
+	})
+	appLogger.Info("两步验证设置页面路由注册成功: GET /2fa (需要认证)")
+
+	// 获取当前用户两步验证状态
+	protected.GET("/api/current-user/2fa", func(c *gin.Context) {
+		user, exists := userManager.GetUser(c.GetString("user"))
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "用户不存在"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":                   "success",
+			"enabled":                  user.TOTPEnabled,
+			"required":                 TwoFactorRequired(user),
+			"recovery_codes_remaining": user.RecoveryCodesRemaining(),
+		})
+	})
+	appLogger.Info("获取两步验证状态接口注册成功: GET /api/current-user/2fa")
+
+	// 生成两步验证密钥（返回密钥和二维码地址，验证首个验证码后才启用）
+	protected.POST("/api/current-user/2fa/setup", func(c *gin.Context) {
+		username := c.GetString("user")
+		secret, err := userManager.BeginTOTPEnrollment(username)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":           "success",
+			"secret":           secret,
+			"provisioning_uri": totpProvisioningURI(username, secret),
+		})
+	})
+	appLogger.Info("生成两步验证密钥接口注册成功: POST /api/current-user/2fa/setup")
+
+	// 启用两步验证（返回恢复码，仅展示一次）
+	protected.POST("/api/current-user/2fa/enable", func(c *gin.Context) {
+		var enableRequest struct {
+			Code string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&enableRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "请输入验证码"})
+			return
+		}
+
+		codes, err := userManager.EnableTOTP(c.GetString("user"), enableRequest.Code)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":         "success",
+			"message":        "两步验证已启用",
+			"recovery_codes": codes,
+		})
+	})
+	appLogger.Info("启用两步验证接口注册成功: POST /api/current-user/2fa/enable")
+
+	// 停用两步验证（需要密码和验证码）
+	protected.POST("/api/current-user/2fa/disable", func(c *gin.Context) {
+		var disableRequest struct {
+			Password string `json:"password" binding:"required"`
+			Code     string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&disableRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "请输入密码和验证码"})
+			return
+		}
+
+		username := c.GetString("user")
+		user, exists := userManager.GetUser(username)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "用户不存在"})
+			return
+		}
+		if TwoFactorRequired(user) {
+			c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "系统要求管理员启用两步验证，不能停用"})
+			return
+		}
+		if _, ok := userManager.ValidateUser(username, disableRequest.Password); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "密码错误"})
+			return
+		}
+		if _, ok := userManager.VerifySecondFactor(username, disableRequest.Code, ""); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "验证码错误"})
+			return
+		}
+
+		if err := userManager.DisableTOTP(username); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		RecordAudit(c, AuditUser2FADisable, username, gin.H{"totp_enabled": true}, gin.H{"totp_enabled": false})
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "两步验证已停用"})
+	})
+	appLogger.Info("停用两步验证接口注册成功: POST /api/current-user/2fa/disable")
+
+	// 重新生成恢复码（需要验证码）
+	protected.POST("/api/current-user/2fa/recovery-codes", func(c *gin.Context) {
+		var regenRequest struct {
+			Code string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&regenRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "请输入验证码"})
+			return
+		}
+
+		username := c.GetString("user")
+		if _, ok := userManager.VerifySecondFactor(username, regenRequest.Code, ""); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "验证码错误"})
+			return
+		}
+
+		codes, err := userManager.RegenerateRecoveryCodes(username)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":         "success",
+			"message":        "恢复码已重新生成",
+			"recovery_codes": codes,
+		})
+	})
+	appLogger.Info("重新生成恢复码接口注册成功: POST /api/current-user/2fa/recovery-codes")
+
+	// 管理员重置用户的两步验证（用户丢失验证设备时使用）
+	protected.DELETE("/api/users/:username/2fa", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		username := c.Param("username")
+		if err := userManager.DisableTOTP(username); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+
+		RecordAudit(c, AuditUser2FAReset, username, nil, gin.H{"totp_enabled": false})
+		appLogger.Info(fmt.Sprintf("管理员重置两步验证: 用户=%s, 操作人=%s", username, c.GetString("user")))
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "两步验证已重置"})
+	})
+	appLogger.Info("重置用户两步验证接口注册成功: DELETE /api/users/:username/2fa")
+
+	// === 系统设置接口 ===
+
+	// 获取系统设置
+	protected.GET("/api/admin/settings", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   systemSettings.List(),
+		})
+	})
+	appLogger.Info("获取系统设置接口注册成功: GET /api/admin/settings")
+
+	// 修改系统设置（请求体为 {"设置项": "值"}）
+	protected.PUT("/api/admin/settings", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		var updates map[string]string
+		if err := c.ShouldBindJSON(&updates); err != nil || len(updates) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "请求参数错误"})
+			return
+		}
+
+		for name, value := range updates {
+			before := systemSettings.Get(name)
+			if err := systemSettings.Set(name, value, c.GetString("user")); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+				return
+			}
+			RecordAudit(c, AuditSettingsUpdate, name, before, systemSettings.Get(name))
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "设置已保存",
+			"data":    systemSettings.List(),
+		})
+	})
+	appLogger.Info("修改系统设置接口注册成功: PUT /api/admin/settings")
+
+	// === 会话管理接口 ===
+
+	// 会话管理页面
+	protected.GET("/sessions", func(c *gin.Context) {
+		c.File(templatePath("sessions.html"))
+	})
+	appLogger.Info("会话管理页面路由注册成功: GET /sessions (需要认证)")
+
+	// 获取当前用户的会话列表
+	protected.GET("/api/sessions", func(c *gin.Context) {
+		sessions, err := sessionManager.ListSessions(c.GetString("user"))
+		if err != nil {
+			appLogger.Error(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "获取会话列表失败"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   sessionViews(c, sessions),
+			"count":  len(sessions),
+		})
+	})
+	appLogger.Info("获取当前用户会话列表接口注册成功: GET /api/sessions")
+
+	// 撤销当前用户的某个会话
+	protected.DELETE("/api/sessions/:id", func(c *gin.Context) {
+		session, exists := sessionManager.GetSessionByID(c.Param("id"))
+		if !exists || session.Username != c.GetString("user") {
+			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "会话不存在"})
+			return
+		}
+
+		if err := sessionManager.RevokeSession(session.ID); err != nil {
+			appLogger.Error(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "撤销会话失败"})
+			return
+		}
+
+		appLogger.Info(fmt.Sprintf("用户撤销会话: 用户=%s, IP=%s", session.Username, session.IP))
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "会话已撤销"})
+	})
+	appLogger.Info("撤销当前用户会话接口注册成功: DELETE /api/sessions/:id")
+
+	// 获取全部会话（可按用户名筛选）
+	protected.GET("/api/admin/sessions", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		sessions, err := sessionManager.ListSessions(c.Query("username"))
+		if err != nil {
+			appLogger.Error(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "获取会话列表失败"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   sessionViews(c, sessions),
+			"count":  len(sessions),
+		})
+	})
+	appLogger.Info("获取全部会话列表接口注册成功: GET /api/admin/sessions")
+
+	// 撤销任意会话
+	protected.DELETE("/api/admin/sessions/:id", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		session, exists := sessionManager.GetSessionByID(c.Param("id"))
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "会话不存在"})
+			return
+		}
+
+		if err := sessionManager.RevokeSession(session.ID); err != nil {
+			appLogger.Error(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "撤销会话失败"})
+			return
+		}
+
+		RecordAudit(c, AuditSessionRevoke, session.Username, gin.H{"ip": session.IP, "device": describeUserAgent(session.UserAgent)}, nil)
+		appLogger.Info(fmt.Sprintf("管理员撤销会话: 会话用户=%s, IP=%s, 操作人=%s", session.Username, session.IP, c.GetString("user")))
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "会话已撤销"})
+	})
+	appLogger.Info("撤销会话接口注册成功: DELETE /api/admin/sessions/:id")
+
+	// 撤销某个用户的全部会话
+	protected.DELETE("/api/admin/users/:username/sessions", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		username := c.Param("username")
+		count, err := sessionManager.RevokeUserSessions(username)
+		if err != nil {
+			appLogger.Error(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "撤销会话失败"})
+			return
+		}
+
+		RecordAudit(c, AuditSessionRevoke, username, gin.H{"sessions": count}, gin.H{"sessions": 0})
+		appLogger.Info(fmt.Sprintf("管理员撤销用户全部会话: 用户=%s, 数量=%d, 操作人=%s", username, count, c.GetString("user")))
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": fmt.Sprintf("已撤销 %d 个会话", count),
+			"count":   count,
+		})
+	})
+	appLogger.Info("撤销用户全部会话接口注册成功: DELETE /api/admin/users/:username/sessions")
+
+	// === API令牌接口 ===
+
+	// API令牌管理页面
+	protected.GET("/tokens", func(c *gin.Context) {
+		c.File(templatePath("tokens.html"))
+	})
+	appLogger.Info("API令牌管理页面路由注册成功: GET /tokens (需要认证)")
+
+	// 获取当前用户可授予令牌的权限
+	protected.GET("/api/tokens/scopes", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   grantableTokenScopes(c.GetString("role")),
+		})
+	})
+	appLogger.Info("获取令牌可用权限接口注册成功: GET /api/tokens/scopes")
+
+	// 获取当前用户的令牌列表
+	protected.GET("/api/tokens", func(c *gin.Context) {
+		tokens, err := apiTokenManager.List(c.GetString("user"))
+		if err != nil {
+			appLogger.Error(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "获取令牌列表失败"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   tokenViews(tokens),
+			"count":  len(tokens),
+		})
+	})
+	appLogger.Info("获取当前用户令牌列表接口注册成功: GET /api/tokens")
+
+	// 创建令牌（原始令牌只在本次响应中返回）
+	protected.POST("/api/tokens", func(c *gin.Context) {
+		var createRequest struct {
+			Name          string   `json:"name" binding:"required"`
+			Scopes        []string `json:"scopes" binding:"required"`
+			ExpiresInDays int      `json:"expires_in_days"` // 0 表示永不过期
+		}
+		if err := c.ShouldBindJSON(&createRequest); err != nil || createRequest.ExpiresInDays < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "请求参数错误"})
+			return
+		}
+
+		var expiresAt *time.Time
+		if createRequest.ExpiresInDays > 0 {
+			t := time.Now().AddDate(0, 0, createRequest.ExpiresInDays)
+			expiresAt = &t
+		}
+
+		raw, token, err := apiTokenManager.Create(c.GetString("user"), c.GetString("role"), createRequest.Name, createRequest.Scopes, expiresAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+
+		RecordAudit(c, AuditTokenCreate, token.Username, nil, gin.H{
+			"id":         token.ID,
+			"name":       token.Name,
+			"scopes":     token.ScopeList(),
+			"expires_at": token.ExpiresAt,
+		})
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "令牌创建成功，请立即复制保存，离开页面后将无法再次查看",
+			"token":   raw,
+			"data":    tokenViews([]APIToken{*token})[0],
+		})
+	})
+	appLogger.Info("创建令牌接口注册成功: POST /api/tokens")
+
+	// 撤销当前用户的令牌
+	protected.DELETE("/api/tokens/:id", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "令牌ID格式错误"})
+			return
+		}
+
+		token, err := apiTokenManager.Revoke(uint(id), c.GetString("user"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+
+		RecordAudit(c, AuditTokenRevoke, token.Username, gin.H{"id": token.ID, "name": token.Name}, nil)
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "令牌已撤销"})
+	})
+	appLogger.Info("撤销令牌接口注册成功: DELETE /api/tokens/:id")
+
+	// 获取全部令牌（可按用户名筛选）
+	protected.GET("/api/admin/tokens", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		tokens, err := apiTokenManager.List(c.Query("username"))
+		if err != nil {
+			appLogger.Error(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "获取令牌列表失败"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   tokenViews(tokens),
+			"count":  len(tokens),
+		})
+	})
+	appLogger.Info("获取全部令牌列表接口注册成功: GET /api/admin/tokens")
+
+	// 撤销任意令牌
+	protected.DELETE("/api/admin/tokens/:id", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "令牌ID格式错误"})
+			return
+		}
+
+		token, err := apiTokenManager.Revoke(uint(id), "")
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+
+		RecordAudit(c, AuditTokenRevoke, token.Username, gin.H{"id": token.ID, "name": token.Name}, nil)
+		appLogger.Info(fmt.Sprintf("管理员撤销API令牌: 令牌用户=%s, 名称=%s, 操作人=%s", token.Username, token.Name, c.GetString("user")))
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "令牌已撤销"})
+	})
+	appLogger.Info("撤销令牌接口注册成功: DELETE /api/admin/tokens/:id")
+
+	// === 登录锁定管理接口 ===
+
+	// 获取当前被锁定的用户名和IP
+	protected.GET("/api/admin/login-locks", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		locks := loginGuard.Locks()
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   locks,
+			"count":  len(locks),
+		})
+	})
+	appLogger.Info("获取登录锁定列表接口注册成功: GET /api/admin/login-locks")
+
+	// 解除用户名或IP的登录锁定
+	protected.POST("/api/admin/login-locks/unlock", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		var unlockRequest struct {
+			Username string `json:"username"`
+			IP       string `json:"ip"`
+		}
+		if err := c.ShouldBindJSON(&unlockRequest); err != nil || (unlockRequest.Username == "" && unlockRequest.IP == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "请指定用户名或IP"})
+			return
+		}
+
+		if !loginGuard.Unlock(unlockRequest.Username, unlockRequest.IP) {
+			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "没有对应的登录失败记录"})
+			return
+		}
+
+		target := unlockRequest.Username
+		if target == "" {
+			target = unlockRequest.IP
+		}
+		RecordAudit(c, AuditLoginUnlock, target, nil, gin.H{"username": unlockRequest.Username, "ip": unlockRequest.IP})
+		appLogger.Info(fmt.Sprintf("管理员解除登录锁定: 用户名=%s, IP=%s, 操作人=%s", unlockRequest.Username, unlockRequest.IP, c.GetString("user")))
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "已解除锁定"})
+	})
+	appLogger.Info("解除登录锁定接口注册成功: POST /api/admin/login-locks/unlock")
+
+	// === 审计日志接口 ===
+
+	// 审计日志页面
+	protected.GET("/audit", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		c.File(templatePath("audit.html"))
+	})
+	appLogger.Info("审计日志页面路由注册成功: GET /audit (需要认证)")
+
+	// 查询审计日志（可按操作人、操作类型、对象、时间范围筛选，时间格式 2006-01-02 或 2006-01-02 15:04:05）
+	protected.GET("/api/admin/audit", RequirePermission(PermUsersManage), func(c *gin.Context) {
+		filter := AuditFilter{
+			Actor:  strings.TrimSpace(c.Query("actor")),
+			Action: strings.TrimSpace(c.Query("action")),
+			Target: strings.TrimSpace(c.Query("target")),
+		}
+		filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+		filter.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+		// 完整时间与其他查询接口一样按数据库时区解析，只有日期时按业务时区的自然日解析
+		parseTime := func(name string, endOfDay bool) (*time.Time, bool) {
+			value := strings.TrimSpace(c.Query(name))
+			if value == "" {
+				return nil, true
+			}
+			if t, err := time.ParseInLocation("2006-01-02 15:04:05", value, dbLocation); err == nil {
+				return &t, true
+			}
+			t, err := time.ParseInLocation("2006-01-02", value, businessClock.Location())
+			if err != nil {
+				return nil, false
+			}
+			if endOfDay {
+				t = t.AddDate(0, 0, 1)
+			}
+			return &t, true
+		}
+		var ok bool
+		if filter.From, ok = parseTime("from", false); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "from 时间格式错误"})
+			return
+		}
+		if filter.To, ok = parseTime("to", true); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "to 时间格式错误"})
+			return
+		}
+
+		entries, total, err := auditLog.Query(filter)
+		if err != nil {
+			appLogger.Error(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "查询审计日志失败"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"data":    entries,
+			"total":   total,
+			"actions": auditActions,
+		})
+	})
+	appLogger.Info("查询审计日志接口注册成功: GET /api/admin/audit")
+
+	// === 定时任务管理接口 ===
+
+	// 获取定时任务列表及状态
+	protected.GET("/api/admin/jobs", RequirePermission(PermJobsView), func(c *gin.Context) {
+		jobs := jobScheduler.Jobs()
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   jobs,
+			"count":  len(jobs),
+		})
+	})
+	appLogger.Info("获取定时任务列表接口注册成功: GET /api/admin/jobs")
+
+	// 获取单个定时任务状态
+	protected.GET("/api/admin/jobs/:name", RequirePermission(PermJobsView), func(c *gin.Context) {
+		job, exists := jobScheduler.GetJob(c.Param("name"))
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": "任务不存在",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   job,
+		})
+	})
+	appLogger.Info("获取定时任务状态接口注册成功: GET /api/admin/jobs/:name")
+
+	// 手动触发定时任务
+	protected.POST("/api/admin/jobs/:name/run", RequirePermission(PermJobsRun), func(c *gin.Context) {
+		name := c.Param("name")
+
+		if permission, ok := jobRunPermissions[name]; ok && !requestHasPermission(c, permission) {
+			appLogger.Warning(fmt.Sprintf("权限不足: 用户=%s, 角色=%s, 触发任务 %s 需要权限=%s", c.GetString("user"), c.GetString("role"), name, permission))
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  "error",
+				"message": "权限不足，该任务只允许管理员触发",
+			})
+			return
+		}
+
+		if err := jobScheduler.Trigger(name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		RecordAudit(c, AuditJobRun, name, nil, nil)
+		appLogger.Info(fmt.Sprintf("定时任务被手动触发: %s, 操作人: %s", name, c.GetString("user")))
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "任务已触发",
+		})
+	})
+	appLogger.Info("手动触发定时任务接口注册成功: POST /api/admin/jobs/:name/run")
+
+	// === 缓存管理接口 ===
+
+	// 获取各缓存的大小和估算内存
+	protected.GET("/api/admin/cache", RequirePermission(PermSystemManage), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   allCacheStats(),
+		})
+	})
+	appLogger.Info("获取缓存状态接口注册成功: GET /api/admin/cache")
+
+	// 清空缓存
+	protected.POST("/api/admin/cache/:name/clear", RequirePermission(PermSystemManage), func(c *gin.Context) {
+		cache, err := findManagedCache(c.Param("name"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		if cache.clear == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "该缓存不支持清空，请使用重建"})
+			return
+		}
+
+		before := cache.stats()
+		cache.clear()
+		after := cache.stats()
+
+		RecordAudit(c, AuditCacheClear, cache.name, gin.H{"entries": before.Entries}, gin.H{"entries": after.Entries})
+		appLogger.Info(fmt.Sprintf("手动清空缓存: %s, 清空前: %d, 清空后: %d, 操作人: %s", cache.name, before.Entries, after.Entries, c.GetString("user")))
+		c.JSON(http.StatusOK, gin.H{
+			"status":     "success",
+			"message":    "缓存已清空",
+			"before":     before,
+			"after":      after,
+			"cleared_at": time.Now().Format("2006-01-02 15:04:05"),
+		})
+	})
+	appLogger.Info("清空缓存接口注册成功: POST /api/admin/cache/:name/clear")
+
+	// 从数据库重建缓存
+	protected.POST("/api/admin/cache/:name/rebuild", RequirePermission(PermSystemManage), func(c *gin.Context) {
+		cache, err := findManagedCache(c.Param("name"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+
+		before := cache.stats()
+		if err := cache.rebuild(db); err != nil {
+			appLogger.Error(fmt.Sprintf("重建缓存 %s 失败: %v", cache.name, err))
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+			return
+		}
+		after := cache.stats()
+
+		RecordAudit(c, AuditCacheRebuild, cache.name, gin.H{"entries": before.Entries}, gin.H{"entries": after.Entries})
+		appLogger.Info(fmt.Sprintf("手动重建缓存: %s, 重建前: %d, 重建后: %d, 操作人: %s", cache.name, before.Entries, after.Entries, c.GetString("user")))
+		c.JSON(http.StatusOK, gin.H{
+			"status":     "success",
+			"message":    "缓存已重建",
+			"before":     before,
+			"after":      after,
+			"rebuilt_at": time.Now().Format("2006-01-02 15:04:05"),
+		})
+	})
+	appLogger.Info("重建缓存接口注册成功: POST /api/admin/cache/:name/rebuild")
+
+	// === 配置管理接口 ===
+
+	// 查看当前生效的配置（密码、密钥已隐藏）和重新加载记录
+	protected.GET("/api/admin/config", RequirePermission(PermSystemManage), func(c *gin.Context) {
+		if configReloader == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "error", "message": "配置热加载未启用"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   configReloader.View(),
+		})
+	})
+	appLogger.Info("查看配置接口注册成功: GET /api/admin/config")
+
+	// 立即重新加载配置文件
+	protected.POST("/api/admin/config/reload", RequirePermission(PermSystemManage), func(c *gin.Context) {
+		if configReloader == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "error", "message": "配置热加载未启用"})
+			return
+		}
+
+		record := configReloader.Reload(ReloadTriggerAPI, c.GetString("user"), c.ClientIP())
+		if !record.Success {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": record.Error, "data": record})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "配置已重新加载",
+			"data":    record,
 		})
 	})
-	appLogger.Info("手动清理玩家缓存接口注册成功: POST /cache/clear_players")
+	appLogger.Info("重新加载配置接口注册成功: POST /api/admin/config/reload")
 
 	// 记录路由注册完成
 	appLogger.Info("所有HTTP路由接口注册完成")
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobFunc 定时任务执行函数
+type JobFunc func() error
+
+// 任务状态
+const (
+	JobStatusIdle    = "idle"
+	JobStatusRunning = "running"
+	JobStatusSuccess = "success"
+	JobStatusFailed  = "failed"
+)
+
+// Schedule 任务调度规则，返回给定时间之后的下一次执行时间
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// Job 已注册的定时任务
+type Job struct {
+	name        string
+	spec        string
+	description string
+	schedule    Schedule
+	fn          JobFunc
+
+	running      bool
+	status       string
+	lastRun      time.Time
+	nextRun      time.Time
+	lastDuration time.Duration
+	lastError    string
+	runCount     int
+	failCount    int
+}
+
+// JobStatus 定时任务状态快照（用于接口返回）
+type JobStatus struct {
+	Name         string     `json:"name"`
+	Spec         string     `json:"spec"`
+	Description  string     `json:"description"`
+	Status       string     `json:"status"`
+	Running      bool       `json:"running"`
+	LastRun      *time.Time `json:"last_run"`
+	NextRun      *time.Time `json:"next_run"`
+	LastDuration string     `json:"last_duration"`
+	LastError    string     `json:"last_error"`
+	RunCount     int        `json:"run_count"`
+	FailCount    int        `json:"fail_count"`
+}
+
+// Scheduler 定时任务调度器
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	order   []string
+	loc     *time.Location
+	wake    chan struct{}
+	stop    chan struct{}
+	started bool
+	stopped bool
+	active  sync.WaitGroup // 正在执行的任务
+}
+
+// 全局任务调度器实例
+var jobScheduler = NewScheduler()
+
+// NewScheduler 创建任务调度器
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		jobs: make(map[string]*Job),
+		loc:  time.Local,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+	}
+}
+
+// Register 注册定时任务
+// spec 支持标准5段cron表达式（分 时 日 月 周），以及 @hourly、@daily、@every <duration>
+func (s *Scheduler) Register(name, spec, description string, fn JobFunc) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("任务 '%s' 调度表达式错误: %v", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.jobs[name]; exists {
+		return fmt.Errorf("任务 '%s' 已存在", name)
+	}
+
+	nextRun := schedule.Next(time.Now().In(s.loc))
+	if nextRun.IsZero() {
+		return fmt.Errorf("任务 '%s' 调度表达式 '%s' 永远不会触发", name, spec)
+	}
+
+	job := &Job{
+		name:        name,
+		spec:        spec,
+		description: description,
+		schedule:    schedule,
+		fn:          fn,
+		status:      JobStatusIdle,
+		nextRun:     nextRun,
+	}
+
+	s.jobs[name] = job
+	s.order = append(s.order, name)
+	s.notify()
+
+	appLogger.Info(fmt.Sprintf("定时任务注册成功: %s (%s), 下次执行: %s", name, spec, job.nextRun.Format("2006-01-02 15:04:05")))
+	return nil
+}
+
+// jobSchedulePlan 预先解析好的时区和任务调度表达式，由 retimeLocked 一次切换
+type jobSchedulePlan struct {
+	loc       *time.Location
+	specs     map[string]string
+	schedules map[string]Schedule
+}
+
+// planRetime 解析新的时区和任务调度表达式（不修改调度器）
+func planRetime(loc *time.Location, specs map[string]string) (*jobSchedulePlan, error) {
+	plan := &jobSchedulePlan{loc: loc, specs: specs, schedules: make(map[string]Schedule, len(specs))}
+	for name, spec := range specs {
+		schedule, err := ParseSchedule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("任务 '%s' 调度表达式错误: %v", name, err)
+		}
+		plan.schedules[name] = schedule
+	}
+	return plan, nil
+}
+
+// retimeLocked 按计划修改调度器时区和任务调度表达式，并重新计算所有任务的下次执行时间（调用前需要加锁）
+// 所有任务都能算出下次执行时间才生效，否则不做任何修改；计划中未注册的任务忽略
+// 加锁期间不能写日志（与配置切换时持有的日志锁冲突），返回需要记录的调度修改信息
+func (s *Scheduler) retimeLocked(plan *jobSchedulePlan) ([]string, error) {
+	now := time.Now().In(plan.loc)
+	nextRuns := make(map[string]time.Time, len(s.jobs))
+	for name, job := range s.jobs {
+		spec, schedule := job.spec, job.schedule
+		if replacement, ok := plan.schedules[name]; ok {
+			spec, schedule = plan.specs[name], replacement
+		}
+		nextRun := schedule.Next(now)
+		if nextRun.IsZero() {
+			return nil, fmt.Errorf("任务 '%s' 调度表达式 '%s' 永远不会触发", name, spec)
+		}
+		nextRuns[name] = nextRun
+	}
+
+	var changes []string
+	s.loc = plan.loc
+	for name, job := range s.jobs {
+		if schedule, ok := plan.schedules[name]; ok && job.spec != plan.specs[name] {
+			job.spec = plan.specs[name]
+			job.schedule = schedule
+			changes = append(changes, fmt.Sprintf("定时任务调度修改: %s (%s), 下次执行: %s", name, job.spec, nextRuns[name].Format("2006-01-02 15:04:05")))
+		}
+		job.nextRun = nextRuns[name]
+	}
+	s.notify()
+	return changes, nil
+}
+
+// Start 启动调度循环
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = true
+	s.mu.Unlock()
+
+	go s.loop()
+	appLogger.Info("定时任务调度器已启动")
+}
+
+// Stop 停止调度循环，并等待正在执行的任务结束（最长等到 ctx 超时）
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		appLogger.Info("定时任务调度器已停止")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("等待定时任务结束超时")
+	}
+}
+
+// Trigger 手动触发任务（异步执行）
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, exists := s.jobs[name]
+	if !exists {
+		return fmt.Errorf("任务 '%s' 不存在", name)
+	}
+	if job.running {
+		return fmt.Errorf("任务 '%s' 正在执行中", name)
+	}
+	if s.stopped {
+		return fmt.Errorf("调度器已停止")
+	}
+
+	job.running = true
+	s.active.Add(1)
+	go s.run(job, "手动")
+	return nil
+}
+
+// Jobs 获取所有任务状态
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]JobStatus, 0, len(s.order))
+	for _, name := range s.order {
+		result = append(result, s.snapshot(s.jobs[name]))
+	}
+	return result
+}
+
+// GetJob 获取单个任务状态
+func (s *Scheduler) GetJob(name string) (JobStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, exists := s.jobs[name]
+	if !exists {
+		return JobStatus{}, false
+	}
+	return s.snapshot(job), true
+}
+
+// snapshot 生成任务状态快照（调用前需要加锁）
+func (s *Scheduler) snapshot(job *Job) JobStatus {
+	status := JobStatus{
+		Name:        job.name,
+		Spec:        job.spec,
+		Description: job.description,
+		Status:      job.status,
+		Running:     job.running,
+		LastError:   job.lastError,
+		RunCount:    job.runCount,
+		FailCount:   job.failCount,
+	}
+	if !job.lastRun.IsZero() {
+		lastRun := job.lastRun
+		status.LastRun = &lastRun
+		status.LastDuration = job.lastDuration.String()
+	}
+	if !job.nextRun.IsZero() {
+		nextRun := job.nextRun
+		status.NextRun = &nextRun
+	}
+	return status
+}
+
+// notify 唤醒调度循环重新计算等待时间（调用前需要加锁）
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop 调度主循环
+func (s *Scheduler) loop() {
+	for {
+		s.mu.Lock()
+		var earliest time.Time
+		for _, job := range s.jobs {
+			if job.nextRun.IsZero() {
+				continue
+			}
+			if earliest.IsZero() || job.nextRun.Before(earliest) {
+				earliest = job.nextRun
+			}
+		}
+		s.mu.Unlock()
+
+		wait := time.Hour
+		if !earliest.IsZero() {
+			wait = time.Until(earliest)
+		}
+		if wait < 0 {
+			wait = 0
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			s.runDue()
+		case <-s.wake:
+			timer.Stop()
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// runDue 执行所有到期任务
+func (s *Scheduler) runDue() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return
+	}
+	now := time.Now().In(s.loc)
+	for _, name := range s.order {
+		job := s.jobs[name]
+		// 没有下次执行时间（表达式无法匹配）的任务只能手动触发
+		if job.nextRun.IsZero() || now.Before(job.nextRun) {
+			continue
+		}
+		job.nextRun = job.schedule.Next(now)
+		if job.running {
+			appLogger.Warning(fmt.Sprintf("定时任务 %s 上一次执行尚未结束，跳过本次调度", job.name))
+			continue
+		}
+		job.running = true
+		s.active.Add(1)
+		go s.run(job, "定时")
+	}
+}
+
+// run 执行任务并记录结果
+func (s *Scheduler) run(job *Job, trigger string) {
+	defer s.active.Done()
+	start := time.Now()
+
+	s.mu.Lock()
+	job.status = JobStatusRunning
+	s.mu.Unlock()
+
+	appLogger.Info(fmt.Sprintf("定时任务开始执行: %s (%s触发)", job.name, trigger))
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("任务异常: %v", r)
+			}
+		}()
+		return job.fn()
+	}()
+
+	s.mu.Lock()
+	job.running = false
+	job.lastRun = start.In(s.loc)
+	job.lastDuration = time.Since(start)
+	job.runCount++
+	if err != nil {
+		job.status = JobStatusFailed
+		job.lastError = err.Error()
+		job.failCount++
+	} else {
+		job.status = JobStatusSuccess
+		job.lastError = ""
+	}
+	duration := job.lastDuration
+	s.mu.Unlock()
+
+	if err != nil {
+		appLogger.Error(fmt.Sprintf("定时任务执行失败: %s, 耗时: %v, 错误: %v", job.name, duration, err))
+		return
+	}
+	appLogger.Info(fmt.Sprintf("定时任务执行完成: %s, 耗时: %v", job.name, duration))
+}
+
+// everySchedule 固定间隔调度
+type everySchedule struct {
+	interval time.Duration
+}
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(e.interval)
+}
+
+// cronSchedule 5段cron表达式调度
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+// Next 计算下一次匹配的时间（精确到分钟）
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// 最多向后查找约5年，防止无法匹配的表达式（如2月30日）死循环
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchDay 判断日期是否匹配（日与周同时限定时按标准cron语义取并集）
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// ParseSchedule 解析调度表达式
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("无效的间隔: %v", err)
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("间隔不能小于1秒")
+		}
+		return everySchedule{interval: interval}, nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("需要5个字段，实际为%d个: %s", len(fields), spec)
+	}
+
+	var err error
+	c := &cronSchedule{}
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("分钟字段错误: %v", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("小时字段错误: %v", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("日期字段错误: %v", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("月份字段错误: %v", err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("星期字段错误: %v", err)
+	}
+	// 周日既可以写作0也可以写作7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = fields[2] == "*"
+	c.dowStar = fields[4] == "*"
+	return c, nil
+}
+
+// parseCronField 解析单个cron字段，支持 *、数字、列表(,)、范围(-)和步长(/)
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			s, err := strconv.Atoi(part[idx+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("无效的步长: %s", part)
+			}
+			step = s
+			part = part[:idx]
+		}
+
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("无效的范围: %s", part)
+			}
+		default:
+			v, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("无效的数值: %s", part)
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("数值超出范围[%d-%d]: %s", min, max, part)
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
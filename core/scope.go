@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 区服范围格式（用于 LogUser.AllowedServers 和 serverGroups 配置）：
+//   空 或 *      全部区服（不限制）
+//   5            单个区服
+//   1-20         区服区间（含两端）
+//   @publisherA  配置中定义的区服分组
+// 多项之间用英文逗号分隔，例如 "1-20,35,@publisherA"
+
+// serverGroupRegistry 区服分组（分组名 -> 区服范围）
+type serverGroupRegistry struct {
+	mu     sync.RWMutex
+	groups map[string]string
+}
+
+// 全局区服分组实例
+var serverGroups = &serverGroupRegistry{groups: make(map[string]string)}
+
+// Configure 设置区服分组，并校验每个分组的格式
+func (r *serverGroupRegistry) Configure(groups map[string]string) error {
+	normalized := make(map[string]string, len(groups))
+	for name, spec := range groups {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return fmt.Errorf("区服分组名不能为空")
+		}
+		normalized[name] = spec
+	}
+
+	// 分组内不允许再引用分组，避免循环引用
+	for name, spec := range normalized {
+		for _, item := range splitScopeSpec(spec) {
+			if strings.HasPrefix(item, "@") {
+				return fmt.Errorf("区服分组 '%s' 不能引用其他分组 '%s'", name, item)
+			}
+		}
+		if _, err := parseServerScope(spec, nil); err != nil {
+			return fmt.Errorf("区服分组 '%s' 格式错误: %v", name, err)
+		}
+	}
+
+	r.mu.Lock()
+	r.groups = normalized
+	r.mu.Unlock()
+	return nil
+}
+
+// Names 获取所有分组名（按名称排序）
+func (r *serverGroupRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.groups))
+	for name := range r.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookup 获取分组的区服范围
+func (r *serverGroupRegistry) lookup(name string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	spec, ok := r.groups[name]
+	return spec, ok
+}
+
+// ServerScope 用户可访问的区服范围
+type ServerScope struct {
+	All bool         // 不限制区服
+	IDs map[int]bool // 允许的区服ID（All 为 false 时有效）
+}
+
+// splitScopeSpec 拆分区服范围字符串
+func splitScopeSpec(spec string) []string {
+	var items []string
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseServerScope 解析区服范围，分组引用按当前配置展开
+func ParseServerScope(spec string) (*ServerScope, error) {
+	return parseServerScope(spec, serverGroups)
+}
+
+func parseServerScope(spec string, groups *serverGroupRegistry) (*ServerScope, error) {
+	items := splitScopeSpec(spec)
+	if len(items) == 0 {
+		return &ServerScope{All: true}, nil
+	}
+
+	scope := &ServerScope{IDs: make(map[int]bool)}
+	for _, item := range items {
+		switch {
+		case item == "*":
+			return &ServerScope{All: true}, nil
+
+		case strings.HasPrefix(item, "@"):
+			if groups == nil {
+				return nil, fmt.Errorf("不支持分组引用 '%s'", item)
+			}
+			groupSpec, ok := groups.lookup(item[1:])
+			if !ok {
+				return nil, fmt.Errorf("区服分组 '%s' 不存在", item[1:])
+			}
+			sub, err := parseServerScope(groupSpec, nil)
+			if err != nil {
+				return nil, err
+			}
+			if sub.All {
+				return &ServerScope{All: true}, nil
+			}
+			for id := range sub.IDs {
+				scope.IDs[id] = true
+			}
+
+		case strings.Contains(item, "-"):
+			parts := strings.SplitN(item, "-", 2)
+			from, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+			to, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err1 != nil || err2 != nil || from <= 0 || to < from {
+				return nil, fmt.Errorf("无效的区服区间 '%s'", item)
+			}
+			if to-from > 10000 {
+				return nil, fmt.Errorf("区服区间 '%s' 过大", item)
+			}
+			for id := from; id <= to; id++ {
+				scope.IDs[id] = true
+			}
+
+		default:
+			id, err := strconv.Atoi(item)
+			if err != nil || id <= 0 {
+				return nil, fmt.Errorf("无效的区服ID '%s'", item)
+			}
+			scope.IDs[id] = true
+		}
+	}
+	return scope, nil
+}
+
+// Allows 判断是否允许访问指定区服
+func (s *ServerScope) Allows(server int) bool {
+	return s.All || s.IDs[server]
+}
+
+// SortedIDs 获取允许的区服ID列表（升序）
+func (s *ServerScope) SortedIDs() []int {
+	ids := make([]int, 0, len(s.IDs))
+	for id := range s.IDs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// ServerFilter 单次查询的区服筛选条件
+type ServerFilter struct {
+	All bool  // 不筛选（全部区服）
+	IDs []int // 筛选的区服ID列表
+}
+
+// Single 是否只筛选一个区服
+func (f ServerFilter) Single() (int, bool) {
+	if !f.All && len(f.IDs) == 1 {
+		return f.IDs[0], true
+	}
+	return 0, false
+}
+
+// Apply 为gorm查询添加区服条件
+func (f ServerFilter) Apply(query *gorm.DB, column string) *gorm.DB {
+	if f.All {
+		return query
+	}
+	if len(f.IDs) == 0 {
+		return query.Where("1 = 0")
+	}
+	if id, ok := f.Single(); ok {
+		return query.Where(column+" = ?", id)
+	}
+	return query.Where(column+" IN ?", f.IDs)
+}
+
+// SQL 生成原生SQL的区服条件（以 AND 开头）及参数
+func (f ServerFilter) SQL(column string) (string, []interface{}) {
+	if f.All {
+		return "", nil
+	}
+	if len(f.IDs) == 0 {
+		return " AND 1 = 0", nil
+	}
+	if id, ok := f.Single(); ok {
+		return " AND " + column + " = ?", []interface{}{id}
+	}
+	return " AND " + column + " IN ?", []interface{}{f.IDs}
+}
+
+// currentServerScope 获取当前登录用户的区服范围（需在 AuthMiddleware 之后使用）
+func currentServerScope(c *gin.Context) *ServerScope {
+	if v, ok := c.Get("server_scope"); ok {
+		if scope, ok := v.(*ServerScope); ok {
+			return scope
+		}
+	}
+	return &ServerScope{All: true}
+}
+
+// resolveServerFilter 根据请求的区服参数和用户区服范围生成筛选条件
+// 区服参数为空或0（全服）时表示“我有权限的全部区服”；请求无权限的区服时返回403
+func resolveServerFilter(c *gin.Context, serverParam string) (ServerFilter, bool) {
+	scope := currentServerScope(c)
+
+	if serverParam == "" || serverParam == "0" {
+		if scope.All {
+			return ServerFilter{All: true}, true
+		}
+		return ServerFilter{IDs: scope.SortedIDs()}, true
+	}
+
+	server, err := strconv.Atoi(serverParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "无效的区服参数"})
+		return ServerFilter{}, false
+	}
+	if !scope.Allows(server) {
+		appLogger.Warning(fmt.Sprintf("区服访问被拒绝: 用户=%s, 区服=%d, 路径=%s", c.GetString("user"), server, c.Request.URL.Path))
+		c.JSON(http.StatusForbidden, gin.H{"status": "error", "message": "无权查看该区服数据"})
+		return ServerFilter{}, false
+	}
+	return ServerFilter{IDs: []int{server}}, true
+}
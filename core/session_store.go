@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 会话存储类型
+const (
+	SessionStoreMemory = "memory" // 进程内存（重启后会话丢失，仅用于开发调试）
+	SessionStoreDB     = "db"     // 数据库 log_sessions 表
+	SessionStoreFile   = "file"   // 本地JSON文件
+)
+
+// SessionStore 会话存储接口
+// 会话以 Session.ID（会话令牌的SHA-256）为键，存储中不保存原始令牌
+type SessionStore interface {
+	// Save 保存会话（新建或覆盖）
+	Save(session *Session) error
+	// Get 获取会话，不存在时返回 nil, nil
+	Get(id string) (*Session, error)
+	// Touch 更新会话最后活跃时间
+	Touch(id string, lastSeen time.Time) error
+	// Delete 删除会话
+	Delete(id string) error
+	// List 获取全部会话
+	List() ([]*Session, error)
+	// DeleteExpired 删除已过期（超过有效期或空闲超时）的会话，idleTimeout 为0表示不检查空闲
+	DeleteExpired(now time.Time, idleTimeout time.Duration) (int, error)
+	// Close 关闭存储，刷新未写入的数据
+	Close() error
+}
+
+// sessionExpired 判断会话是否过期（超过有效期或空闲超时）
+func sessionExpired(s *Session, now time.Time, idleTimeout time.Duration) bool {
+	if now.After(s.ExpiresAt) {
+		return true
+	}
+	return idleTimeout > 0 && now.Sub(s.LastSeen) > idleTimeout
+}
+
+// NewSessionStore 根据配置创建会话存储
+func NewSessionStore(kind, file string, database *gorm.DB) (SessionStore, error) {
+	switch kind {
+	case SessionStoreMemory:
+		return newMemorySessionStore(), nil
+	case SessionStoreDB, "":
+		return &dbSessionStore{db: database}, nil
+	case SessionStoreFile:
+		return newFileSessionStore(file)
+	default:
+		return nil, fmt.Errorf("未知的会话存储类型 '%s'，可选 memory、db、file", kind)
+	}
+}
+
+// === 内存存储 ===
+
+type memorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{sessions: make(map[string]*Session)}
+}
+
+func (m *memorySessionStore) Save(session *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *session
+	copied.Token = ""
+	m.sessions[session.ID] = &copied
+	return nil
+}
+
+func (m *memorySessionStore) Get(id string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (m *memorySessionStore) Touch(id string, lastSeen time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if session, ok := m.sessions[id]; ok {
+		session.LastSeen = lastSeen
+	}
+	return nil
+}
+
+func (m *memorySessionStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *memorySessionStore) List() ([]*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		copied := *session
+		sessions = append(sessions, &copied)
+	}
+	return sessions, nil
+}
+
+func (m *memorySessionStore) DeleteExpired(now time.Time, idleTimeout time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for id, session := range m.sessions {
+		if sessionExpired(session, now, idleTimeout) {
+			delete(m.sessions, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *memorySessionStore) Close() error {
+	return nil
+}
+
+// === 数据库存储 ===
+
+// sessionRecord log_sessions 表记录
+type sessionRecord struct {
+	ID        string    `gorm:"column:id;primaryKey"`
+	Username  string    `gorm:"column:username"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+	ExpiresAt time.Time `gorm:"column:expires_at"`
+	LastSeen  time.Time `gorm:"column:last_seen"`
+	IP        string    `gorm:"column:ip"`
+	UserAgent string    `gorm:"column:user_agent"`
+}
+
+// TableName 指定表名
+func (sessionRecord) TableName() string {
+	return "log_sessions"
+}
+
+func (r *sessionRecord) toSession() *Session {
+	return &Session{
+		ID:        r.ID,
+		Username:  r.Username,
+		CreatedAt: r.CreatedAt,
+		ExpiresAt: r.ExpiresAt,
+		LastSeen:  r.LastSeen,
+		IP:        r.IP,
+		UserAgent: r.UserAgent,
+	}
+}
+
+type dbSessionStore struct {
+	db *gorm.DB
+}
+
+func (d *dbSessionStore) Save(session *Session) error {
+	record := &sessionRecord{
+		ID:        session.ID,
+		Username:  session.Username,
+		CreatedAt: session.CreatedAt,
+		ExpiresAt: session.ExpiresAt,
+		LastSeen:  session.LastSeen,
+		IP:        session.IP,
+		UserAgent: truncateString(session.UserAgent, 255),
+	}
+	return d.db.Save(record).Error
+}
+
+func (d *dbSessionStore) Get(id string) (*Session, error) {
+	var record sessionRecord
+	err := d.db.Where("id = ?", id).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record.toSession(), nil
+}
+
+func (d *dbSessionStore) Touch(id string, lastSeen time.Time) error {
+	return d.db.Model(&sessionRecord{}).Where("id = ?", id).Update("last_seen", lastSeen).Error
+}
+
+func (d *dbSessionStore) Delete(id string) error {
+	return d.db.Where("id = ?", id).Delete(&sessionRecord{}).Error
+}
+
+func (d *dbSessionStore) List() ([]*Session, error) {
+	var records []sessionRecord
+	if err := d.db.Order("last_seen desc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	sessions := make([]*Session, 0, len(records))
+	for i := range records {
+		sessions = append(sessions, records[i].toSession())
+	}
+	return sessions, nil
+}
+
+func (d *dbSessionStore) DeleteExpired(now time.Time, idleTimeout time.Duration) (int, error) {
+	query := d.db.Where("expires_at < ?", now)
+	if idleTimeout > 0 {
+		query = query.Or("last_seen < ?", now.Add(-idleTimeout))
+	}
+	result := query.Delete(&sessionRecord{})
+	return int(result.RowsAffected), result.Error
+}
+
+func (d *dbSessionStore) Close() error {
+	return nil
+}
+
+// === 文件存储 ===
+
+// fileSessionStore 将会话保存在内存中，每次变更后整体写入JSON文件（先写临时文件再重命名）
+type fileSessionStore struct {
+	*memorySessionStore
+	path    string
+	writeMu sync.Mutex
+}
+
+func newFileSessionStore(path string) (*fileSessionStore, error) {
+	if path == "" {
+		path = "../data/sessions.json"
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建会话文件目录失败: %v", err)
+	}
+
+	store := &fileSessionStore{
+		memorySessionStore: newMemorySessionStore(),
+		path:               path,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取会话文件失败: %v", err)
+	}
+	if len(data) > 0 {
+		var sessions []*Session
+		if err := json.Unmarshal(data, &sessions); err != nil {
+			// 文件损坏时丢弃旧会话，不影响启动
+			appLogger.Warning(fmt.Sprintf("会话文件 %s 解析失败，已忽略: %v", path, err))
+		}
+		for _, session := range sessions {
+			store.sessions[session.ID] = session
+		}
+	}
+	return store, nil
+}
+
+// persist 将当前会话写入文件
+func (f *fileSessionStore) persist() error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	sessions, _ := f.memorySessionStore.List()
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		return err
+	}
+
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("写入会话文件失败: %v", err)
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		return fmt.Errorf("写入会话文件失败: %v", err)
+	}
+	return nil
+}
+
+func (f *fileSessionStore) Save(session *Session) error {
+	f.memorySessionStore.Save(session)
+	return f.persist()
+}
+
+func (f *fileSessionStore) Touch(id string, lastSeen time.Time) error {
+	f.memorySessionStore.Touch(id, lastSeen)
+	return f.persist()
+}
+
+func (f *fileSessionStore) Delete(id string) error {
+	f.memorySessionStore.Delete(id)
+	return f.persist()
+}
+
+func (f *fileSessionStore) DeleteExpired(now time.Time, idleTimeout time.Duration) (int, error) {
+	count, _ := f.memorySessionStore.DeleteExpired(now, idleTimeout)
+	if count == 0 {
+		return 0, nil
+	}
+	return count, f.persist()
+}
+
+func (f *fileSessionStore) Close() error {
+	return f.persist()
+}
+
+// truncateString 按字符截断字符串
+func truncateString(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 系统设置项
+const (
+	SettingRequire2FAAdmin = "require_2fa_admin" // 要求管理员角色启用两步验证
+)
+
+// settingDefinition 系统设置项定义
+type settingDefinition struct {
+	Type        string // bool / int / string
+	Default     string
+	Description string
+}
+
+// settingDefinitions 全部可修改的系统设置
+var settingDefinitions = map[string]settingDefinition{
+	SettingRequire2FAAdmin: {"bool", "false", "要求管理员角色的用户启用两步验证"},
+}
+
+// SystemSetting system_settings 表记录
+type SystemSetting struct {
+	Name      string    `gorm:"column:name;primaryKey" json:"name"`
+	Value     string    `gorm:"column:value" json:"value"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+	UpdatedBy string    `gorm:"column:updated_by" json:"updated_by"`
+}
+
+// TableName 指定表名
+func (SystemSetting) TableName() string {
+	return "system_settings"
+}
+
+// SystemSettings 系统设置管理器（启动时加载到内存，修改时同步写库）
+type SystemSettings struct {
+	db     *gorm.DB
+	mu     sync.RWMutex
+	values map[string]SystemSetting
+}
+
+// 全局系统设置实例
+var systemSettings = &SystemSettings{values: make(map[string]SystemSetting)}
+
+// InitSystemSettings 初始化系统设置
+func InitSystemSettings(database *gorm.DB) {
+	systemSettings.db = database
+
+	var rows []SystemSetting
+	if err := database.Find(&rows).Error; err != nil {
+		appLogger.Error(fmt.Sprintf("加载系统设置失败: %v", err))
+		return
+	}
+
+	systemSettings.mu.Lock()
+	for _, row := range rows {
+		systemSettings.values[row.Name] = row
+	}
+	systemSettings.mu.Unlock()
+
+	appLogger.Info(fmt.Sprintf("系统设置加载完成，共 %d 项", len(rows)))
+}
+
+// Get 获取设置值，未设置时返回默认值
+func (s *SystemSettings) Get(name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if row, ok := s.values[name]; ok {
+		return row.Value
+	}
+	return settingDefinitions[name].Default
+}
+
+// GetBool 获取布尔类型设置
+func (s *SystemSettings) GetBool(name string) bool {
+	v, _ := strconv.ParseBool(s.Get(name))
+	return v
+}
+
+// Set 修改设置
+func (s *SystemSettings) Set(name, value, updatedBy string) error {
+	def, ok := settingDefinitions[name]
+	if !ok {
+		return fmt.Errorf("未知的设置项 '%s'", name)
+	}
+
+	switch def.Type {
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("设置项 '%s' 应为 true 或 false", name)
+		}
+		value = strconv.FormatBool(b)
+	case "int":
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("设置项 '%s' 应为整数", name)
+		}
+	}
+
+	row := SystemSetting{Name: name, Value: value, UpdatedAt: time.Now(), UpdatedBy: updatedBy}
+	if err := s.db.Save(&row).Error; err != nil {
+		return fmt.Errorf("保存设置失败: %v", err)
+	}
+
+	s.mu.Lock()
+	s.values[name] = row
+	s.mu.Unlock()
+
+	appLogger.Info(fmt.Sprintf("系统设置已修改: %s=%s, 操作人=%s", name, value, updatedBy))
+	return nil
+}
+
+// List 获取全部设置项（含默认值和说明）
+func (s *SystemSettings) List() []map[string]interface{} {
+	names := make([]string, 0, len(settingDefinitions))
+	for name := range settingDefinitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		def := settingDefinitions[name]
+		item := map[string]interface{}{
+			"name":        name,
+			"type":        def.Type,
+			"value":       def.Default,
+			"default":     def.Default,
+			"description": def.Description,
+		}
+		if row, ok := s.values[name]; ok {
+			item["value"] = row.Value
+			item["updated_at"] = row.UpdatedAt
+			item["updated_by"] = row.UpdatedBy
+		}
+		list = append(list, item)
+	}
+	return list
+}
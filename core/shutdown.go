@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// waitForShutdownSignal 阻塞直到收到 SIGINT 或 SIGTERM，或HTTP服务异常退出
+func waitForShutdownSignal(serverErr <-chan error) {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	select {
+	case sig := <-quit:
+		appLogger.Info(fmt.Sprintf("收到信号 %v，开始停止服务", sig))
+	case err := <-serverErr:
+		appLogger.Error(fmt.Sprintf("HTTP服务异常退出: %v，开始停止服务", err))
+	}
+}
+
+// gracefulShutdown 停止服务：不再接受新连接并等待处理中的请求和定时任务结束（最长等待 server.shutdownTimeout），
+// 然后写完异步数据、保存缓存快照、关闭会话存储、数据库连接池和日志文件
+func gracefulShutdown(srv *http.Server, server ServerConfig) {
+	timeout := server.ShutdownWait()
+	appLogger.Info(fmt.Sprintf("等待处理中的请求结束，最长 %v", timeout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// 定时任务与HTTP请求同时等待，共用同一个截止时间，避免请求耗尽等待时间后任务没有机会结束
+	schedulerDone := make(chan error, 1)
+	go func() {
+		schedulerDone <- jobScheduler.Stop(ctx)
+	}()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		appLogger.Error(fmt.Sprintf("等待HTTP请求结束超时，强制关闭剩余连接: %v", err))
+		srv.Close()
+	} else {
+		appLogger.Info("HTTP服务已停止")
+	}
+
+	if err := <-schedulerDone; err != nil {
+		appLogger.Error(fmt.Sprintf("%v，仍在执行的任务将被中断", err))
+	}
+
+	if apiTokenManager != nil {
+		apiTokenManager.Flush()
+	}
+
+	if err := SaveCacheSnapshot(server.CacheSnapshot); err != nil {
+		appLogger.Error(fmt.Sprintf("保存缓存快照失败: %v", err))
+	}
+
+	if err := sessionManager.Close(); err != nil {
+		appLogger.Error(fmt.Sprintf("关闭会话存储失败: %v", err))
+	}
+
+	if db != nil {
+		if sqlDB, err := db.DB(); err == nil {
+			if err := sqlDB.Close(); err != nil {
+				appLogger.Error(fmt.Sprintf("关闭数据库连接池失败: %v", err))
+			} else {
+				appLogger.Info("数据库连接池已关闭")
+			}
+		}
+	}
+
+	appLogger.Info("服务已停止")
+	if err := appLogger.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "关闭日志文件失败: %v\n", err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// stubDriver 测试用的 database/sql 驱动：写操作直接返回成功，查询返回空结果，并记录执行过的SQL
+// 用于在没有MySQL的环境中测试依赖 UserManager 的认证流程（用户数据只读写内存缓存）
+type stubDriver struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+var testDriver = &stubDriver{}
+
+func init() {
+	sql.Register("logsvr_stub", testDriver)
+}
+
+func (d *stubDriver) Open(string) (driver.Conn, error) { return &stubConn{driver: d}, nil }
+
+func (d *stubDriver) record(query string) {
+	d.mu.Lock()
+	d.statements = append(d.statements, query)
+	d.mu.Unlock()
+}
+
+// reset 清空已记录的SQL
+func (d *stubDriver) reset() {
+	d.mu.Lock()
+	d.statements = nil
+	d.mu.Unlock()
+}
+
+// count 统计包含指定片段的SQL条数
+func (d *stubDriver) count(fragment string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, statement := range d.statements {
+		if strings.Contains(statement, fragment) {
+			n++
+		}
+	}
+	return n
+}
+
+type stubConn struct{ driver *stubDriver }
+
+func (c *stubConn) Prepare(query string) (driver.Stmt, error) {
+	return &stubStmt{conn: c, query: query}, nil
+}
+func (c *stubConn) Close() error              { return nil }
+func (c *stubConn) Begin() (driver.Tx, error) { return stubTx{}, nil }
+
+func (c *stubConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.driver.record(query)
+	return stubResult{}, nil
+}
+
+func (c *stubConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.driver.record(query)
+	return stubRows{}, nil
+}
+
+type stubStmt struct {
+	conn  *stubConn
+	query string
+}
+
+func (s *stubStmt) Close() error  { return nil }
+func (s *stubStmt) NumInput() int { return -1 }
+func (s *stubStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.conn.driver.record(s.query)
+	return stubResult{}, nil
+}
+func (s *stubStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.conn.driver.record(s.query)
+	return stubRows{}, nil
+}
+
+type stubTx struct{}
+
+func (stubTx) Commit() error   { return nil }
+func (stubTx) Rollback() error { return nil }
+
+type stubResult struct{}
+
+func (stubResult) LastInsertId() (int64, error) { return 1, nil }
+func (stubResult) RowsAffected() (int64, error) { return 1, nil }
+
+type stubRows struct{}
+
+func (stubRows) Columns() []string         { return nil }
+func (stubRows) Close() error              { return nil }
+func (stubRows) Next([]driver.Value) error { return io.EOF }
+
+// newTestUserManager 创建使用测试驱动的全局 userManager，缓存中预置指定用户
+func newTestUserManager(t *testing.T, users ...*LogUser) {
+	t.Helper()
+
+	sqlDB, err := sql.Open("logsvr_stub", "")
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	database, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("初始化测试数据库失败: %v", err)
+	}
+
+	previous := userManager
+	userManager = &UserManager{db: database, cache: make(map[string]*LogUser)}
+	for _, user := range users {
+		userManager.cache[user.Username] = user
+	}
+	testDriver.reset()
+	t.Cleanup(func() { userManager = previous })
+}
+
+// localTestUser 本地密码用户（密码哈希使用最低成本，加快测试）
+func localTestUser(t *testing.T, username, password, role string) *LogUser {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("生成密码哈希失败: %v", err)
+	}
+	return &LogUser{
+		Username:    username,
+		Password:    string(hash),
+		DisplayName: username,
+		Role:        role,
+		AuthSource:  AuthSourceLocal,
+		IsActive:    true,
+	}
+}
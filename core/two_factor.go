@@ -0,0 +1,372 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TOTP参数（RFC 6238，与主流验证器App默认值一致）
+const (
+	totpIssuer    = "游戏数据监控"
+	totpPeriod    = 30
+	totpDigits    = 6
+	totpSkewSteps = 1 // 允许前后各1个时间步的时钟误差
+
+	recoveryCodeCount = 10
+
+	twoFactorChallengeTTL         = 5 * time.Minute
+	twoFactorChallengeMaxAttempts = 5
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTOTPSecret 生成160位随机TOTP密钥（Base32编码）
+func generateTOTPSecret() string {
+	secret := make([]byte, 20)
+	rand.Read(secret)
+	return totpEncoding.EncodeToString(secret)
+}
+
+// totpCode 计算指定时间步的验证码
+func totpCode(secret string, counter int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("无效的TOTP密钥: %v", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// 动态截断 (RFC 4226 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod), nil
+}
+
+// verifyTOTP 校验验证码，成功时返回匹配的时间步
+// lastCounter 为该用户上次使用的时间步，不大于它的时间步视为重放
+func verifyTOTP(secret, code string, lastCounter int64, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := -totpSkewSteps; step <= totpSkewSteps; step++ {
+		counter := current + int64(step)
+		if counter <= lastCounter {
+			continue
+		}
+		expected, err := totpCode(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// totpProvisioningURI 生成验证器App可扫描的 otpauth:// 地址
+func totpProvisioningURI(username, secret string) string {
+	label := url.PathEscape(totpIssuer + ":" + username)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", totpDigits))
+	params.Set("period", fmt.Sprintf("%d", totpPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// generateRecoveryCodes 生成一组恢复码，返回明文（仅展示一次）和哈希
+// 恢复码为80位随机数，熵足够高，使用SHA-256存储即可，无需慢哈希
+func generateRecoveryCodes() ([]string, []string) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 10)
+		rand.Read(raw)
+		code := strings.ToLower(totpEncoding.EncodeToString(raw))
+		code = code[:8] + "-" + code[8:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes
+}
+
+// hashRecoveryCode 计算恢复码哈希（忽略大小写、空格和连字符）
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// === 用户两步验证数据 ===
+
+// TwoFactorRequired 判断用户是否被要求启用两步验证
+// 外部认证用户的多因素认证由身份提供方负责
+func TwoFactorRequired(user *LogUser) bool {
+	return user.IsLocal() && user.Role == RoleAdmin && systemSettings.GetBool(SettingRequire2FAAdmin)
+}
+
+// BeginTOTPEnrollment 为用户生成新的待确认TOTP密钥（确认前不生效）
+func (um *UserManager) BeginTOTPEnrollment(username string) (string, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.cache[username]
+	if !exists {
+		return "", fmt.Errorf("用户 '%s' 不存在", username)
+	}
+	if user.TOTPEnabled {
+		return "", fmt.Errorf("两步验证已启用，如需更换请先停用")
+	}
+	if !user.IsLocal() {
+		return "", fmt.Errorf("外部认证用户的两步验证由身份提供方负责")
+	}
+
+	secret := generateTOTPSecret()
+	if err := um.db.Model(&LogUser{}).Where("username = ?", username).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_last_counter": 0}).Error; err != nil {
+		return "", fmt.Errorf("保存TOTP密钥失败: %v", err)
+	}
+	user.TOTPSecret = secret
+	user.TOTPLastCounter = 0
+	return secret, nil
+}
+
+// EnableTOTP 校验首个验证码后启用两步验证，返回恢复码明文
+func (um *UserManager) EnableTOTP(username, code string) ([]string, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.cache[username]
+	if !exists {
+		return nil, fmt.Errorf("用户 '%s' 不存在", username)
+	}
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("两步验证已启用")
+	}
+	if user.TOTPSecret == "" {
+		return nil, fmt.Errorf("请先生成两步验证密钥")
+	}
+
+	counter, ok := verifyTOTP(user.TOTPSecret, code, user.TOTPLastCounter, time.Now())
+	if !ok {
+		return nil, fmt.Errorf("验证码错误")
+	}
+
+	codes, hashes := generateRecoveryCodes()
+	hashesJSON, _ := json.Marshal(hashes)
+	if err := um.db.Model(&LogUser{}).Where("username = ?", username).Updates(map[string]interface{}{
+		"totp_enabled":      true,
+		"totp_last_counter": counter,
+		"recovery_codes":    string(hashesJSON),
+	}).Error; err != nil {
+		return nil, fmt.Errorf("启用两步验证失败: %v", err)
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastCounter = counter
+	user.RecoveryCodes = string(hashesJSON)
+
+	appLogger.Info(fmt.Sprintf("用户 %s 已启用两步验证", username))
+	return codes, nil
+}
+
+// DisableTOTP 停用两步验证并清除密钥和恢复码
+func (um *UserManager) DisableTOTP(username string) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.cache[username]
+	if !exists {
+		return fmt.Errorf("用户 '%s' 不存在", username)
+	}
+
+	if err := um.db.Model(&LogUser{}).Where("username = ?", username).Updates(map[string]interface{}{
+		"totp_enabled":      false,
+		"totp_secret":       "",
+		"totp_last_counter": 0,
+		"recovery_codes":    "",
+	}).Error; err != nil {
+		return fmt.Errorf("停用两步验证失败: %v", err)
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastCounter = 0
+	user.RecoveryCodes = ""
+
+	appLogger.Info(fmt.Sprintf("用户 %s 已停用两步验证", username))
+	return nil
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码（旧恢复码全部作废）
+func (um *UserManager) RegenerateRecoveryCodes(username string) ([]string, error) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.cache[username]
+	if !exists || !user.TOTPEnabled {
+		return nil, fmt.Errorf("两步验证未启用")
+	}
+
+	codes, hashes := generateRecoveryCodes()
+	hashesJSON, _ := json.Marshal(hashes)
+	if err := um.db.Model(&LogUser{}).Where("username = ?", username).
+		Update("recovery_codes", string(hashesJSON)).Error; err != nil {
+		return nil, fmt.Errorf("生成恢复码失败: %v", err)
+	}
+	user.RecoveryCodes = string(hashesJSON)
+
+	appLogger.Info(fmt.Sprintf("用户 %s 已重新生成恢复码", username))
+	return codes, nil
+}
+
+// VerifySecondFactor 校验TOTP验证码或恢复码，恢复码使用后作废
+func (um *UserManager) VerifySecondFactor(username, code, recoveryCode string) (usedRecovery bool, ok bool) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.cache[username]
+	if !exists || !user.TOTPEnabled {
+		return false, false
+	}
+
+	if code != "" {
+		counter, valid := verifyTOTP(user.TOTPSecret, code, user.TOTPLastCounter, time.Now())
+		if !valid {
+			return false, false
+		}
+		// 记录已使用的时间步，同一验证码不能再次使用
+		if err := um.db.Model(&LogUser{}).Where("username = ?", username).
+			Update("totp_last_counter", counter).Error; err != nil {
+			appLogger.Error(fmt.Sprintf("更新用户 %s TOTP时间步失败: %v", username, err))
+			return false, false
+		}
+		user.TOTPLastCounter = counter
+		return false, true
+	}
+
+	if recoveryCode == "" {
+		return false, false
+	}
+
+	var hashes []string
+	json.Unmarshal([]byte(user.RecoveryCodes), &hashes)
+	target := hashRecoveryCode(recoveryCode)
+	for i, h := range hashes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(target)) != 1 {
+			continue
+		}
+		remaining := append(append([]string{}, hashes[:i]...), hashes[i+1:]...)
+		remainingJSON, _ := json.Marshal(remaining)
+		if err := um.db.Model(&LogUser{}).Where("username = ?", username).
+			Update("recovery_codes", string(remainingJSON)).Error; err != nil {
+			appLogger.Error(fmt.Sprintf("作废用户 %s 恢复码失败: %v", username, err))
+			return false, false
+		}
+		user.RecoveryCodes = string(remainingJSON)
+		appLogger.Warning(fmt.Sprintf("用户 %s 使用恢复码登录，剩余 %d 个恢复码", username, len(remaining)))
+		return true, true
+	}
+	return false, false
+}
+
+// RecoveryCodesRemaining 获取剩余恢复码数量
+func (u *LogUser) RecoveryCodesRemaining() int {
+	var hashes []string
+	json.Unmarshal([]byte(u.RecoveryCodes), &hashes)
+	return len(hashes)
+}
+
+// === 登录第二步挑战 ===
+
+// twoFactorChallenge 密码验证通过、等待输入验证码的登录挑战
+type twoFactorChallenge struct {
+	Username  string
+	ExpiresAt time.Time
+	Attempts  int
+}
+
+// twoFactorChallenges 登录挑战（内存保存，有效期5分钟）
+var twoFactorChallenges = struct {
+	mu    sync.Mutex
+	items map[string]*twoFactorChallenge
+}{items: make(map[string]*twoFactorChallenge)}
+
+// createTwoFactorChallenge 创建登录挑战，返回挑战令牌
+func createTwoFactorChallenge(username string) string {
+	token := generateSessionID()
+
+	twoFactorChallenges.mu.Lock()
+	defer twoFactorChallenges.mu.Unlock()
+
+	now := time.Now()
+	for k, ch := range twoFactorChallenges.items {
+		if now.After(ch.ExpiresAt) {
+			delete(twoFactorChallenges.items, k)
+		}
+	}
+	twoFactorChallenges.items[token] = &twoFactorChallenge{
+		Username:  username,
+		ExpiresAt: now.Add(twoFactorChallengeTTL),
+	}
+	return token
+}
+
+// takeTwoFactorChallenge 获取登录挑战并计一次尝试，超过有效期或尝试次数的挑战会被删除
+func takeTwoFactorChallenge(token string) (*twoFactorChallenge, bool) {
+	twoFactorChallenges.mu.Lock()
+	defer twoFactorChallenges.mu.Unlock()
+
+	ch, ok := twoFactorChallenges.items[token]
+	if !ok {
+		return nil, false
+	}
+	ch.Attempts++
+	if time.Now().After(ch.ExpiresAt) || ch.Attempts > twoFactorChallengeMaxAttempts {
+		delete(twoFactorChallenges.items, token)
+		return nil, false
+	}
+	return ch, true
+}
+
+// completeTwoFactorChallenge 删除已完成的登录挑战
+func completeTwoFactorChallenge(token string) {
+	twoFactorChallenges.mu.Lock()
+	defer twoFactorChallenges.mu.Unlock()
+	delete(twoFactorChallenges.items, token)
+}
+
+// isTwoFactorSetupPath 被要求启用两步验证的用户在启用前允许访问的路径
+func isTwoFactorSetupPath(path string) bool {
+	switch path {
+	case "/2fa", "/api/current-user":
+		return true
+	}
+	return strings.HasPrefix(path, "/api/current-user/2fa")
+}
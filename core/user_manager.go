@@ -2,22 +2,48 @@ package main
 
 import (
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 // LogUser 用户数据结构
 type LogUser struct {
 	gorm.Model
-	Username    string     `gorm:"column:username;type:varchar(50);uniqueIndex;not null" json:"username"`
-	Password    string     `gorm:"column:password;type:varchar(64);not null" json:"-"` // 不返回到JSON
-	DisplayName string     `gorm:"column:display_name;type:varchar(100);not null" json:"display_name"`
-	IsActive    bool       `gorm:"column:is_active;type:bool;default:true" json:"is_active"`
-	LastLogin   *time.Time `gorm:"column:last_login;type:datetime" json:"last_login"`
+	Username           string     `gorm:"column:username;type:varchar(50);uniqueIndex;not null" json:"username"`
+	Password           string     `gorm:"column:password;type:varchar(255);not null" json:"-"` // bcrypt哈希，不返回到JSON
+	DisplayName        string     `gorm:"column:display_name;type:varchar(100);not null" json:"display_name"`
+	Role               string     `gorm:"column:role;type:varchar(20);not null;default:viewer" json:"role"`
+	AllowedServers     string     `gorm:"column:allowed_servers;type:varchar(1000);not null;default:''" json:"allowed_servers"` // 可访问的区服范围，空表示全部区服，格式见 scope.go
+	TOTPSecret         string     `gorm:"column:totp_secret;type:varchar(64);not null;default:''" json:"-"`                     // TOTP密钥（Base32）
+	TOTPEnabled        bool       `gorm:"column:totp_enabled;type:bool;not null;default:false" json:"totp_enabled"`
+	TOTPLastCounter    int64      `gorm:"column:totp_last_counter;type:bigint;not null;default:0" json:"-"`                         // 最近一次使用的时间步，防止验证码重放
+	RecoveryCodes      string     `gorm:"column:recovery_codes;type:varchar(1024);not null;default:''" json:"-"`                    // 恢复码SHA-256哈希（JSON数组）
+	MustChangePassword bool       `gorm:"column:must_change_password;type:bool;not null;default:false" json:"must_change_password"` // 下次登录后必须先修改密码
+	PasswordChangedAt  *time.Time `gorm:"column:password_changed_at;type:datetime" json:"password_changed_at"`
+	AuthSource         string     `gorm:"column:auth_source;type:varchar(20);not null;default:local" json:"auth_source"` // 认证来源: local(本地密码)、oidc、ldap
+	ExternalID         string     `gorm:"column:external_id;type:varchar(255);not null;default:''" json:"-"`             // 外部身份标识（如 OIDC 的 issuer|sub、LDAP 用户名）
+	IsActive           bool       `gorm:"column:is_active;type:bool;default:true" json:"is_active"`
+	LastLogin          *time.Time `gorm:"column:last_login;type:datetime" json:"last_login"`
+}
+
+// 用户认证来源
+const (
+	AuthSourceLocal = "local" // 本地密码
+	AuthSourceOIDC  = "oidc"  // OpenID Connect 身份提供方
+	AuthSourceLDAP  = "ldap"  // LDAP 目录
+)
+
+// IsLocal 判断是否为本地密码用户（外部认证用户不能使用本地密码登录）
+func (u *LogUser) IsLocal() bool {
+	return u.AuthSource == "" || u.AuthSource == AuthSourceLocal
 }
 
 // TableName 指定表名
@@ -42,10 +68,6 @@ func InitUserManager(database *gorm.DB) {
 		cache: make(map[string]*LogUser),
 	}
 
-	// 自动迁移用户表（使用新表名 log_users）
-	database.AutoMigrate(&LogUser{})
-	appLogger.Info("用户表结构初始化完成 (log_users)")
-
 	// 创建默认管理员用户
 	userManager.CreateDefaultAdmin()
 
@@ -55,10 +77,40 @@ func InitUserManager(database *gorm.DB) {
 	appLogger.Info("用户管理器初始化完成")
 }
 
-// HashPassword 对密码进行哈希处理
-func HashPassword(password string) string {
-	hash := sha256.Sum256([]byte(password))
-	return hex.EncodeToString(hash[:])
+// passwordHashCost bcrypt计算成本，低于该成本的哈希在登录成功后自动升级
+const passwordHashCost = 12
+
+// HashPassword 使用bcrypt对密码进行哈希处理（每个哈希自带随机盐）
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordHashCost)
+	if err != nil {
+		return "", fmt.Errorf("密码哈希失败: %v", err)
+	}
+	return string(hash), nil
+}
+
+// isLegacyPasswordHash 判断是否为旧版无盐SHA-256哈希（64位十六进制）
+func isLegacyPasswordHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// verifyPassword 校验密码，needsUpgrade 表示哈希需要升级为当前算法和成本
+func verifyPassword(hash, password string) (ok bool, needsUpgrade bool) {
+	if isLegacyPasswordHash(hash) {
+		sum := sha256.Sum256([]byte(password))
+		legacy := hex.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(legacy), []byte(hash)) == 1, true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, err == nil && cost < passwordHashCost
 }
 
 // CreateDefaultAdmin 创建默认管理员用户
@@ -72,20 +124,30 @@ func (um *UserManager) CreateDefaultAdmin() {
 	if result.Error == nil {
 		// root用户已存在
 		appLogger.Info("默认管理员用户 root 已存在，跳过创建过程")
+		um.flagDefaultPassword(&existingUser)
 		return
 	}
 
-	// root用户不存在，创建新的默认管理员
-	defaultPassword := "123456"
-	hashedPassword := HashPassword(defaultPassword)
-	appLogger.Info(fmt.Sprintf("正在创建默认管理员: 原始密码=%s, 哈希后密码=%s",
-		defaultPassword, hashedPassword[:20]+"..."))
+	// root用户不存在，创建新的默认管理员（优先使用配置的初始密码）
+	password, configured := passwordPolicy.BootstrapPassword()
+	if !configured {
+		appLogger.Warning(fmt.Sprintf("未配置root初始密码（password.bootstrapPassword 或环境变量 %s），使用默认密码，首次登录后必须修改", BootstrapPasswordEnv))
+	}
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		appLogger.Error(fmt.Sprintf("创建默认管理员失败: %v", err))
+		return
+	}
+	appLogger.Info("正在创建默认管理员: root")
 
 	defaultAdmin := &LogUser{
-		Username:    "root",
-		Password:    hashedPassword,
-		DisplayName: "系统管理员",
-		IsActive:    true,
+		Username:           "root",
+		Password:           hashedPassword,
+		DisplayName:        "系统管理员",
+		Role:               RoleAdmin,
+		MustChangePassword: true,
+		AuthSource:         AuthSourceLocal,
+		IsActive:           true,
 	}
 
 	if err := um.db.Create(defaultAdmin).Error; err != nil {
@@ -101,25 +163,48 @@ func (um *UserManager) CreateDefaultAdmin() {
 	}
 }
 
-// LoadUsersToCache 加载用户到缓存
+// flagDefaultPassword 仍在使用默认密码的root用户标记为必须修改密码（兼容升级前创建的root）
+func (um *UserManager) flagDefaultPassword(root *LogUser) {
+	if root.MustChangePassword {
+		return
+	}
+	if ok, _ := verifyPassword(root.Password, DefaultPassword); !ok {
+		return
+	}
+
+	if err := um.db.Model(&LogUser{}).Where("username = ?", root.Username).Update("must_change_password", true).Error; err != nil {
+		appLogger.Error(fmt.Sprintf("标记root用户修改密码失败: %v", err))
+		return
+	}
+	appLogger.Warning("root用户仍在使用默认密码，已要求其下次登录时修改密码")
+}
+
+// LoadUsersToCache 加载用户到缓存（包括已停用用户，停用用户不能登录但可以重新启用）
 func (um *UserManager) LoadUsersToCache() {
 	um.mu.Lock()
 	defer um.mu.Unlock()
 
 	var users []LogUser
-	if err := um.db.Where("is_active = ?", true).Find(&users).Error; err != nil {
+	if err := um.db.Find(&users).Error; err != nil {
 		appLogger.Error(fmt.Sprintf("加载用户到缓存失败: %v", err))
 		return
 	}
 
 	um.cache = make(map[string]*LogUser)
+	legacyCount := 0
 	for i := range users {
 		um.cache[users[i].Username] = &users[i]
-		appLogger.Info(fmt.Sprintf("用户加载到缓存: 用户名=%s, ID=%d, 活跃状态=%t, 密码哈希=%s",
-			users[i].Username, users[i].ID, users[i].IsActive, users[i].Password[:20]+"..."))
+		if isLegacyPasswordHash(users[i].Password) {
+			legacyCount++
+		}
+		appLogger.Info(fmt.Sprintf("用户加载到缓存: 用户名=%s, ID=%d, 活跃状态=%t",
+			users[i].Username, users[i].ID, users[i].IsActive))
 	}
 
 	appLogger.Info(fmt.Sprintf("成功加载 %d 个用户到缓存", len(users)))
+	if legacyCount > 0 {
+		appLogger.Warning(fmt.Sprintf("有 %d 个用户仍使用旧版密码哈希，将在其下次登录成功后自动升级", legacyCount))
+	}
 
 	// 打印缓存中的所有用户名
 	appLogger.Info(fmt.Sprintf("缓存中的用户名列表: %v", func() []string {
@@ -134,18 +219,16 @@ func (um *UserManager) LoadUsersToCache() {
 // ValidateUser 验证用户登录凭据
 func (um *UserManager) ValidateUser(username, password string) (*LogUser, bool) {
 	um.mu.RLock()
-	defer um.mu.RUnlock()
-
-	// 调试信息：显示当前缓存状态
-	appLogger.Info(fmt.Sprintf("开始验证用户: %s", username))
-	appLogger.Info(fmt.Sprintf("当前缓存中的用户数量: %d", len(um.cache)))
-	for cachedUsername := range um.cache {
-		appLogger.Info(fmt.Sprintf("缓存中的用户: %s", cachedUsername))
+	user, exists := um.cache[username]
+	var storedHash string
+	if exists {
+		user = copyUser(user)
+		storedHash = user.Password
 	}
+	um.mu.RUnlock()
 
-	user, exists := um.cache[username]
 	if !exists {
-		appLogger.Warning(fmt.Sprintf("用户验证失败: 用户 '%s' 不存在于缓存中", username))
+		appLogger.Warning(fmt.Sprintf("用户验证失败: 用户 '%s' 不存在", username))
 		return nil, false
 	}
 
@@ -154,14 +237,23 @@ func (um *UserManager) ValidateUser(username, password string) (*LogUser, bool)
 		return nil, false
 	}
 
-	hashedPassword := HashPassword(password)
-	appLogger.Info(fmt.Sprintf("用户 '%s' 密码验证: 输入密码哈希=%s, 存储密码哈希=%s", username, hashedPassword[:20]+"...", user.Password[:20]+"..."))
+	if !user.IsLocal() {
+		appLogger.Warning(fmt.Sprintf("用户验证失败: 用户 '%s' 由 %s 认证，不能使用本地密码登录", username, user.AuthSource))
+		return nil, false
+	}
 
-	if user.Password != hashedPassword {
+	// bcrypt校验较慢，不在持有锁时执行
+	ok, needsUpgrade := verifyPassword(storedHash, password)
+	if !ok {
 		appLogger.Warning(fmt.Sprintf("用户验证失败: 用户 '%s' 密码不匹配", username))
 		return nil, false
 	}
 
+	// 旧版哈希或低成本哈希在登录成功后升级（异步执行，不阻塞验证）
+	if needsUpgrade {
+		go um.upgradePasswordHash(username, storedHash, password)
+	}
+
 	// 更新最后登录时间（异步执行，不阻塞验证）
 	go um.updateLastLogin(username)
 
@@ -169,6 +261,35 @@ func (um *UserManager) ValidateUser(username, password string) (*LogUser, bool)
 	return user, true
 }
 
+// upgradePasswordHash 将用户密码哈希升级为当前算法
+// 仅当数据库中仍是旧哈希时才更新，避免覆盖期间发生的密码修改
+func (um *UserManager) upgradePasswordHash(username, oldHash, password string) {
+	newHash, err := HashPassword(password)
+	if err != nil {
+		appLogger.Error(fmt.Sprintf("升级用户 %s 密码哈希失败: %v", username, err))
+		return
+	}
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	result := um.db.Model(&LogUser{}).
+		Where("username = ? AND password = ?", username, oldHash).
+		Update("password", newHash)
+	if result.Error != nil {
+		appLogger.Error(fmt.Sprintf("升级用户 %s 密码哈希失败: %v", username, result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	if user, exists := um.cache[username]; exists && user.Password == oldHash {
+		user.Password = newHash
+	}
+	appLogger.Info(fmt.Sprintf("用户 %s 密码哈希已升级为bcrypt", username))
+}
+
 // updateLastLogin 更新用户最后登录时间
 func (um *UserManager) updateLastLogin(username string) {
 	now := time.Now()
@@ -185,7 +306,19 @@ func (um *UserManager) updateLastLogin(username string) {
 }
 
 // CreateUser 创建新用户
-func (um *UserManager) CreateUser(username, password, displayName string) error {
+func (um *UserManager) CreateUser(username, password, displayName, role, allowedServers string) error {
+	if _, err := ParseServerScope(allowedServers); err != nil {
+		return fmt.Errorf("区服范围格式错误: %v", err)
+	}
+	if err := passwordPolicy.Validate(username, password); err != nil {
+		return err
+	}
+
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
 	um.mu.Lock()
 	defer um.mu.Unlock()
 
@@ -195,11 +328,16 @@ func (um *UserManager) CreateUser(username, password, displayName string) error
 	}
 
 	// 创建新用户
+	now := time.Now()
 	newUser := &LogUser{
-		Username:    username,
-		Password:    HashPassword(password),
-		DisplayName: displayName,
-		IsActive:    true,
+		Username:          username,
+		Password:          hashedPassword,
+		DisplayName:       displayName,
+		Role:              role,
+		AllowedServers:    allowedServers,
+		PasswordChangedAt: &now,
+		AuthSource:        AuthSourceLocal,
+		IsActive:          true,
 	}
 
 	if err := um.db.Create(newUser).Error; err != nil {
@@ -209,67 +347,302 @@ func (um *UserManager) CreateUser(username, password, displayName string) error
 	// 添加到缓存
 	um.cache[username] = newUser
 
-	appLogger.Info(fmt.Sprintf("新用户创建成功: %s (%s)", username, displayName))
+	appLogger.Info(fmt.Sprintf("新用户创建成功: %s (%s), 角色=%s", username, displayName, role))
 	return nil
 }
 
-// GetUser 获取用户信息
+// ProvisionExternalUser 外部认证登录成功后获取或创建对应的本地用户
+// 按 source+externalID 匹配已有用户，首次登录时自动创建（role 为空时使用 defaultRole）
+// role 不为空时已有用户的角色同步为该角色
+// 用户名已被其他来源的用户占用时返回错误，避免外部身份接管本地账号
+func (um *UserManager) ProvisionExternalUser(source, externalID, username, displayName, role, defaultRole string) (user *LogUser, created bool, err error) {
+	if username == "" || len([]rune(username)) > 50 {
+		return nil, false, fmt.Errorf("用户名为空或超过50个字符")
+	}
+	if displayName == "" {
+		displayName = username
+	}
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	for _, u := range um.cache {
+		if u.AuthSource == source && u.ExternalID == externalID {
+			user = u
+			break
+		}
+	}
+
+	if user != nil {
+		updates := map[string]interface{}{}
+		if displayName != user.DisplayName {
+			updates["display_name"] = displayName
+		}
+		if role != "" && role != user.Role {
+			updates["role"] = role
+		}
+		if len(updates) > 0 {
+			if err := um.db.Model(&LogUser{}).Where("username = ?", user.Username).Updates(updates).Error; err != nil {
+				return nil, false, fmt.Errorf("更新用户失败: %v", err)
+			}
+			if role != "" && role != user.Role {
+				appLogger.Info(fmt.Sprintf("用户 %s 角色按外部身份同步为 %s（原角色 %s）", user.Username, role, user.Role))
+				user.Role = role
+			}
+			user.DisplayName = displayName
+		}
+		return copyUser(user), false, nil
+	}
+
+	if existing, exists := um.cache[username]; exists {
+		source := existing.AuthSource
+		if existing.IsLocal() {
+			source = AuthSourceLocal
+		}
+		return nil, false, fmt.Errorf("用户名 '%s' 已被 %s 用户占用", username, source)
+	}
+	if role == "" {
+		role = defaultRole
+	}
+
+	// 外部用户不使用本地密码，保存一个随机密码的哈希
+	hashedPassword, err := HashPassword(generateSessionID())
+	if err != nil {
+		return nil, false, err
+	}
+
+	user = &LogUser{
+		Username:    username,
+		Password:    hashedPassword,
+		DisplayName: displayName,
+		Role:        role,
+		AuthSource:  source,
+		ExternalID:  externalID,
+		IsActive:    true,
+	}
+	if err := um.db.Create(user).Error; err != nil {
+		return nil, false, fmt.Errorf("创建用户失败: %v", err)
+	}
+	um.cache[username] = user
+
+	appLogger.Info(fmt.Sprintf("外部认证用户自动创建成功: %s (%s), 来源=%s, 角色=%s", username, displayName, source, role))
+	return copyUser(user), true, nil
+}
+
+// copyUser 复制缓存中的用户（调用前需要加锁）
+// 缓存中的用户只在持有写锁时修改，返回给调用方的必须是副本，否则读取时会与修改发生数据竞争
+func copyUser(user *LogUser) *LogUser {
+	copied := *user
+	return &copied
+}
+
+// GetUser 获取用户信息（返回副本，修改不会影响缓存）
 func (um *UserManager) GetUser(username string) (*LogUser, bool) {
 	um.mu.RLock()
 	defer um.mu.RUnlock()
 
 	user, exists := um.cache[username]
-	return user, exists
+	if !exists {
+		return nil, false
+	}
+	return copyUser(user), true
 }
 
-// ListUsers 获取所有活跃用户列表
-func (um *UserManager) ListUsers() []*LogUser {
+// 用户列表筛选状态
+const (
+	UserStatusActive   = "active"   // 仅活跃用户
+	UserStatusInactive = "inactive" // 仅已停用用户
+	UserStatusAll      = "all"      // 全部用户
+)
+
+// ListUsers 按状态获取用户列表（按创建顺序排列，返回副本）
+func (um *UserManager) ListUsers(status string) []*LogUser {
 	um.mu.RLock()
 	defer um.mu.RUnlock()
 
 	users := make([]*LogUser, 0, len(um.cache))
 	for _, user := range um.cache {
-		if user.IsActive {
-			users = append(users, user)
+		switch {
+		case status == UserStatusAll,
+			status == UserStatusInactive && !user.IsActive,
+			status != UserStatusInactive && user.IsActive:
+			users = append(users, copyUser(user))
 		}
 	}
 
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
 	return users
 }
 
 // UpdateUserPassword 更新用户密码
-func (um *UserManager) UpdateUserPassword(username, newPassword string) error {
-	um.mu.Lock()
-	defer um.mu.Unlock()
+// mustChange 为 true 时（管理员重置密码）要求用户下次登录后自行修改
+func (um *UserManager) UpdateUserPassword(username, newPassword string, mustChange bool) error {
+	if err := passwordPolicy.Validate(username, newPassword); err != nil {
+		return err
+	}
 
+	um.mu.RLock()
 	user, exists := um.cache[username]
+	var oldHash string
+	if exists {
+		user = copyUser(user)
+		oldHash = user.Password
+	}
+	um.mu.RUnlock()
 	if !exists {
 		return fmt.Errorf("用户 '%s' 不存在", username)
 	}
+	if !user.IsLocal() {
+		return fmt.Errorf("用户 '%s' 由 %s 认证，不能设置本地密码", username, user.AuthSource)
+	}
+
+	// 历史密码比较需要多次bcrypt校验，不在持有锁时执行
+	if err := um.checkPasswordReuse(username, oldHash, newPassword); err != nil {
+		return err
+	}
 
-	hashedPassword := HashPassword(newPassword)
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists = um.cache[username]
+	if !exists {
+		return fmt.Errorf("用户 '%s' 不存在", username)
+	}
 
 	// 更新数据库
-	if err := um.db.Model(&LogUser{}).Where("username = ?", username).Update("password", hashedPassword).Error; err != nil {
+	now := time.Now()
+	if err := um.db.Model(&LogUser{}).Where("username = ?", username).Updates(map[string]interface{}{
+		"password":             hashedPassword,
+		"must_change_password": mustChange,
+		"password_changed_at":  now,
+	}).Error; err != nil {
 		return fmt.Errorf("更新密码失败: %v", err)
 	}
+	um.recordPasswordHistory(username, user.Password)
 
 	// 更新缓存
 	user.Password = hashedPassword
+	user.MustChangePassword = mustChange
+	user.PasswordChangedAt = &now
+
+	// 密码修改后撤销该用户的全部会话（修改自己密码时由调用方重新签发会话）
+	if _, err := sessionManager.RevokeUserSessions(username); err != nil {
+		appLogger.Error(fmt.Sprintf("撤销用户 %s 会话失败: %v", username, err))
+	}
+	// 管理员重置密码（可能因为账号泄露）时同时撤销该用户的API令牌，避免泄露期间创建的令牌继续可用
+	if mustChange && apiTokenManager != nil {
+		if _, err := apiTokenManager.RevokeUserTokens(username); err != nil {
+			appLogger.Error(fmt.Sprintf("撤销用户 %s API令牌失败: %v", username, err))
+		}
+	}
 
 	appLogger.Info(fmt.Sprintf("用户 %s 密码更新成功", username))
 	return nil
 }
 
-// DeactivateUser 停用用户
+// UpdateUserRole 修改用户角色
+func (um *UserManager) UpdateUserRole(username, role string) error {
+	if !IsValidRole(role) {
+		return fmt.Errorf("无效的角色: %s", role)
+	}
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.cache[username]
+	if !exists {
+		return fmt.Errorf("用户 '%s' 不存在", username)
+	}
+
+	// root用户始终为管理员，避免系统失去管理入口
+	if username == "root" && role != RoleAdmin {
+		return fmt.Errorf("不能修改root管理员用户的角色")
+	}
+
+	if err := um.db.Model(&LogUser{}).Where("username = ?", username).Update("role", role).Error; err != nil {
+		return fmt.Errorf("修改角色失败: %v", err)
+	}
+
+	user.Role = role
+
+	appLogger.Info(fmt.Sprintf("用户 %s 角色修改为 %s", username, role))
+	return nil
+}
+
+// UpdateUserServers 修改用户可访问的区服范围
+func (um *UserManager) UpdateUserServers(username, allowedServers string) error {
+	if _, err := ParseServerScope(allowedServers); err != nil {
+		return fmt.Errorf("区服范围格式错误: %v", err)
+	}
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.cache[username]
+	if !exists {
+		return fmt.Errorf("用户 '%s' 不存在", username)
+	}
+
+	// root用户始终可访问全部区服
+	if username == "root" && allowedServers != "" {
+		return fmt.Errorf("不能限制root管理员用户的区服范围")
+	}
+
+	if err := um.db.Model(&LogUser{}).Where("username = ?", username).Update("allowed_servers", allowedServers).Error; err != nil {
+		return fmt.Errorf("修改区服范围失败: %v", err)
+	}
+
+	user.AllowedServers = allowedServers
+
+	appLogger.Info(fmt.Sprintf("用户 %s 区服范围修改为 '%s'", username, allowedServers))
+	return nil
+}
+
+// UpdateDisplayName 修改用户显示名称
+func (um *UserManager) UpdateDisplayName(username, displayName string) error {
+	displayName = strings.TrimSpace(displayName)
+	if displayName == "" || len([]rune(displayName)) > 100 {
+		return fmt.Errorf("显示名称不能为空且不超过100个字符")
+	}
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.cache[username]
+	if !exists {
+		return fmt.Errorf("用户 '%s' 不存在", username)
+	}
+
+	if err := um.db.Model(&LogUser{}).Where("username = ?", username).Update("display_name", displayName).Error; err != nil {
+		return fmt.Errorf("修改显示名称失败: %v", err)
+	}
+
+	user.DisplayName = displayName
+
+	appLogger.Info(fmt.Sprintf("用户 %s 显示名称修改为 %s", username, displayName))
+	return nil
+}
+
+// DeactivateUser 停用用户（保留用户数据，可重新启用）
 func (um *UserManager) DeactivateUser(username string) error {
 	um.mu.Lock()
 	defer um.mu.Unlock()
 
 	// 检查用户是否存在
-	if _, exists := um.cache[username]; !exists {
+	user, exists := um.cache[username]
+	if !exists {
 		return fmt.Errorf("用户 '%s' 不存在", username)
 	}
+	if !user.IsActive {
+		return fmt.Errorf("用户 '%s' 已经是停用状态", username)
+	}
 
 	// 不允许停用root用户
 	if username == "root" {
@@ -281,13 +654,89 @@ func (um *UserManager) DeactivateUser(username string) error {
 		return fmt.Errorf("停用用户失败: %v", err)
 	}
 
-	// 从缓存中移除
-	delete(um.cache, username)
+	// 更新缓存
+	user.IsActive = false
+
+	// 撤销该用户的全部会话和API令牌
+	if _, err := sessionManager.RevokeUserSessions(username); err != nil {
+		appLogger.Error(fmt.Sprintf("撤销用户 %s 会话失败: %v", username, err))
+	}
+	if apiTokenManager != nil {
+		if _, err := apiTokenManager.RevokeUserTokens(username); err != nil {
+			appLogger.Error(fmt.Sprintf("撤销用户 %s API令牌失败: %v", username, err))
+		}
+	}
 
 	appLogger.Info(fmt.Sprintf("用户 %s 已停用", username))
 	return nil
 }
 
+// ReactivateUser 重新启用已停用的用户
+// 停用时已撤销的会话和API令牌不会恢复，用户需要重新登录
+func (um *UserManager) ReactivateUser(username string) error {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.cache[username]
+	if !exists {
+		return fmt.Errorf("用户 '%s' 不存在", username)
+	}
+	if user.IsActive {
+		return fmt.Errorf("用户 '%s' 已经是活跃状态", username)
+	}
+
+	if err := um.db.Model(&LogUser{}).Where("username = ?", username).Update("is_active", true).Error; err != nil {
+		return fmt.Errorf("启用用户失败: %v", err)
+	}
+
+	user.IsActive = true
+
+	appLogger.Info(fmt.Sprintf("用户 %s 已重新启用", username))
+	return nil
+}
+
+// DeleteUser 永久删除用户及其会话、API令牌和历史密码（不可恢复）
+// 只能删除已停用的用户，避免误删正在使用的账号
+func (um *UserManager) DeleteUser(username string) error {
+	if username == "root" {
+		return fmt.Errorf("不能删除root管理员用户")
+	}
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	user, exists := um.cache[username]
+	if !exists {
+		return fmt.Errorf("用户 '%s' 不存在", username)
+	}
+	if user.IsActive {
+		return fmt.Errorf("请先停用用户 '%s' 再删除", username)
+	}
+
+	err := um.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("username = ?", username).Delete(&PasswordHistory{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("username = ?", username).Delete(&APIToken{}).Error; err != nil {
+			return err
+		}
+		// LogUser 带有 gorm.Model 软删除字段，这里需要物理删除以释放用户名
+		return tx.Unscoped().Where("username = ?", username).Delete(&LogUser{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("删除用户失败: %v", err)
+	}
+
+	delete(um.cache, username)
+
+	if _, err := sessionManager.RevokeUserSessions(username); err != nil {
+		appLogger.Error(fmt.Sprintf("撤销用户 %s 会话失败: %v", username, err))
+	}
+
+	appLogger.Info(fmt.Sprintf("用户 %s 已永久删除", username))
+	return nil
+}
+
 // GetUserCount 获取活跃用户数量
 func (um *UserManager) GetUserCount() int {
 	um.mu.RLock()
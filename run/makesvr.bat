@@ -2,7 +2,10 @@
 echo Building logsvr...
 if exist logsvr.exe del logsvr.exe
 cd ..\core
-go build -o ..\run\logsvr.exe .
+set COMMIT=unknown
+for /f %%i in ('git rev-parse --short HEAD 2^>nul') do set COMMIT=%%i
+for /f %%i in ('powershell -NoProfile -Command "(Get-Date).ToUniversalTime().ToString('yyyy-MM-ddTHH:mm:ssZ')"') do set BUILDTIME=%%i
+go build -ldflags "-X main.buildCommit=%COMMIT% -X main.buildTime=%BUILDTIME%" -o ..\run\logsvr.exe .
 cd ..\run
 if exist logsvr.exe (
     echo logsvr built successfully
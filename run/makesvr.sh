@@ -1,6 +1,9 @@
 rm -f logsvr
 cd ../core
-go build -o ../run/logsvr .
+# 构建信息写入程序，可通过 /version 接口查看
+commit=`git rev-parse --short HEAD 2>/dev/null || echo unknown`
+buildtime=`date -u +%Y-%m-%dT%H:%M:%SZ`
+go build -ldflags "-X main.buildCommit=$commit -X main.buildTime=$buildtime" -o ../run/logsvr .
 cd ../run
 chmod +x logsvr
-echo "logsvr built success"
\ No newline at end of file
+echo "logsvr built success"
@@ -1,2 +1,3 @@
 nohup ./logsvr > runtime.log 2>&1 &
+echo $! > logsvr.pid
 echo "logsvr started"
\ No newline at end of file
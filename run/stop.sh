@@ -1,4 +1,36 @@
-pid=`ps x | grep logsvr | grep -v "grep" | awk '{print $1}'`
+# 优先使用启动时写入的 pidfile，没有时按进程名精确匹配
+pid=""
+if [ -f logsvr.pid ]; then
+    pid=`cat logsvr.pid`
+    if ! kill -0 $pid 2>/dev/null || [ "`ps -p $pid -o comm=`" != "logsvr" ]; then
+        pid=""
+        rm -f logsvr.pid
+    fi
+fi
+if [ -z "$pid" ]; then
+    pid=`pgrep -x logsvr`
+fi
+if [ -z "$pid" ]; then
+    echo "logsvr process not found"
+    exit 0
+fi
+if [ `echo "$pid" | wc -l` -gt 1 ]; then
+    echo "found multiple logsvr processes: `echo $pid`, stop them manually"
+    exit 1
+fi
 
+# 发送 SIGTERM，等待服务处理完请求、保存缓存快照后退出
+kill -TERM $pid
+for i in $(seq 1 60); do
+    if ! kill -0 $pid 2>/dev/null; then
+        rm -f logsvr.pid
+        echo "logsvr process stopped"
+        exit 0
+    fi
+    sleep 1
+done
+
+# 超时仍未退出时强制结束
 kill -9 $pid
-echo "logsvr process killed"
\ No newline at end of file
+rm -f logsvr.pid
+echo "logsvr process killed after timeout"
@@ -1,191 +0,0 @@
--- 游戏数据监控系统数据库索引优化脚本（整型日期版本）
--- 适用于MySQL 5.7+
--- 执行前请确保连接到正确的数据库
-
--- =============================================
--- 表结构修改：添加 date_int 字段
--- =============================================
-
--- 添加 date_int 字段到所有表
-ALTER TABLE online_num ADD COLUMN date_int INT NOT NULL DEFAULT 0 COMMENT '日期整型字段，格式：YYYYMMDD';
-ALTER TABLE player ADD COLUMN date_int INT NOT NULL DEFAULT 0 COMMENT '日期整型字段，格式：YYYYMMDD';
-ALTER TABLE pay_report ADD COLUMN date_int INT NOT NULL DEFAULT 0 COMMENT '日期整型字段，格式：YYYYMMDD';
-
--- =============================================
--- 高效索引创建（基于整型日期字段）
--- =============================================
-
--- 在线人数表 (online_num) 核心索引
--- 1. 主查询索引：date_int + gamesvr_id（等值查询优化）
-ALTER TABLE online_num ADD INDEX idx_date_gamesvr_opt (date_int, gamesvr_id);
-
--- 2. 覆盖索引：包含查询所需的所有字段
-ALTER TABLE online_num ADD INDEX idx_date_gamesvr_online_opt (date_int, gamesvr_id, online_num);
-
--- 玩家表 (player) 核心索引  
--- 1. 主查询索引：date_int + gamesvr（等值查询优化）
-ALTER TABLE player ADD INDEX idx_date_gamesvr_opt (date_int, gamesvr);
-
--- 2. 新玩家查询索引：date_int + new_player + gamesvr
-ALTER TABLE player ADD INDEX idx_date_newplayer_gamesvr_opt (date_int, new_player, gamesvr);
-
--- 3. 去重查询优化索引：date_int + roleid
-ALTER TABLE player ADD INDEX idx_date_roleid_opt (date_int, roleid);
-
--- 4. 覆盖索引：包含常用查询字段
-ALTER TABLE player ADD INDEX idx_date_gamesvr_newplayer_roleid_opt (date_int, gamesvr, new_player, roleid);
-
--- 支付记录表 (pay_report) 核心索引
--- 1. 主查询索引：date_int + gamesvr（等值查询优化）
-ALTER TABLE pay_report ADD INDEX idx_date_gamesvr_opt (date_int, gamesvr);
-
--- 2. 排行榜查询索引：date_int + roleid + money
-ALTER TABLE pay_report ADD INDEX idx_date_roleid_money_opt (date_int, roleid, money);
-
--- 3. 去重查询优化索引：date_int + roleid  
-ALTER TABLE pay_report ADD INDEX idx_date_roleid_opt (date_int, roleid);
-
--- 4. 覆盖索引：包含排行榜所需的所有字段
-ALTER TABLE pay_report ADD INDEX idx_date_gamesvr_roleid_money_opt (date_int, gamesvr, roleid, money);
-
--- =============================================
--- 数据填充（如果有历史数据）
--- =============================================
-
--- 更新历史数据的 date_int 字段
--- 注意：这些操作在大表上可能耗时较长，建议在低峰期执行
-
-UPDATE online_num SET date_int = DATE_FORMAT(created_at, '%Y%m%d') WHERE date_int = 0;
-UPDATE player SET date_int = DATE_FORMAT(created_at, '%Y%m%d') WHERE date_int = 0;  
-UPDATE pay_report SET date_int = DATE_FORMAT(created_at, '%Y%m%d') WHERE date_int = 0;
-
--- =============================================
--- 性能验证查询
--- =============================================
-
--- 验证索引是否生效（检查执行计划）
--- 1. 活跃玩家查询
-EXPLAIN SELECT COUNT(DISTINCT roleid) FROM player WHERE date_int = 20250821 AND gamesvr = 1;
-
--- 2. 新增玩家查询  
-EXPLAIN SELECT COUNT(*) FROM player WHERE date_int = 20250821 AND new_player = 1 AND gamesvr = 1;
-
--- 3. 支付统计查询
-EXPLAIN SELECT COUNT(DISTINCT roleid) FROM pay_report WHERE date_int = 20250821 AND gamesvr = 1;
-
--- 4. 在线人数查询
-EXPLAIN SELECT MAX(online_num) FROM online_num WHERE date_int = 20250821 AND gamesvr_id = 1;
-
--- =============================================
--- 性能对比测试
--- =============================================
-
--- 测试前：基于 created_at 的范围查询
--- SET @start_time = NOW(6);
--- SELECT COUNT(DISTINCT roleid) FROM player 
--- WHERE created_at >= '2025-08-21 00:00:00' AND created_at < '2025-08-22 00:00:00' 
--- AND gamesvr = 1;
--- SET @end_time = NOW(6);
--- SELECT TIMESTAMPDIFF(MICROSECOND, @start_time, @end_time) AS old_query_time_microseconds;
-
--- 测试后：基于 date_int 的等值查询
--- SET @start_time = NOW(6);
--- SELECT COUNT(DISTINCT roleid) FROM player 
--- WHERE date_int = 20250821 AND gamesvr = 1;
--- SET @end_time = NOW(6);
--- SELECT TIMESTAMPDIFF(MICROSECOND, @start_time, @end_time) AS new_query_time_microseconds;
-
--- =============================================
--- 索引使用情况监控
--- =============================================
-
--- 查看索引大小
-SELECT 
-    table_name,
-    index_name,
-    ROUND(stat_value * @@innodb_page_size / 1024 / 1024, 2) AS size_mb
-FROM mysql.innodb_index_stats 
-WHERE stat_name = 'size' 
-    AND table_name IN ('online_num', 'player', 'pay_report')
-ORDER BY table_name, size_mb DESC;
-
--- 查看索引使用统计
-SELECT 
-    object_schema,
-    object_name,
-    index_name,
-    count_read,
-    count_insert,
-    count_update,
-    count_delete
-FROM performance_schema.table_io_waits_summary_by_index_usage 
-WHERE object_schema = DATABASE()
-    AND object_name IN ('online_num', 'player', 'pay_report')
-ORDER BY count_read DESC;
-
--- =============================================
--- 清理旧索引（可选，确认新索引性能良好后执行）
--- =============================================
-
--- 在确认新索引性能良好后，可以删除基于 created_at 的旧索引
--- ALTER TABLE online_num DROP INDEX idx_created_gamesvr;
--- ALTER TABLE player DROP INDEX idx_created_gamesvr;
--- ALTER TABLE player DROP INDEX idx_created_newplayer_gamesvr;
--- ALTER TABLE pay_report DROP INDEX idx_created_gamesvr;
-
--- =============================================
--- 性能优化建议
--- =============================================
-
-/*
-整型日期字段优化效果预期：
-
-1. 查询性能提升：
-   - 等值查询比范围查询快 20-30%
-   - 索引扫描效率提升 33%
-   - 内存缓存命中率提高
-
-2. 存储空间节省：
-   - 索引大小减少约 33%
-   - 数据存储空间减少 50%（4字节 vs 8字节）
-
-3. 查询模式对比：
-   旧方式: WHERE created_at >= ? AND created_at < ?
-   新方式: WHERE date_int = ?
-
-4. 最佳实践：
-   - 新数据插入时同时设置 date_int 字段
-   - 查询时优先使用 date_int 字段
-   - 保留 created_at 字段用于精确时间查询
-   - 定期监控索引使用情况
-
-5. 注意事项：
-   - date_int 字段仅支持日级别查询
-   - 跨日期查询需要使用 IN 或范围条件
-   - 数据一致性：确保 date_int 与 created_at 同步更新
-*/
-
--- 查看优化效果
-SELECT 
-    'online_num' as table_name,
-    COUNT(*) as total_rows,
-    COUNT(DISTINCT date_int) as distinct_dates,
-    MIN(date_int) as min_date,
-    MAX(date_int) as max_date
-FROM online_num
-UNION ALL
-SELECT 
-    'player' as table_name,
-    COUNT(*) as total_rows,
-    COUNT(DISTINCT date_int) as distinct_dates,
-    MIN(date_int) as min_date,
-    MAX(date_int) as max_date
-FROM player  
-UNION ALL
-SELECT 
-    'pay_report' as table_name,
-    COUNT(*) as total_rows,
-    COUNT(DISTINCT date_int) as distinct_dates,
-    MIN(date_int) as min_date,
-    MAX(date_int) as max_date
-FROM pay_report;
\ No newline at end of file
@@ -0,0 +1,22 @@
+// 修改数据的请求（POST/PUT/PATCH/DELETE）自动带上CSRF令牌
+(function() {
+    const originalFetch = window.fetch;
+    
+    function csrfToken() {
+        const match = document.cookie.match(/(?:^|;\s*)logsvr_csrf=([^;]*)/);
+        return match ? decodeURIComponent(match[1]) : '';
+    }
+    
+    window.fetch = function(input, init) {
+        init = init || {};
+        const method = (init.method || (input instanceof Request ? input.method : 'GET')).toUpperCase();
+        const url = new URL(input instanceof Request ? input.url : input, window.location.href);
+        
+        if (!['GET', 'HEAD', 'OPTIONS'].includes(method) && url.origin === window.location.origin) {
+            const headers = new Headers(init.headers || (input instanceof Request ? input.headers : undefined));
+            headers.set('X-CSRF-Token', csrfToken());
+            init.headers = headers;
+        }
+        return originalFetch.call(this, input, init);
+    };
+})();